@@ -0,0 +1,95 @@
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Container runtimes reported by InContainer.
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeLXC        = "lxc"
+	RuntimePodman     = "podman"
+)
+
+// Substrings of the cgroup paths of init identifying a runtime, in the order
+// they are tested. Podman and containerd are tested before docker because
+// they can be nested under docker-like paths.
+var cgroupSignatures = []struct {
+	substring string
+	runtime   string
+}{
+	{"libpod", RuntimePodman},
+	{"containerd", RuntimeContainerd},
+	{"docker", RuntimeDocker},
+	{"/lxc/", RuntimeLXC},
+	{"lxc.payload", RuntimeLXC},
+}
+
+var (
+	inContainer     bool
+	containerEngine string
+	inContainerOnce sync.Once
+)
+
+// InContainer returns true if the current process runs inside a container,
+// and the runtime of the container: docker, containerd, lxc, podman or any
+// other value of the container environment variable. The runtime is empty if
+// it could not be determined. The result is computed once and cached.
+func InContainer() (bool, string) {
+	inContainerOnce.Do(func() {
+		inContainer, containerEngine = detectContainer("/", os.Getenv)
+	})
+	return inContainer, containerEngine
+}
+
+// detectContainer looks for the container environment variable set by lxc,
+// podman and systemd-nspawn, for the marker files created by docker and
+// podman, and then for the cgroup of init in /proc/1/cgroup.
+func detectContainer(rootfsMountpoint string, getenv func(string) string) (bool, string) {
+	if runtime := getenv("container"); runtime != "" {
+		return true, runtime
+	}
+
+	if _, err := os.Stat(filepath.Join(rootfsMountpoint, ".dockerenv")); err == nil {
+		return true, RuntimeDocker
+	}
+	if _, err := os.Stat(filepath.Join(rootfsMountpoint, "run", ".containerenv")); err == nil {
+		return true, RuntimePodman
+	}
+
+	f, err := os.Open(filepath.Join(rootfsMountpoint, "proc", "1", "cgroup"))
+	if err != nil {
+		return false, ""
+	}
+	defer f.Close()
+
+	found := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Format: hierarchy-ID:subsystem-list:cgroup-path
+		fields := strings.SplitN(sc.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+
+		for _, s := range cgroupSignatures {
+			if strings.Contains(path, s.substring) {
+				return true, s.runtime
+			}
+		}
+
+		// Kubernetes pods run under one of the runtimes above, but their
+		// cgroup paths do not always name it.
+		if strings.HasPrefix(path, "/kubepods") {
+			found = true
+		}
+	}
+
+	return found, ""
+}
@@ -0,0 +1,56 @@
+package cgroup
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContainer(t *testing.T) {
+	noEnv := func(string) string { return "" }
+
+	tests := []struct {
+		fixture     string
+		inContainer bool
+		runtime     string
+	}{
+		{"docker", true, RuntimeDocker},
+		{"dockerenv", true, RuntimeDocker},
+		{"containerd", true, RuntimeContainerd},
+		{"lxc", true, RuntimeLXC},
+		{"podman", true, RuntimePodman},
+		{"kubepods", true, ""},
+		{"host", false, ""},
+		{"doesnotexist", false, ""},
+	}
+
+	for _, test := range tests {
+		rootfs := filepath.Join("testdata", "containers", test.fixture)
+		inContainer, runtime := detectContainer(rootfs, noEnv)
+		assert.Equal(t, test.inContainer, inContainer, test.fixture)
+		assert.Equal(t, test.runtime, runtime, test.fixture)
+	}
+}
+
+func TestDetectContainerEnv(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "container" {
+			return "systemd-nspawn"
+		}
+		return ""
+	}
+
+	inContainer, runtime := detectContainer(filepath.Join("testdata", "containers", "host"), getenv)
+	assert.True(t, inContainer)
+	assert.Equal(t, "systemd-nspawn", runtime)
+}
+
+func TestInContainerCached(t *testing.T) {
+	inContainer, runtime := InContainer()
+	t.Logf("in container: %v, runtime: %q", inContainer, runtime)
+
+	again, runtimeAgain := InContainer()
+	assert.Equal(t, inContainer, again)
+	assert.Equal(t, runtime, runtimeAgain)
+}
@@ -34,6 +34,7 @@ type Reader struct {
 	rootfsMountpoint  string
 	ignoreRootCgroups bool              // Ignore a cgroup when its path is "/".
 	cgroupMountpoints map[string]string // Mountpoints for each subsystem (e.g. cpu, cpuacct, memory, blkio).
+	version           int               // Version of the cgroup hierarchy, 1 or 2.
 }
 
 // NewReader creates and returns a new Reader.
@@ -42,6 +43,17 @@ func NewReader(rootfsMountpoint string, ignoreRootCgroups bool) (*Reader, error)
 		rootfsMountpoint = "/"
 	}
 
+	// The unified hierarchy replaces the per subsystem mounts, it is
+	// registered under the empty subsystem name used by /proc/[pid]/cgroup.
+	if unified := filepath.Join(rootfsMountpoint, "sys", "fs", "cgroup"); isUnifiedHierarchy(unified) {
+		return &Reader{
+			rootfsMountpoint:  rootfsMountpoint,
+			ignoreRootCgroups: ignoreRootCgroups,
+			cgroupMountpoints: map[string]string{"": unified},
+			version:           2,
+		}, nil
+	}
+
 	// Determine what subsystems are supported by the kernel.
 	subsystems, err := SupportedSubsystems(rootfsMountpoint)
 	if err != nil {
@@ -58,11 +70,24 @@ func NewReader(rootfsMountpoint string, ignoreRootCgroups bool) (*Reader, error)
 		rootfsMountpoint:  rootfsMountpoint,
 		ignoreRootCgroups: ignoreRootCgroups,
 		cgroupMountpoints: mountpoints,
+		version:           1,
 	}, nil
 }
 
+// CgroupVersion returns 2 when the cgroups are mounted as the v2 unified
+// hierarchy, and 1 otherwise.
+func (r *Reader) CgroupVersion() int {
+	return r.version
+}
+
 // GetStatsForProcess returns cgroup metrics and limits associated with a process.
+// It returns nil on the cgroup v2 hierarchy, use GetCgroupMem and GetCgroupCpu
+// there.
 func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
+	if r.version == 2 {
+		return nil, nil
+	}
+
 	// Read /proc/[pid]/cgroup to get the paths to the cgroup metrics.
 	paths, err := ProcessCgroupPaths(r.rootfsMountpoint, pid)
 	if err != nil {
@@ -72,26 +97,8 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 	// Build the full path for the subsystems we are interested in.
 	mounts := map[string]mount{}
 	for _, interestedSubsystem := range []string{"blkio", "cpu", "cpuacct", "memory"} {
-		path, found := paths[interestedSubsystem]
-		if !found {
-			continue
-		}
-
-		if path == "/" && r.ignoreRootCgroups {
-			continue
-		}
-
-		subsystemMount, found := r.cgroupMountpoints[interestedSubsystem]
-		if !found {
-			continue
-		}
-
-		mounts[interestedSubsystem] = mount{
-			subsystem:  interestedSubsystem,
-			mountpoint: subsystemMount,
-			path:       path,
-			id:         filepath.Base(path),
-			fullPath:   filepath.Join(subsystemMount, path),
+		if m, found := r.subsystemMount(paths, interestedSubsystem); found {
+			mounts[interestedSubsystem] = m
 		}
 	}
 
@@ -143,6 +150,39 @@ func (r *Reader) GetStatsForProcess(pid int) (*Stats, error) {
 	return &stats, nil
 }
 
+// subsystemMount returns the mount of a subsystem for the cgroup paths of a
+// process, or false if the subsystem is not mounted or the cgroup is ignored.
+// On cgroup v2 all subsystems share the mount of the unified hierarchy.
+func (r *Reader) subsystemMount(paths map[string]string, subsystem string) (mount, bool) {
+	if r.version == 2 {
+		// The unified hierarchy has an empty subsystem list in
+		// /proc/[pid]/cgroup (e.g. 0::/system.slice).
+		subsystem = ""
+	}
+
+	path, found := paths[subsystem]
+	if !found {
+		return mount{}, false
+	}
+
+	if path == "/" && r.ignoreRootCgroups {
+		return mount{}, false
+	}
+
+	subsystemMount, found := r.cgroupMountpoints[subsystem]
+	if !found {
+		return mount{}, false
+	}
+
+	return mount{
+		subsystem:  subsystem,
+		mountpoint: subsystemMount,
+		path:       path,
+		id:         filepath.Base(path),
+		fullPath:   filepath.Join(subsystemMount, path),
+	}, true
+}
+
 // getCommonCgroupMetadata returns Metadata containing the cgroup path and ID
 // iff all subsystems share a common path and ID. This is common for
 // containerized processes. If there is no common path and ID then the returned
@@ -0,0 +1,241 @@
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Memory limits at or above this value mean no limit on cgroup v1, where the
+// kernel reports the largest int64 rounded down to the page size.
+const unlimitedMemoryV1 = math.MaxInt64 &^ (1<<16 - 1)
+
+// CgroupMem contains the memory usage of a cgroup and its limit. Compare the
+// limit with the Mem.Total of the host to find the memory really available
+// to the processes of a container.
+type CgroupMem struct {
+	Metadata
+	Usage uint64 `json:"usage"` // Usage in bytes.
+	Limit uint64 `json:"limit"` // Limit in bytes, 0 when there is no limit.
+}
+
+// CgroupCpu contains the CPU usage of a cgroup and its CFS bandwidth limit.
+type CgroupCpu struct {
+	Metadata
+	// Total CPU time consumed by the tasks in the cgroup in nanoseconds.
+	UsageNanos uint64 `json:"usage_nanos"`
+	// Total amount of time in microseconds for which all tasks in the cgroup
+	// can run during one period, 0 when there is no limit.
+	QuotaMicros uint64 `json:"quota_us"`
+	// Length of a period in microseconds.
+	PeriodMicros uint64 `json:"period_us"`
+}
+
+// Cores returns the number of CPUs the cgroup is limited to, or 0 when there
+// is no limit.
+func (cpu CgroupCpu) Cores() float64 {
+	if cpu.QuotaMicros == 0 || cpu.PeriodMicros == 0 {
+		return 0
+	}
+	return float64(cpu.QuotaMicros) / float64(cpu.PeriodMicros)
+}
+
+// GetCgroupMem returns the memory usage and limit of the cgroup of the
+// current process, as found in /proc/self/cgroup. It returns nil if the
+// memory subsystem is not available.
+func (r *Reader) GetCgroupMem() (*CgroupMem, error) {
+	return r.getCgroupMem("self")
+}
+
+// GetCgroupMemForProcess returns the memory usage and limit of the cgroup of
+// a process.
+func (r *Reader) GetCgroupMemForProcess(pid int) (*CgroupMem, error) {
+	return r.getCgroupMem(strconv.Itoa(pid))
+}
+
+func (r *Reader) getCgroupMem(procDir string) (*CgroupMem, error) {
+	paths, err := processCgroupPaths(r.rootfsMountpoint, procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	m, found := r.subsystemMount(paths, "memory")
+	if !found {
+		return nil, nil
+	}
+
+	mem := &CgroupMem{Metadata: Metadata{ID: m.id, Path: m.path}}
+	if r.version == 2 {
+		if mem.Usage, err = parseUintFromFile(m.fullPath, "memory.current"); err != nil {
+			return nil, err
+		}
+		if mem.Limit, err = parseMaxFromFile(m.fullPath, "memory.max"); err != nil {
+			return nil, err
+		}
+		return mem, nil
+	}
+
+	mem.Usage, err = parseUintFromFile(m.fullPath, "memory.usage_in_bytes")
+	if err != nil {
+		return nil, err
+	}
+
+	mem.Limit, err = parseUintFromFile(m.fullPath, "memory.limit_in_bytes")
+	if err != nil {
+		return nil, err
+	}
+	if mem.Limit >= unlimitedMemoryV1 {
+		mem.Limit = 0
+	}
+
+	return mem, nil
+}
+
+// GetCgroupCpu returns the CPU usage and limit of the cgroup of the current
+// process, as found in /proc/self/cgroup. It returns nil if neither the cpu
+// nor the cpuacct subsystem is available.
+func (r *Reader) GetCgroupCpu() (*CgroupCpu, error) {
+	return r.getCgroupCpu("self")
+}
+
+// GetCgroupCpuForProcess returns the CPU usage and limit of the cgroup of a
+// process.
+func (r *Reader) GetCgroupCpuForProcess(pid int) (*CgroupCpu, error) {
+	return r.getCgroupCpu(strconv.Itoa(pid))
+}
+
+func (r *Reader) getCgroupCpu(procDir string) (*CgroupCpu, error) {
+	paths, err := processCgroupPaths(r.rootfsMountpoint, procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.version == 2 {
+		m, found := r.subsystemMount(paths, "cpu")
+		if !found {
+			return nil, nil
+		}
+
+		stats := &CgroupCpu{Metadata: Metadata{ID: m.id, Path: m.path}}
+		if err := cpuStatV2(m.fullPath, stats); err != nil {
+			return nil, err
+		}
+		if err := cpuMaxV2(m.fullPath, stats); err != nil {
+			return nil, err
+		}
+		return stats, nil
+	}
+
+	cpuacct, acctFound := r.subsystemMount(paths, "cpuacct")
+	cpu, cpuFound := r.subsystemMount(paths, "cpu")
+	if !acctFound && !cpuFound {
+		return nil, nil
+	}
+
+	stats := &CgroupCpu{}
+	if acctFound {
+		stats.Metadata = Metadata{ID: cpuacct.id, Path: cpuacct.path}
+		stats.UsageNanos, err = parseUintFromFile(cpuacct.fullPath, "cpuacct.usage")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cpuFound {
+		stats.Metadata = Metadata{ID: cpu.id, Path: cpu.path}
+		stats.PeriodMicros, err = parseUintFromFile(cpu.fullPath, "cpu.cfs_period_us")
+		if err != nil {
+			return nil, err
+		}
+
+		stats.QuotaMicros, err = parseUintFromFile(cpu.fullPath, "cpu.cfs_quota_us")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// isUnifiedHierarchy returns true if the cgroup v2 unified hierarchy is
+// mounted at path, which then has a cgroup.controllers file.
+func isUnifiedHierarchy(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "cgroup.controllers"))
+	return err == nil
+}
+
+// cpuStatV2 reads the usage_usec key of the cgroup v2 cpu.stat file.
+func cpuStatV2(path string, cpu *CgroupCpu) error {
+	f, err := os.Open(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		t, v, err := parseCgroupParamKeyValue(sc.Text())
+		if err != nil {
+			return err
+		}
+		if t == "usage_usec" {
+			cpu.UsageNanos = v * 1000
+		}
+	}
+
+	return sc.Err()
+}
+
+// cpuMaxV2 reads the cgroup v2 cpu.max file. Its format is "$MAX $PERIOD",
+// where $MAX is "max" when there is no limit.
+func cpuMaxV2(path string, cpu *CgroupCpu) error {
+	contents, err := ioutil.ReadFile(filepath.Join(path, "cpu.max"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	fields := bytes.Fields(contents)
+	if len(fields) != 2 {
+		return ErrInvalidFormat
+	}
+
+	if cpu.QuotaMicros, err = parseMax(fields[0]); err != nil {
+		return err
+	}
+	if cpu.PeriodMicros, err = parseUint(fields[1]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseMaxFromFile reads a single uint value from a cgroup v2 file where
+// "max" means no limit, and returns 0 for it.
+func parseMaxFromFile(path ...string) (uint64, error) {
+	value, err := ioutil.ReadFile(filepath.Join(path...))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return parseMax(value)
+}
+
+func parseMax(value []byte) (uint64, error) {
+	if string(bytes.TrimSpace(value)) == "max" {
+		return 0, nil
+	}
+	return parseUint(value)
+}
@@ -0,0 +1,134 @@
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderGetCgroupMem(t *testing.T) {
+	reader, err := NewReader("testdata/docker", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, reader.CgroupVersion())
+
+	mem, err := reader.GetCgroupMemForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem == nil {
+		t.Fatal("no cgroup memory found")
+	}
+
+	assert.Equal(t, id, mem.ID)
+	assert.Equal(t, path, mem.Path)
+	assert.Equal(t, uint64(295997440), mem.Usage)
+	assert.Equal(t, uint64(0), mem.Limit) // 9223372036854771712, no limit
+}
+
+func TestReaderGetCgroupCpu(t *testing.T) {
+	reader, err := NewReader("testdata/docker", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu, err := reader.GetCgroupCpuForProcess(985)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu == nil {
+		t.Fatal("no cgroup cpu found")
+	}
+
+	assert.Equal(t, id, cpu.ID)
+	assert.Equal(t, path, cpu.Path)
+	assert.Equal(t, uint64(95996653175), cpu.UsageNanos)
+	assert.Equal(t, uint64(100000), cpu.PeriodMicros)
+	assert.Equal(t, uint64(0), cpu.QuotaMicros)
+	assert.Equal(t, 0.0, cpu.Cores())
+
+	cpu.QuotaMicros = 150000
+	assert.Equal(t, 1.5, cpu.Cores())
+}
+
+func TestReaderGetCgroupSelf(t *testing.T) {
+	// Use the cgroups of pid 985 as the ones of the current process.
+	cgroups, err := ioutil.ReadFile("testdata/docker/proc/985/cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "testdata/docker/proc/self/cgroup"
+	if err = ioutil.WriteFile(self, cgroups, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(self)
+
+	reader, err := NewReader("testdata/docker", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem, err := reader.GetCgroupMem()
+	if assert.NoError(t, err) && assert.NotNil(t, mem) {
+		assert.Equal(t, uint64(295997440), mem.Usage)
+	}
+
+	cpu, err := reader.GetCgroupCpu()
+	if assert.NoError(t, err) && assert.NotNil(t, cpu) {
+		assert.Equal(t, uint64(95996653175), cpu.UsageNanos)
+	}
+}
+
+const cgroupV2TestData = "testdata/cgroupv2"
+
+func TestReaderGetCgroupMemV2(t *testing.T) {
+	reader, err := NewReader(cgroupV2TestData, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, reader.CgroupVersion())
+
+	mem, err := reader.GetCgroupMemForProcess(100)
+	if assert.NoError(t, err) && assert.NotNil(t, mem) {
+		assert.Equal(t, "docker-1234.scope", mem.ID)
+		assert.Equal(t, "/system.slice/docker-1234.scope", mem.Path)
+		assert.Equal(t, uint64(104857600), mem.Usage)
+		assert.Equal(t, uint64(536870912), mem.Limit)
+	}
+
+	mem, err = reader.GetCgroupMemForProcess(200)
+	if assert.NoError(t, err) && assert.NotNil(t, mem) {
+		assert.Equal(t, uint64(3221225472), mem.Usage)
+		assert.Equal(t, uint64(0), mem.Limit) // max
+	}
+}
+
+func TestReaderGetCgroupCpuV2(t *testing.T) {
+	reader, err := NewReader(cgroupV2TestData, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu, err := reader.GetCgroupCpuForProcess(100)
+	if assert.NoError(t, err) && assert.NotNil(t, cpu) {
+		assert.Equal(t, "/system.slice/docker-1234.scope", cpu.Path)
+		assert.Equal(t, uint64(2863064000), cpu.UsageNanos)
+		assert.Equal(t, uint64(150000), cpu.QuotaMicros)
+		assert.Equal(t, uint64(100000), cpu.PeriodMicros)
+		assert.Equal(t, 1.5, cpu.Cores())
+	}
+
+	cpu, err = reader.GetCgroupCpuForProcess(200)
+	if assert.NoError(t, err) && assert.NotNil(t, cpu) {
+		assert.Equal(t, uint64(987654321000), cpu.UsageNanos)
+		assert.Equal(t, uint64(0), cpu.QuotaMicros) // max
+		assert.Equal(t, 0.0, cpu.Cores())
+	}
+
+	stats, err := reader.GetStatsForProcess(100)
+	assert.NoError(t, err)
+	assert.Nil(t, stats)
+}
@@ -228,11 +228,17 @@ func SubsystemMountpoints(rootfsMountpoint string, subsystems map[string]struct{
 // ProcessCgroupPaths returns the cgroups to which a process belongs and the
 // pathname of the cgroup relative to the mountpoint of the subsystem.
 func ProcessCgroupPaths(rootfsMountpoint string, pid int) (map[string]string, error) {
+	return processCgroupPaths(rootfsMountpoint, strconv.Itoa(pid))
+}
+
+// processCgroupPaths reads the cgroup paths from /proc/<procDir>/cgroup, where
+// procDir is a pid or "self".
+func processCgroupPaths(rootfsMountpoint, procDir string) (map[string]string, error) {
 	if rootfsMountpoint == "" {
 		rootfsMountpoint = "/"
 	}
 
-	cgroup, err := os.Open(filepath.Join(rootfsMountpoint, "proc", strconv.Itoa(pid), "cgroup"))
+	cgroup, err := os.Open(filepath.Join(rootfsMountpoint, "proc", procDir, "cgroup"))
 	if err != nil {
 		return nil, err
 	}
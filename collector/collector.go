@@ -0,0 +1,177 @@
+// +build prometheus
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	sigar "github.com/elastic/gosigar"
+)
+
+const namespace = "sigar"
+
+var (
+	cpuTicksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cpu", "ticks_total"),
+		"Clock ticks spent by each CPU in each mode.",
+		[]string{"cpu", "mode"}, nil)
+
+	memTotalDesc      = gaugeDesc("mem", "total_bytes", "Total physical memory.")
+	memUsedDesc       = gaugeDesc("mem", "used_bytes", "Used physical memory, including caches and buffers.")
+	memFreeDesc       = gaugeDesc("mem", "free_bytes", "Free physical memory.")
+	memActualUsedDesc = gaugeDesc("mem", "actual_used_bytes", "Used physical memory, excluding caches and buffers.")
+	memActualFreeDesc = gaugeDesc("mem", "actual_free_bytes", "Physical memory available to processes, including caches and buffers.")
+
+	swapTotalDesc = gaugeDesc("swap", "total_bytes", "Total swap space.")
+	swapUsedDesc  = gaugeDesc("swap", "used_bytes", "Used swap space.")
+	swapFreeDesc  = gaugeDesc("swap", "free_bytes", "Free swap space.")
+
+	load1Desc  = gaugeDesc("", "load1", "Load average over 1 minute.")
+	load5Desc  = gaugeDesc("", "load5", "Load average over 5 minutes.")
+	load15Desc = gaugeDesc("", "load15", "Load average over 15 minutes.")
+
+	fsTotalDesc = fsDesc("total_bytes", "Size of the file system.")
+	fsUsedDesc  = fsDesc("used_bytes", "Used space of the file system.")
+	fsFreeDesc  = fsDesc("free_bytes", "Free space of the file system.")
+	fsAvailDesc = fsDesc("avail_bytes", "Free space of the file system available to unprivileged users.")
+)
+
+func gaugeDesc(subsystem, name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, nil, nil)
+}
+
+func fsDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "filesystem", name), help, []string{"path"}, nil)
+}
+
+// Collector implements prometheus.Collector for a Sigar. Metrics the
+// platform does not implement are left out.
+type Collector struct {
+	sigar sigar.Sigar
+	paths []string
+}
+
+var _ prometheus.Collector = &Collector{}
+
+// New returns a Collector reading the metrics from s, and the file system
+// usage of each of the paths.
+func New(s sigar.Sigar, paths ...string) *Collector {
+	return &Collector{sigar: s, paths: paths}
+}
+
+// Describe sends the descriptors of all the metrics of the Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		cpuTicksDesc,
+		memTotalDesc, memUsedDesc, memFreeDesc, memActualUsedDesc, memActualFreeDesc,
+		swapTotalDesc, swapUsedDesc, swapFreeDesc,
+		load1Desc, load5Desc, load15Desc,
+		fsTotalDesc, fsUsedDesc, fsFreeDesc, fsAvailDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect reads the metrics from the Sigar and sends them.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collectCpu(ch)
+	c.collectMem(ch)
+	c.collectSwap(ch)
+	c.collectLoad(ch)
+	for _, path := range c.paths {
+		c.collectFileSystem(ch, path)
+	}
+}
+
+func (c *Collector) collectCpu(ch chan<- prometheus.Metric) {
+	list, err := c.sigar.GetCpuList()
+	if err != nil {
+		invalid(ch, cpuTicksDesc, err)
+		return
+	}
+
+	for i, cpu := range list.List {
+		id := strconv.Itoa(i)
+		for _, mode := range []struct {
+			name  string
+			ticks uint64
+		}{
+			{"user", cpu.User},
+			{"nice", cpu.Nice},
+			{"sys", cpu.Sys},
+			{"idle", cpu.Idle},
+			{"wait", cpu.Wait},
+			{"irq", cpu.Irq},
+			{"softirq", cpu.SoftIrq},
+			{"stolen", cpu.Stolen},
+		} {
+			ch <- prometheus.MustNewConstMetric(cpuTicksDesc, prometheus.CounterValue, float64(mode.ticks), id, mode.name)
+		}
+	}
+}
+
+func (c *Collector) collectMem(ch chan<- prometheus.Metric) {
+	mem, err := c.sigar.GetMem()
+	if err != nil {
+		invalid(ch, memTotalDesc, err)
+		return
+	}
+
+	gauge(ch, memTotalDesc, mem.Total)
+	gauge(ch, memUsedDesc, mem.Used)
+	gauge(ch, memFreeDesc, mem.Free)
+	gauge(ch, memActualUsedDesc, mem.ActualUsed)
+	gauge(ch, memActualFreeDesc, mem.ActualFree)
+}
+
+func (c *Collector) collectSwap(ch chan<- prometheus.Metric) {
+	swap, err := c.sigar.GetSwap()
+	if err != nil {
+		invalid(ch, swapTotalDesc, err)
+		return
+	}
+
+	gauge(ch, swapTotalDesc, swap.Total)
+	gauge(ch, swapUsedDesc, swap.Used)
+	gauge(ch, swapFreeDesc, swap.Free)
+}
+
+func (c *Collector) collectLoad(ch chan<- prometheus.Metric) {
+	load, err := c.sigar.GetLoadAverage()
+	if err != nil {
+		invalid(ch, load1Desc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(load1Desc, prometheus.GaugeValue, load.One)
+	ch <- prometheus.MustNewConstMetric(load5Desc, prometheus.GaugeValue, load.Five)
+	ch <- prometheus.MustNewConstMetric(load15Desc, prometheus.GaugeValue, load.Fifteen)
+}
+
+func (c *Collector) collectFileSystem(ch chan<- prometheus.Metric, path string) {
+	usage, err := c.sigar.GetFileSystemUsage(path)
+	if err != nil {
+		invalid(ch, fsTotalDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(fsTotalDesc, prometheus.GaugeValue, float64(usage.Total), path)
+	ch <- prometheus.MustNewConstMetric(fsUsedDesc, prometheus.GaugeValue, float64(usage.Used), path)
+	ch <- prometheus.MustNewConstMetric(fsFreeDesc, prometheus.GaugeValue, float64(usage.Free), path)
+	ch <- prometheus.MustNewConstMetric(fsAvailDesc, prometheus.GaugeValue, float64(usage.Avail), path)
+}
+
+func gauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, value uint64) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+}
+
+// invalid reports err for desc, unless the metric is not implemented on
+// this platform.
+func invalid(ch chan<- prometheus.Metric, desc *prometheus.Desc, err error) {
+	if sigar.IsNotImplemented(err) {
+		return
+	}
+	ch <- prometheus.NewInvalidMetric(desc, err)
+}
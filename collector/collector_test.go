@@ -0,0 +1,95 @@
+// +build prometheus
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	sigar "github.com/elastic/gosigar"
+)
+
+// fakeSigar returns fixed metrics, the methods the Collector does not use
+// panic through the nil embedded interface.
+type fakeSigar struct {
+	sigar.Sigar
+}
+
+func (fakeSigar) GetCpuList() (sigar.CpuList, error) {
+	return sigar.CpuList{List: []sigar.Cpu{{User: 10, Sys: 5, Idle: 100}}}, nil
+}
+
+func (fakeSigar) GetMem() (sigar.Mem, error) {
+	return sigar.Mem{Total: 1000, Used: 600, Free: 400, ActualUsed: 300, ActualFree: 700}, nil
+}
+
+func (fakeSigar) GetSwap() (sigar.Swap, error) {
+	return sigar.Swap{}, sigar.ErrNotImplemented{OS: "fake"}
+}
+
+func (fakeSigar) GetLoadAverage() (sigar.LoadAverage, error) {
+	return sigar.LoadAverage{One: 1.5, Five: 1, Fifteen: 0.5}, nil
+}
+
+func (fakeSigar) GetFileSystemUsage(path string) (sigar.FileSystemUsage, error) {
+	return sigar.FileSystemUsage{Total: 2048, Used: 1024, Free: 1024, Avail: 512}, nil
+}
+
+func TestCollector(t *testing.T) {
+	expected := `
+# HELP sigar_cpu_ticks_total Clock ticks spent by each CPU in each mode.
+# TYPE sigar_cpu_ticks_total counter
+sigar_cpu_ticks_total{cpu="0",mode="idle"} 100
+sigar_cpu_ticks_total{cpu="0",mode="irq"} 0
+sigar_cpu_ticks_total{cpu="0",mode="nice"} 0
+sigar_cpu_ticks_total{cpu="0",mode="softirq"} 0
+sigar_cpu_ticks_total{cpu="0",mode="stolen"} 0
+sigar_cpu_ticks_total{cpu="0",mode="sys"} 5
+sigar_cpu_ticks_total{cpu="0",mode="user"} 10
+sigar_cpu_ticks_total{cpu="0",mode="wait"} 0
+# HELP sigar_filesystem_avail_bytes Free space of the file system available to unprivileged users.
+# TYPE sigar_filesystem_avail_bytes gauge
+sigar_filesystem_avail_bytes{path="/"} 512
+# HELP sigar_filesystem_free_bytes Free space of the file system.
+# TYPE sigar_filesystem_free_bytes gauge
+sigar_filesystem_free_bytes{path="/"} 1024
+# HELP sigar_filesystem_total_bytes Size of the file system.
+# TYPE sigar_filesystem_total_bytes gauge
+sigar_filesystem_total_bytes{path="/"} 2048
+# HELP sigar_filesystem_used_bytes Used space of the file system.
+# TYPE sigar_filesystem_used_bytes gauge
+sigar_filesystem_used_bytes{path="/"} 1024
+# HELP sigar_load1 Load average over 1 minute.
+# TYPE sigar_load1 gauge
+sigar_load1 1.5
+# HELP sigar_load15 Load average over 15 minutes.
+# TYPE sigar_load15 gauge
+sigar_load15 0.5
+# HELP sigar_load5 Load average over 5 minutes.
+# TYPE sigar_load5 gauge
+sigar_load5 1
+# HELP sigar_mem_actual_free_bytes Physical memory available to processes, including caches and buffers.
+# TYPE sigar_mem_actual_free_bytes gauge
+sigar_mem_actual_free_bytes 700
+# HELP sigar_mem_actual_used_bytes Used physical memory, excluding caches and buffers.
+# TYPE sigar_mem_actual_used_bytes gauge
+sigar_mem_actual_used_bytes 300
+# HELP sigar_mem_free_bytes Free physical memory.
+# TYPE sigar_mem_free_bytes gauge
+sigar_mem_free_bytes 400
+# HELP sigar_mem_total_bytes Total physical memory.
+# TYPE sigar_mem_total_bytes gauge
+sigar_mem_total_bytes 1000
+# HELP sigar_mem_used_bytes Used physical memory, including caches and buffers.
+# TYPE sigar_mem_used_bytes gauge
+sigar_mem_used_bytes 600
+`
+
+	// Swap is not implemented by the fake and must be left out.
+	c := New(fakeSigar{}, "/")
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
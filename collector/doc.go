@@ -0,0 +1,13 @@
+// Package collector exports the metrics of a gosigar.Sigar to Prometheus.
+//
+// The package depends on github.com/prometheus/client_golang, vendored at
+// the version pinned in Gopkg.toml, so it is only built with the prometheus
+// build tag, the other gosigar packages do not pull the dependency in:
+//
+//	go build -tags prometheus ./collector
+//
+// Register a Collector to export the CPU, memory, swap, load average and
+// file system usage of the host:
+//
+//	prometheus.MustRegister(collector.New(&gosigar.ConcreteSigar{}, "/", "/var"))
+package collector
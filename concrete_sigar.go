@@ -1,10 +1,25 @@
 package gosigar
 
 import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 )
 
-type ConcreteSigar struct{}
+type ConcreteSigar struct {
+	cacheTTL     time.Duration
+	procList     []int
+	procListTime time.Time
+	procListLock sync.Mutex
+	cpuSample    Cpu // Sample of the previous GetCpuPercentage call
+	cpuSampled   bool
+	cpuLock      sync.Mutex
+}
+
+var _ Sigar = &ConcreteSigar{}
 
 func (c *ConcreteSigar) CollectCpuStats(collectionInterval time.Duration) (<-chan Cpu, chan<- struct{}) {
 	// samplesCh is buffered to 1 value to immediately return first CPU sample
@@ -44,12 +59,327 @@ func (c *ConcreteSigar) CollectCpuStats(collectionInterval time.Duration) (<-cha
 	return samplesCh, stopCh
 }
 
+// CollectCpuListStats is like CollectCpuStats for each CPU, but the first
+// value is already the delta over the first collectionInterval. When the
+// number of online CPUs changes, no value is sent for that interval.
+func (c *ConcreteSigar) CollectCpuListStats(collectionInterval time.Duration) (<-chan CpuList, chan<- struct{}) {
+	samplesCh := make(chan CpuList, 1)
+
+	stopCh := make(chan struct{})
+
+	go func() {
+		var cpuList CpuList
+		cpuList.Get()
+
+		ticker := time.NewTicker(collectionInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				previous := cpuList.List
+
+				cpuList = CpuList{}
+				cpuList.Get()
+				if len(cpuList.List) != len(previous) {
+					continue
+				}
+
+				deltas := CpuList{List: make([]Cpu, len(previous))}
+				for i, cpu := range cpuList.List {
+					deltas.List[i] = cpu.Delta(previous[i])
+				}
+
+				select {
+				case samplesCh <- deltas:
+				default:
+					// Include default to avoid channel blocking
+				}
+
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return samplesCh, stopCh
+}
+
+// How long the first GetCpuPercentage call waits between its samples
+const cpuPercentInterval = 200 * time.Millisecond
+
+// GetCpuPercentage returns the CPU usage since the previous call. The
+// first call has no previous sample, it samples twice cpuPercentInterval
+// apart. Calls closer than a clock tick apart return zeros.
+func (c *ConcreteSigar) GetCpuPercentage() (CpuPercent, error) {
+	c.cpuLock.Lock()
+	defer c.cpuLock.Unlock()
+
+	if !c.cpuSampled {
+		if err := c.cpuSample.Get(); err != nil {
+			return CpuPercent{}, err
+		}
+		c.cpuSampled = true
+		time.Sleep(cpuPercentInterval)
+	}
+
+	cur := Cpu{}
+	if err := cur.Get(); err != nil {
+		return CpuPercent{}, err
+	}
+	prev := c.cpuSample
+	c.cpuSample = cur
+	return prev.DeltaPercent(cur), nil
+}
+
+// WatchProcesses polls the process list every interval and sends the pids
+// started and exited since the previous poll; the first poll only takes
+// the reference snapshot. Processes living shorter than interval are
+// missed. Unlike psnotify, it needs no privileges. The returned function
+// stops the polling and closes the channel, it can be called many times.
+func WatchProcesses(interval time.Duration) (<-chan ProcChange, func()) {
+	changes := make(chan ProcChange, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previous, _ := procSet()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			// the list is polled again at the next tick on errors
+			current, err := procSet()
+			if err != nil {
+				continue
+			}
+			if previous == nil {
+				previous = current
+				continue
+			}
+
+			change := ProcChange{}
+			for pid := range current {
+				if !previous[pid] {
+					change.Added = append(change.Added, pid)
+				}
+			}
+			for pid := range previous {
+				if !current[pid] {
+					change.Removed = append(change.Removed, pid)
+				}
+			}
+			previous = current
+
+			if len(change.Added) == 0 && len(change.Removed) == 0 {
+				continue
+			}
+			sort.Ints(change.Added)
+			sort.Ints(change.Removed)
+
+			select {
+			case changes <- change:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+	return changes, stop
+}
+
+// procSet returns the pids of the running processes as a set
+func procSet() (map[int]bool, error) {
+	list := ProcList{}
+	if err := list.Get(); err != nil {
+		return nil, err
+	}
+
+	pids := make(map[int]bool, len(list.List))
+	for _, pid := range list.List {
+		pids[pid] = true
+	}
+	return pids, nil
+}
+
+// ProcStateBatchWorkers is how many processes GetProcStateBatch reads at
+// the same time, values below 1 read them one by one.
+var ProcStateBatchWorkers = runtime.NumCPU()
+
+// GetProcStateBatch reads the ProcState of many pids with a pool of
+// ProcStateBatchWorkers goroutines. The states read are keyed by pid, the
+// errors of the others, like the ones of exited processes, are returned in
+// the order of pids.
+func (c *ConcreteSigar) GetProcStateBatch(pids []int) (map[int]ProcState, []error) {
+	workers := ProcStateBatchWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(pids) {
+		workers = len(pids)
+	}
+
+	// each worker only sets the entries of the indexes it received
+	states := make([]ProcState, len(pids))
+	errs := make([]error, len(pids))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = states[i].Get(pids[i])
+			}
+		}()
+	}
+	for i := range pids {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	result := make(map[int]ProcState, len(pids))
+	var failed []error
+	for i, pid := range pids {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		} else {
+			result[pid] = states[i]
+		}
+	}
+	return result, failed
+}
+
+// Collect gathers a Snapshot from s, reading its sections concurrently.
+// The sections that failed are named in the returned ErrPartial, the
+// others are set. Sections not implemented on this OS are left empty
+// without an error.
+func Collect(s Sigar, opts SnapshotOptions) (Snapshot, error) {
+	snap := Snapshot{Time: time.Now()}
+	if opts.FileSystemTimeout <= 0 {
+		opts.FileSystemTimeout = DefaultFileSystemTimeout
+	}
+
+	sections := map[string]func() error{
+		"mem": func() (err error) {
+			snap.Mem, err = s.GetMem()
+			return
+		},
+		"swap": func() (err error) {
+			snap.Swap, err = s.GetSwap()
+			return
+		},
+		"load_average": func() (err error) {
+			snap.LoadAverage, err = s.GetLoadAverage()
+			return
+		},
+		"uptime": func() (err error) {
+			snap.Uptime, err = s.GetUptime()
+			return
+		},
+		"cpus": func() (err error) {
+			snap.Cpus, err = s.GetCpuList()
+			return
+		},
+		"file_systems": func() error {
+			list, err := s.GetFileSystemList()
+			if err != nil {
+				return err
+			}
+			paths := make([]string, len(list.List))
+			for i, fs := range list.List {
+				paths[i] = fs.DirName
+			}
+			snap.FileSystems, err = s.GetFileSystemUsages(paths, opts.FileSystemTimeout)
+			return err
+		},
+	}
+	if opts.Processes {
+		sections["processes"] = func() (err error) {
+			snap.Processes, err = s.GetProcList()
+			return
+		}
+	}
+	if opts.Connections != 0 {
+		sections["connections"] = func() (err error) {
+			snap.Connections, err = s.GetNetConnections(opts.Connections)
+			return
+		}
+	}
+
+	// each section sets its own field of snap
+	errs := make(map[string]error)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for name, get := range sections {
+		wg.Add(1)
+		go func(name string, get func() error) {
+			defer wg.Done()
+
+			err := get()
+			if err == nil || IsNotImplemented(err) {
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			errs[name] = err
+		}(name, get)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return snap, ErrPartial{Errors: errs}
+	}
+	return snap, nil
+}
+
 func (c *ConcreteSigar) GetLoadAverage() (LoadAverage, error) {
 	l := LoadAverage{}
 	err := l.Get()
 	return l, err
 }
 
+// GetLoadAveragePercent returns the load averages as a percentage of the
+// number of CPUs, 100 meaning that every CPU is busy.
+func (c *ConcreteSigar) GetLoadAveragePercent() (LoadAverage, error) {
+	l := LoadAverage{}
+	if err := l.Get(); err != nil {
+		return l, err
+	}
+	cpus := CpuList{}
+	if err := cpus.Get(); err != nil {
+		return LoadAverage{}, err
+	}
+
+	l = l.PerCpu(len(cpus.List))
+	l.One *= 100
+	l.Five *= 100
+	l.Fifteen *= 100
+	return l, nil
+}
+
+// GetUptime returns the time since the system booted, see also BootTime
+func (c *ConcreteSigar) GetUptime() (Uptime, error) {
+	u := Uptime{}
+	err := u.Get()
+	return u, err
+}
+
 func (c *ConcreteSigar) GetMem() (Mem, error) {
 	m := Mem{}
 	err := m.Get()
@@ -62,18 +392,347 @@ func (c *ConcreteSigar) GetSwap() (Swap, error) {
 	return s, err
 }
 
+func (c *ConcreteSigar) GetSwapDevices() ([]SwapDevice, error) {
+	l := SwapDeviceList{}
+	err := l.Get()
+	return l.List, err
+}
+
+func (c *ConcreteSigar) GetCpuList() (CpuList, error) {
+	l := CpuList{}
+	err := l.Get()
+	return l, err
+}
+
+func (c *ConcreteSigar) GetCpuFreq(core int) (CpuFreq, error) {
+	f := CpuFreq{}
+	err := f.Get(core)
+	return f, err
+}
+
+func (c *ConcreteSigar) GetCpuTopology() (CpuTopology, error) {
+	t := CpuTopology{}
+	err := t.Get()
+	return t, err
+}
+
+func (c *ConcreteSigar) GetNumaNodes() ([]NumaNode, error) {
+	l := NumaNodeList{}
+	err := l.Get()
+	return l.List, err
+}
+
+func (c *ConcreteSigar) GetTemperatures() ([]Temperature, error) {
+	l := TemperatureList{}
+	err := l.Get()
+	return l.List, err
+}
+
+func (c *ConcreteSigar) GetFans() ([]Fan, error) {
+	l := FanList{}
+	err := l.Get()
+	return l.List, err
+}
+
+func (c *ConcreteSigar) GetBatteries() ([]Battery, error) {
+	l := BatteryList{}
+	err := l.Get()
+	return l.List, err
+}
+
+// GetHugePages returns the pools of each huge page size, or the pool of the
+// default size when the kernel does not list them.
+func (c *ConcreteSigar) GetHugePages() ([]HugePages, error) {
+	p := HugeTLBPages{}
+	if err := p.Get(); err != nil {
+		return nil, err
+	}
+	return p.pools(), nil
+}
+
 func (c *ConcreteSigar) GetHugeTLBPages() (HugeTLBPages, error) {
 	p := HugeTLBPages{}
 	err := p.Get()
 	return p, err
 }
 
+// GetFileSystemList returns the mounted file systems without the pseudo
+// file systems listed by PseudoFileSystems, use FileSystemList.Get for all
+// the mounts
+func (c *ConcreteSigar) GetFileSystemList() (FileSystemList, error) {
+	l := FileSystemList{}
+	if err := l.Get(); err != nil {
+		return l, err
+	}
+
+	pseudo := pseudoFileSystemTypes()
+	list := l.List[:0]
+	for _, fs := range l.List {
+		if !pseudo[fs.SysTypeName] {
+			list = append(list, fs)
+		}
+	}
+	l.List = list
+	return l, nil
+}
+
+// FileSystemsAboveThreshold returns the mount points of list whose usage
+// exceeds percent, see FileSystemUsage.ExceedsThreshold. Read-only and
+// pseudo file systems are skipped. The usages are read from DefaultSigar,
+// the mount points that could not be read are the keys of the returned
+// ErrPartial.
+func FileSystemsAboveThreshold(list FileSystemList, percent float64) ([]string, error) {
+	pseudo := pseudoFileSystemTypes()
+	var paths []string
+	for _, fs := range list.List {
+		if pseudo[fs.SysTypeName] || fs.HasOption("ro") {
+			continue
+		}
+		paths = append(paths, fs.DirName)
+	}
+
+	usages, err := DefaultSigar.GetFileSystemUsages(paths, DefaultFileSystemTimeout)
+	var above []string
+	for _, path := range paths {
+		if usage, ok := usages[path]; ok && usage.ExceedsThreshold(percent) {
+			above = append(above, path)
+		}
+	}
+	return above, err
+}
+
+// FileSystemForPath returns the mounted file system holding path, after
+// resolving its symlinks. All the mounts are considered, so a path below a
+// bind mount or in /proc resolves to that mount.
+func FileSystemForPath(path string) (FileSystem, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return FileSystem{}, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return FileSystem{}, err
+	}
+
+	l := FileSystemList{}
+	if err := l.Get(); err != nil {
+		return FileSystem{}, err
+	}
+	fs, ok := l.ForPath(abs)
+	if !ok {
+		return FileSystem{}, fmt.Errorf("no mounted file system holds %s", abs)
+	}
+	return fs, nil
+}
+
 func (c *ConcreteSigar) GetFileSystemUsage(path string) (FileSystemUsage, error) {
 	f := FileSystemUsage{}
 	err := f.Get(path)
 	return f, err
 }
 
+// GetFileSystemUsageTimeout is like GetFileSystemUsage but gives up with an
+// ErrTimeout when statfs does not return within timeout, like on a hung NFS
+// mount. The system call cannot be interrupted: its goroutine is abandoned
+// and lingers until the call returns, which may be never.
+func (c *ConcreteSigar) GetFileSystemUsageTimeout(path string, timeout time.Duration) (FileSystemUsage, error) {
+	type result struct {
+		usage FileSystemUsage
+		err   error
+	}
+	// buffered for the abandoned goroutine to exit when statfs returns
+	done := make(chan result, 1)
+
+	go func() {
+		f := FileSystemUsage{}
+		err := f.Get(path)
+		done <- result{f, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.usage, r.err
+	case <-timer.C:
+		return FileSystemUsage{}, ErrTimeout{Path: path, Timeout: timeout}
+	}
+}
+
+// GetFileSystemUsages reads the usage of several file systems concurrently,
+// with GetFileSystemUsageTimeout, so a hung mount only delays the result
+// by timeout. The usages are keyed by path, the paths that failed are the
+// keys of the returned ErrPartial.
+func (c *ConcreteSigar) GetFileSystemUsages(paths []string, timeout time.Duration) (map[string]FileSystemUsage, error) {
+	usages := make(map[string]FileSystemUsage, len(paths))
+	errs := make(map[string]error)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for _, path := range paths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+
+			usage, err := c.GetFileSystemUsageTimeout(path, timeout)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs[path] = err
+			} else {
+				usages[path] = usage
+			}
+		}(path)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return usages, ErrPartial{Errors: errs}
+	}
+	return usages, nil
+}
+
+// GetFileSystemUsageByDevice returns the usage of the file system mounted
+// from the device dev, see FileSystemList.ForDevice
+func (c *ConcreteSigar) GetFileSystemUsageByDevice(dev string) (FileSystemUsage, error) {
+	l := FileSystemList{}
+	if err := l.Get(); err != nil {
+		return FileSystemUsage{}, err
+	}
+	fs, ok := l.ForDevice(dev)
+	if !ok {
+		return FileSystemUsage{}, fmt.Errorf("device %s is not mounted", dev)
+	}
+	return c.GetFileSystemUsage(fs.DirName)
+}
+
+// GetDiskIoList returns the I/O counters of the whole disks,
+// use DiskIoList.Get to include partitions
+func (c *ConcreteSigar) GetDiskIoList() (DiskIoList, error) {
+	l := DiskIoList{}
+	err := l.Get()
+	return l, err
+}
+
+func (c *ConcreteSigar) GetNetIfaceStats() ([]NetIfaceStat, error) {
+	l := NetIfaceStatList{}
+	err := l.Get()
+	return l.List, err
+}
+
+func (c *ConcreteSigar) GetNetProtoStats() (NetProtoStats, error) {
+	s := NetProtoStats{}
+	err := s.Get()
+	return s, err
+}
+
+func (c *ConcreteSigar) GetNetConnections(flags NetConnFlags) ([]NetConnection, error) {
+	l := NetConnectionList{}
+	err := l.Get(flags)
+	return l.List, err
+}
+
+// GetProcNetConnections returns the sockets of a single process, which is
+// cheaper than resolving the pids of all sockets with GetNetConnections
+func (c *ConcreteSigar) GetProcNetConnections(pid int) ([]NetConnection, error) {
+	l := ProcNetConnections{}
+	err := l.Get(pid)
+	return l.List, err
+}
+
+// SetCacheTTL sets how long GetProcList keeps returning the same snapshot
+// of the process list, 0 (the default) disables the cache
+func (c *ConcreteSigar) SetCacheTTL(ttl time.Duration) {
+	c.procListLock.Lock()
+	defer c.procListLock.Unlock()
+
+	c.cacheTTL = ttl
+	c.procList = nil
+}
+
+// GetProcList returns a copy of the pids of the running processes, scanning
+// the process table at most once per cache TTL
+func (c *ConcreteSigar) GetProcList() ([]int, error) {
+	c.procListLock.Lock()
+	defer c.procListLock.Unlock()
+
+	if c.procList == nil || time.Since(c.procListTime) >= c.cacheTTL {
+		l := ProcList{}
+		if err := l.Get(); err != nil {
+			return nil, err
+		}
+		c.procList = l.List
+		c.procListTime = time.Now()
+	}
+
+	list := make([]int, len(c.procList))
+	copy(list, c.procList)
+	return list, nil
+}
+
+// GetProcListFiltered returns the pids of the running processes matching f,
+// reading only what the filter needs of each process, e.g. not the owner
+// when no Uids are set. Processes that exit or cannot be read while they
+// are filtered are left out.
+func (c *ConcreteSigar) GetProcListFiltered(f ProcFilter) ([]int, error) {
+	pids, err := c.GetProcList()
+	if err != nil {
+		return nil, err
+	}
+
+	list := pids[:0]
+	for _, pid := range pids {
+		ok, err := matchProc(pid, f)
+		if err != nil {
+			if IsNotImplemented(err) {
+				return nil, err
+			}
+			continue
+		}
+		if ok {
+			list = append(list, pid)
+		}
+	}
+	return list, nil
+}
+
+func (c *ConcreteSigar) GetProcArgs(pid int) ([]string, error) {
+	a := ProcArgs{}
+	err := a.Get(pid)
+	return a.List, err
+}
+
+// GetProcCwd returns the working directory of a process, even when its
+// other ProcExe links cannot be read
+func (c *ConcreteSigar) GetProcCwd(pid int) (string, error) {
+	return procExeLink(pid, "cwd", func(exe ProcExe) string { return exe.Cwd })
+}
+
+// GetProcRoot returns the root directory of a process, even when its
+// other ProcExe links cannot be read
+func (c *ConcreteSigar) GetProcRoot(pid int) (string, error) {
+	return procExeLink(pid, "root", func(exe ProcExe) string { return exe.Root })
+}
+
+func procExeLink(pid int, link string, field func(ProcExe) string) (string, error) {
+	exe := ProcExe{}
+	err := exe.Get(pid)
+	if partial, ok := err.(ErrPartial); ok {
+		if linkErr, failed := partial.Errors[link]; failed {
+			return "", linkErr
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if field(exe) == "" {
+		return "", ErrNotImplemented{runtime.GOOS}
+	}
+	return field(exe), nil
+}
+
 func (c *ConcreteSigar) GetFDUsage() (FDUsage, error) {
 	fd := FDUsage{}
 	err := fd.Get()
@@ -87,3 +746,19 @@ func (c *ConcreteSigar) GetRusage(who int) (Rusage, error) {
 	err := r.Get(who)
 	return r, err
 }
+
+func (c *ConcreteSigar) NumCpu() (online, possible int, err error) {
+	return numCpu()
+}
+
+func (c *ConcreteSigar) GetPressure() (cpu, mem, io PressureStall, err error) {
+	return getPressure()
+}
+
+func (c *ConcreteSigar) DeviceName(major, minor int) (string, error) {
+	return deviceName(major, minor)
+}
+
+func (c *ConcreteSigar) DeviceNumber(path string) (major, minor int, err error) {
+	return deviceNumber(path)
+}
@@ -1,6 +1,11 @@
 package gosigar_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -32,6 +37,120 @@ func TestConcreteCollectCpuStats(t *testing.T) {
 	stop <- struct{}{}
 }
 
+func TestWatchProcesses(t *testing.T) {
+	changes, stop := sigar.WatchProcesses(20 * time.Millisecond)
+	defer stop()
+
+	// let the first poll take the reference snapshot
+	time.Sleep(100 * time.Millisecond)
+
+	cmd := exec.Command("sleep", "10")
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("ping", "-n", "10", "127.0.0.1")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+
+	waitFor := func(removed bool) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case change, ok := <-changes:
+				if !ok {
+					t.Fatal("changes closed before the stop")
+				}
+				pids := change.Added
+				if removed {
+					pids = change.Removed
+				}
+				for _, p := range pids {
+					if p == pid {
+						return
+					}
+				}
+			case <-timeout:
+				t.Fatalf("no change for pid %d, removed=%v", pid, removed)
+			}
+		}
+	}
+
+	waitFor(false)
+	cmd.Process.Kill()
+	cmd.Wait()
+	waitFor(true)
+
+	// stopping closes the channel and is idempotent
+	stop()
+	stop()
+	for range changes {
+	}
+}
+
+func TestConcreteCollectCpuListStats(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+
+	cumulative, err := concreteSigar.GetCpuList()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	samplesCh, stop := concreteSigar.CollectCpuListStats(200 * time.Millisecond)
+	defer func() { stop <- struct{}{} }()
+
+	// The first value is a delta, far below the counters since boot.
+	first := <-samplesCh
+	if assert.Len(t, first.List, len(cumulative.List)) {
+		for i, cpu := range first.List {
+			assert.True(t, cpu.Total() < cumulative.List[i].Total(),
+				"cpu %d: delta %d, since boot %d", i, cpu.Total(), cumulative.List[i].Total())
+		}
+	}
+
+	second := <-samplesCh
+	assert.Len(t, second.List, len(first.List))
+}
+
+func TestConcreteGetCpuPercentage(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+
+	// The first call waits for a second sample.
+	pct, err := concreteSigar.GetCpuPercentage()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.InDelta(t, 100, pct.Busy()+pct.Idle, 0.01)
+
+	// Concurrent calls each get the delta since the previous one, which
+	// is all zeros when no tick elapsed.
+	results := make(chan sigar.CpuPercent)
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			pct, err := concreteSigar.GetCpuPercentage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- pct
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case pct := <-results:
+			if total := pct.Busy() + pct.Idle; total != 0 {
+				assert.InDelta(t, 100, total, 0.01)
+			}
+		case err := <-errs:
+			t.Error(err)
+		}
+	}
+}
+
 func TestConcreteGetLoadAverage(t *testing.T) {
 	concreteSigar := &sigar.ConcreteSigar{}
 	avg, err := concreteSigar.GetLoadAverage()
@@ -43,6 +162,110 @@ func TestConcreteGetLoadAverage(t *testing.T) {
 	}
 }
 
+func TestConcreteGetLoadAveragePercent(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	pct, err := concreteSigar.GetLoadAveragePercent()
+	skipNotImplemented(t, err, "windows")
+	if assert.NoError(t, err) {
+		assert.True(t, pct.One >= 0, "One (%f) must not be negative", pct.One)
+		assert.True(t, pct.Fifteen >= 0, "Fifteen (%f) must not be negative", pct.Fifteen)
+	}
+}
+
+func TestConcreteGetCpuList(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	cpuList, err := concreteSigar.GetCpuList()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, cpuList.List)
+		for _, cpu := range cpuList.List {
+			assert.True(t, cpu.Total() > 0)
+		}
+	}
+}
+
+func TestConcreteGetUptime(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	uptime, err := concreteSigar.GetUptime()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if assert.NoError(t, err) {
+		assert.True(t, uptime.Length > 0)
+	}
+}
+
+func TestBootTime(t *testing.T) {
+	bootTime, err := sigar.BootTime()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if assert.NoError(t, err) {
+		assert.True(t, bootTime.Before(time.Now()))
+
+		again, err := sigar.BootTime()
+		assert.NoError(t, err)
+		assert.Equal(t, bootTime, again)
+	}
+}
+
+func TestConcreteGetDiskIoList(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	_, err := concreteSigar.GetDiskIoList()
+	skipNotImplemented(t, err, "windows", "freebsd", "openbsd", "netbsd", "solaris")
+	assert.NoError(t, err)
+}
+
+func TestConcreteGetNetIfaceStats(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	ifaces, err := concreteSigar.GetNetIfaceStats()
+	skipNotImplemented(t, err, "windows", "freebsd", "openbsd", "netbsd", "solaris")
+	if assert.NoError(t, err) {
+		loopback := false
+		for _, iface := range ifaces {
+			loopback = loopback || iface.Loopback
+		}
+		assert.True(t, loopback, "the loopback interface is listed")
+	}
+}
+
+func TestConcreteGetNetConnections(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	_, err := concreteSigar.GetNetConnections(sigar.NetConnAll)
+	skipNotImplemented(t, err, "darwin", "windows", "freebsd", "openbsd", "netbsd", "solaris")
+	assert.NoError(t, err)
+}
+
+func TestConcreteGetProcNetConnections(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	_, err := concreteSigar.GetProcNetConnections(os.Getpid())
+	skipNotImplemented(t, err, "darwin", "windows", "freebsd", "openbsd", "netbsd", "solaris")
+	assert.NoError(t, err)
+}
+
+func TestConcreteGetProcList(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+	concreteSigar.SetCacheTTL(time.Hour)
+
+	pids, err := concreteSigar.GetProcList()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, pids, os.Getpid())
+
+	// Callers get their own copy of the cached snapshot.
+	pids[0] = -1
+	cached, err := concreteSigar.GetProcList()
+	if assert.NoError(t, err) {
+		assert.NotContains(t, cached, -1)
+		assert.Equal(t, len(pids), len(cached))
+	}
+
+	// Resetting the TTL invalidates the snapshot.
+	concreteSigar.SetCacheTTL(0)
+	fresh, err := concreteSigar.GetProcList()
+	if assert.NoError(t, err) {
+		assert.Contains(t, fresh, os.Getpid())
+	}
+}
+
 func TestConcreteGetMem(t *testing.T) {
 	concreteSigar := &sigar.ConcreteSigar{}
 	mem, err := concreteSigar.GetMem()
@@ -76,6 +299,87 @@ func TestConcreteFileSystemUsage(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestConcreteGetFileSystemUsages(t *testing.T) {
+	concreteSigar := &sigar.ConcreteSigar{}
+
+	tmp := os.TempDir()
+	usage, err := concreteSigar.GetFileSystemUsageTimeout(tmp, 10*time.Second)
+	if assert.NoError(t, err) {
+		assert.True(t, usage.Total > 0)
+	}
+
+	missing := "/i/hope/this/does/not/exist"
+	usages, err := concreteSigar.GetFileSystemUsages([]string{tmp, missing}, 10*time.Second)
+	if assert.True(t, sigar.IsPartial(err), "err=%v", err) {
+		assert.Contains(t, err.(sigar.ErrPartial).Errors, missing)
+	}
+	if assert.Contains(t, usages, tmp) {
+		assert.True(t, usages[tmp].Total > 0)
+	}
+	assert.NotContains(t, usages, missing)
+}
+
+func TestIsTimeout(t *testing.T) {
+	err := sigar.ErrTimeout{Path: "/mnt/nfs", Timeout: time.Second}
+	assert.True(t, sigar.IsTimeout(err))
+	assert.True(t, sigar.IsTimeout(&err))
+	assert.Equal(t, "timeout after 1s reading /mnt/nfs", err.Error())
+	assert.False(t, sigar.IsTimeout(sigar.ErrNotImplemented{OS: runtime.GOOS}))
+}
+
+func TestFileSystemForPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sigarFileSystem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fs, err := sigar.FileSystemForPath(tmp)
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, fs.DirName)
+
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(tmp, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	linked, err := sigar.FileSystemForPath(link)
+	if assert.NoError(t, err) {
+		assert.Equal(t, fs, linked)
+	}
+
+	_, err = sigar.FileSystemForPath(filepath.Join(tmp, "missing"))
+	assert.True(t, os.IsNotExist(err), "err=%v", err)
+}
+
+func TestConcreteGetFileSystemList(t *testing.T) {
+	all := sigar.FileSystemList{}
+	err := all.Get()
+	skipNotImplemented(t, err, "netbsd", "solaris")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	concreteSigar := &sigar.ConcreteSigar{}
+	filtered, err := concreteSigar.GetFileSystemList()
+	if assert.NoError(t, err) {
+		assert.True(t, len(filtered.List) <= len(all.List))
+		for _, fs := range filtered.List {
+			assert.NotContains(t, sigar.DefaultPseudoFileSystems, fs.SysTypeName)
+		}
+	}
+
+	// An empty override keeps all the mounts.
+	sigar.PseudoFileSystems = []string{}
+	defer func() { sigar.PseudoFileSystems = nil }()
+	unfiltered, err := concreteSigar.GetFileSystemList()
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(all.List), len(unfiltered.List))
+	}
+}
+
 func TestConcreteGetFDUsage(t *testing.T) {
 	concreteSigar := &sigar.ConcreteSigar{}
 	fdUsage, err := concreteSigar.GetFDUsage()
@@ -95,3 +399,98 @@ func TestConcreteGetRusage(t *testing.T) {
 		assert.True(t, resourceUsage.Stime >= 0)
 	}
 }
+
+// snapshotSigar implements the methods used by Collect, the embedded nil
+// Sigar panics on the others
+type snapshotSigar struct {
+	sigar.Sigar
+}
+
+func (s *snapshotSigar) GetMem() (sigar.Mem, error) {
+	return sigar.Mem{Total: 1024, Used: 512, Free: 512}, nil
+}
+
+func (s *snapshotSigar) GetSwap() (sigar.Swap, error) {
+	return sigar.Swap{}, errors.New("no swap")
+}
+
+func (s *snapshotSigar) GetLoadAverage() (sigar.LoadAverage, error) {
+	return sigar.LoadAverage{}, sigar.ErrNotImplemented{OS: "test"}
+}
+
+func (s *snapshotSigar) GetUptime() (sigar.Uptime, error) {
+	return sigar.Uptime{Length: 60}, nil
+}
+
+func (s *snapshotSigar) GetCpuList() (sigar.CpuList, error) {
+	return sigar.CpuList{List: []sigar.Cpu{{User: 1}, {User: 2}}}, nil
+}
+
+func (s *snapshotSigar) GetFileSystemList() (sigar.FileSystemList, error) {
+	return sigar.FileSystemList{List: []sigar.FileSystem{{DirName: "/"}, {DirName: "/mnt/nfs"}}}, nil
+}
+
+func (s *snapshotSigar) GetFileSystemUsages(paths []string, timeout time.Duration) (map[string]sigar.FileSystemUsage, error) {
+	return map[string]sigar.FileSystemUsage{"/": {Total: 100}},
+		sigar.ErrPartial{Errors: map[string]error{"/mnt/nfs": sigar.ErrTimeout{Path: "/mnt/nfs", Timeout: timeout}}}
+}
+
+func (s *snapshotSigar) GetProcList() ([]int, error) {
+	return []int{1, 42}, nil
+}
+
+func TestCollect(t *testing.T) {
+	snap, err := sigar.Collect(&snapshotSigar{}, sigar.SnapshotOptions{Processes: true})
+	if assert.True(t, sigar.IsPartial(err), "err=%v", err) {
+		partial := err.(sigar.ErrPartial)
+		assert.Len(t, partial.Errors, 2)
+		assert.Contains(t, partial.Errors, "swap")
+		assert.Contains(t, partial.Errors, "file_systems")
+	}
+
+	assert.False(t, snap.Time.IsZero())
+	assert.Equal(t, uint64(1024), snap.Mem.Total)
+	assert.Equal(t, 60.0, snap.Uptime.Length)
+	assert.Len(t, snap.Cpus.List, 2)
+	assert.Equal(t, map[string]sigar.FileSystemUsage{"/": {Total: 100}}, snap.FileSystems)
+	assert.Equal(t, []int{1, 42}, snap.Processes)
+	// not requested, GetNetConnections would panic
+	assert.Nil(t, snap.Connections)
+}
+
+func TestConcreteCollect(t *testing.T) {
+	snap, err := sigar.Collect(&sigar.ConcreteSigar{}, sigar.SnapshotOptions{Processes: true})
+	if err != nil && !sigar.IsPartial(err) {
+		t.Fatal(err)
+	}
+	assert.True(t, snap.Mem.Total > 0)
+	assert.NotEmpty(t, snap.Cpus.List)
+	assert.NotEmpty(t, snap.Processes)
+}
+
+func benchmarkProcList(b *testing.B) []int {
+	list := sigar.ProcList{}
+	if err := list.Get(); err != nil {
+		b.Fatal(err)
+	}
+	return list.List
+}
+
+func BenchmarkProcStateSerial(b *testing.B) {
+	pids := benchmarkProcList(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pid := range pids {
+			state := sigar.ProcState{}
+			state.Get(pid)
+		}
+	}
+}
+
+func BenchmarkGetProcStateBatch(b *testing.B) {
+	pids := benchmarkProcList(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sigar.GetProcStateBatch(pids)
+	}
+}
@@ -0,0 +1,178 @@
+package gosigar
+
+import "time"
+
+// DefaultSigar is the Sigar that the package-level functions, like GetMem,
+// read from. Tests can replace it with a fake, such as sigartest.FakeSigar.
+var DefaultSigar Sigar = &ConcreteSigar{}
+
+func CollectCpuStats(collectionInterval time.Duration) (<-chan Cpu, chan<- struct{}) {
+	return DefaultSigar.CollectCpuStats(collectionInterval)
+}
+
+func CollectCpuListStats(collectionInterval time.Duration) (<-chan CpuList, chan<- struct{}) {
+	return DefaultSigar.CollectCpuListStats(collectionInterval)
+}
+
+func GetCpuPercentage() (CpuPercent, error) {
+	return DefaultSigar.GetCpuPercentage()
+}
+
+func GetLoadAverage() (LoadAverage, error) {
+	return DefaultSigar.GetLoadAverage()
+}
+
+func GetLoadAveragePercent() (LoadAverage, error) {
+	return DefaultSigar.GetLoadAveragePercent()
+}
+
+func GetUptime() (Uptime, error) {
+	return DefaultSigar.GetUptime()
+}
+
+func GetMem() (Mem, error) {
+	return DefaultSigar.GetMem()
+}
+
+func GetSwap() (Swap, error) {
+	return DefaultSigar.GetSwap()
+}
+
+func GetCpuList() (CpuList, error) {
+	return DefaultSigar.GetCpuList()
+}
+
+func GetSwapDevices() ([]SwapDevice, error) {
+	return DefaultSigar.GetSwapDevices()
+}
+
+func GetCpuFreq(core int) (CpuFreq, error) {
+	return DefaultSigar.GetCpuFreq(core)
+}
+
+func GetCpuTopology() (CpuTopology, error) {
+	return DefaultSigar.GetCpuTopology()
+}
+
+func GetNumaNodes() ([]NumaNode, error) {
+	return DefaultSigar.GetNumaNodes()
+}
+
+func GetTemperatures() ([]Temperature, error) {
+	return DefaultSigar.GetTemperatures()
+}
+
+func GetFans() ([]Fan, error) {
+	return DefaultSigar.GetFans()
+}
+
+func GetBatteries() ([]Battery, error) {
+	return DefaultSigar.GetBatteries()
+}
+
+func GetHugeTLBPages() (HugeTLBPages, error) {
+	return DefaultSigar.GetHugeTLBPages()
+}
+
+func GetHugePages() ([]HugePages, error) {
+	return DefaultSigar.GetHugePages()
+}
+
+func GetFileSystemList() (FileSystemList, error) {
+	return DefaultSigar.GetFileSystemList()
+}
+
+func GetFileSystemUsage(path string) (FileSystemUsage, error) {
+	return DefaultSigar.GetFileSystemUsage(path)
+}
+
+func GetFileSystemUsageTimeout(path string, timeout time.Duration) (FileSystemUsage, error) {
+	return DefaultSigar.GetFileSystemUsageTimeout(path, timeout)
+}
+
+func GetFileSystemUsages(paths []string, timeout time.Duration) (map[string]FileSystemUsage, error) {
+	return DefaultSigar.GetFileSystemUsages(paths, timeout)
+}
+
+func GetFileSystemUsageByDevice(dev string) (FileSystemUsage, error) {
+	return DefaultSigar.GetFileSystemUsageByDevice(dev)
+}
+
+func GetDiskIoList() (DiskIoList, error) {
+	return DefaultSigar.GetDiskIoList()
+}
+
+func GetNetIfaceStats() ([]NetIfaceStat, error) {
+	return DefaultSigar.GetNetIfaceStats()
+}
+
+func GetNetProtoStats() (NetProtoStats, error) {
+	return DefaultSigar.GetNetProtoStats()
+}
+
+func GetNetConnections(flags NetConnFlags) ([]NetConnection, error) {
+	return DefaultSigar.GetNetConnections(flags)
+}
+
+func GetProcNetConnections(pid int) ([]NetConnection, error) {
+	return DefaultSigar.GetProcNetConnections(pid)
+}
+
+func GetProcList() ([]int, error) {
+	return DefaultSigar.GetProcList()
+}
+
+func GetProcListFiltered(f ProcFilter) ([]int, error) {
+	return DefaultSigar.GetProcListFiltered(f)
+}
+
+func GetProcArgs(pid int) ([]string, error) {
+	return DefaultSigar.GetProcArgs(pid)
+}
+
+func GetProcCwd(pid int) (string, error) {
+	return DefaultSigar.GetProcCwd(pid)
+}
+
+func GetProcRoot(pid int) (string, error) {
+	return DefaultSigar.GetProcRoot(pid)
+}
+
+func GetFDUsage() (FDUsage, error) {
+	return DefaultSigar.GetFDUsage()
+}
+
+func GetRusage(who int) (Rusage, error) {
+	return DefaultSigar.GetRusage(who)
+}
+
+// GetProcStateBatch reads the ProcState of many pids at once, see
+// ConcreteSigar.GetProcStateBatch.
+func GetProcStateBatch(pids []int) (map[int]ProcState, []error) {
+	return DefaultSigar.GetProcStateBatch(pids)
+}
+
+// NumCpu returns the number of online CPUs of the machine and the number
+// of CPUs it can have, including the offline and hotpluggable ones. Unlike
+// runtime.NumCPU, it does not depend on the CPU affinity of the process.
+func NumCpu() (online, possible int, err error) {
+	return DefaultSigar.NumCpu()
+}
+
+// GetPressure returns the pressure stall information of the CPU, memory
+// and I/O. It is only implemented on Linux 4.20 and later.
+func GetPressure() (cpu, mem, io PressureStall, err error) {
+	return DefaultSigar.GetPressure()
+}
+
+// DeviceName returns the path of the node of the block device major:minor,
+// like /dev/sda1 for 8:1.
+func DeviceName(major, minor int) (string, error) {
+	return DefaultSigar.DeviceName(major, minor)
+}
+
+// DeviceNumber returns the major and minor numbers of the device node at
+// path, see DeviceName for the reverse lookup.
+func DeviceNumber(path string) (major, minor int, err error) {
+	return DefaultSigar.DeviceNumber(path)
+}
@@ -1,3 +1,7 @@
+// Package fakes is kept for the users of its partial FakeSigar.
+//
+// Deprecated: use the FakeSigar of the sigartest package, it implements the
+// whole gosigar.Sigar interface.
 package fakes
 
 import (
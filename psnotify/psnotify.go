@@ -1,88 +1,349 @@
 package psnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrEventsDropped is sent on the Error channel, when the Watcher was created
+// with WatcherOptions.ReportDrops, after the kernel failed to queue events
+// for a slow reader. Consumers that track processes should resync, e.g. by
+// rescanning /proc.
+var ErrEventsDropped = errors.New("psnotify: kernel dropped events")
+
+// ProcEvent is implemented by every event type, see Watcher.Events().
+//
+// The Timestamp of the events is the time the kernel generated them on
+// Linux, converted from the monotonic clock with the boot time, the time
+// they were read on BSD and the time WMI generated them on Windows.
+type ProcEvent interface {
+	procEvent()
+}
+
 type ProcEventFork struct {
-	ParentPid int // Pid of the process that called fork()
-	ChildPid  int // Child process pid created by fork()
+	ParentPid int       // Pid of the process that called fork()
+	ChildPid  int       // Child process pid created by fork()
+	Timestamp time.Time // When the kernel reported the event
 }
 
+// ProcEventExec carries the executable and arguments of the new program
+// when the Watcher was created with WatcherOptions.ExecDetails, on Linux.
+// They are read from /proc after the fact and are left empty when the
+// process exited before.
 type ProcEventExec struct {
-	Pid int // Pid of the process that called exec()
+	Pid       int       // Pid of the process that called exec()
+	Filename  string    // Path of the new executable, if known
+	Args      []string  // Command line arguments, if known
+	Timestamp time.Time // When the kernel reported the event
 }
 
+// ProcEventExit reports the end of a process. On Darwin its ExitCode and
+// ExitSignal are only known for the children of the watching process, and
+// are 0 for the others.
 type ProcEventExit struct {
-	Pid int // Pid of the process that called exit()
+	Pid        int       // Pid of the process that called exit()
+	ExitCode   int       // Exit status, when not killed by a signal
+	ExitSignal int       // Signal that terminated the process, 0 for exit()
+	Timestamp  time.Time // When the kernel reported the event
 }
 
 type ProcEventSid struct {
-	Pid  int
-	Tgid int
+	Pid       int
+	Tgid      int
+	Timestamp time.Time // When the kernel reported the event
+}
+
+type ProcEventUID struct {
+	Pid       int       // Pid of the process that changed its uid
+	Ruid      uint32    // New real user id
+	Euid      uint32    // New effective user id
+	Timestamp time.Time // When the kernel reported the event
+}
+
+type ProcEventGID struct {
+	Pid       int       // Pid of the process that changed its gid
+	Rgid      uint32    // New real group id
+	Egid      uint32    // New effective group id
+	Timestamp time.Time // When the kernel reported the event
+}
+
+type ProcEventComm struct {
+	Pid       int       // Pid of the process that changed its command name
+	Comm      string    // New command name, as set by prctl(PR_SET_NAME)
+	Timestamp time.Time // When the kernel reported the event
+}
+
+// ProcEventPtrace is sent both when a tracer attaches to
+// and detaches from a process; on detach TracerPid is 0.
+type ProcEventPtrace struct {
+	Pid       int       // Pid of the traced process
+	TracerPid int       // Pid of the tracer, 0 when the tracer detached
+	Timestamp time.Time // When the kernel reported the event
+}
+
+// Detached reports whether the event signals a tracer detaching.
+func (e *ProcEventPtrace) Detached() bool {
+	return e.TracerPid == 0
+}
+
+type ProcEventCoredump struct {
+	Pid       int       // Pid of the process that dumped core
+	Timestamp time.Time // When the kernel reported the event
+}
+
+func (*ProcEventFork) procEvent()     {}
+func (*ProcEventExec) procEvent()     {}
+func (*ProcEventExit) procEvent()     {}
+func (*ProcEventSid) procEvent()      {}
+func (*ProcEventUID) procEvent()      {}
+func (*ProcEventGID) procEvent()      {}
+func (*ProcEventComm) procEvent()     {}
+func (*ProcEventPtrace) procEvent()   {}
+func (*ProcEventCoredump) procEvent() {}
+
+// Split a wait(2) style status into the exit status in the high
+// byte and the terminating signal in the low 7 bits
+func waitStatus(status uint32) (code, signal int) {
+	return int(status>>8) & 0xff, int(status & 0x7f)
 }
 
-type ProcEventUid struct {
-	IsGid bool
-	Pid   int // Pid of the process that called exit()
-	Tgid  int
-	Rid   int //rid or rgid
-	Eid   int //egit or euid
+// Indexes of the per event type counters of a Watcher
+const (
+	statFork = iota
+	statExec
+	statExit
+	statSid
+	statUid
+	statGid
+	statComm
+	statPtrace
+	statCoredump
+	numStats
+)
+
+// Counter index of the type of ev
+func eventType(ev ProcEvent) int {
+	switch ev.(type) {
+	case *ProcEventFork:
+		return statFork
+	case *ProcEventExec:
+		return statExec
+	case *ProcEventExit:
+		return statExit
+	case *ProcEventSid:
+		return statSid
+	case *ProcEventUID:
+		return statUid
+	case *ProcEventGID:
+		return statGid
+	case *ProcEventComm:
+		return statComm
+	case *ProcEventPtrace:
+		return statPtrace
+	default:
+		return statCoredump
+	}
+}
+
+// WatcherStats is a snapshot of the activity of a Watcher, see Stats().
+type WatcherStats struct {
+	Watches int    // Watched processes, including the followed descendants
+	Backlog int    // Events and errors sent but not received yet
+	Dropped uint64 // Same as Dropped()
+
+	// Errors discarded because nobody read the Error channel,
+	// with WatcherOptions.DropErrorsIfUnread
+	DroppedErrors uint64
+
+	// Events delivered to the channels, by type
+	Fork     uint64
+	Exec     uint64
+	Exit     uint64
+	Sid      uint64
+	Uid      uint64
+	Gid      uint64
+	Comm     uint64
+	Ptrace   uint64
+	Coredump uint64
 }
 
 type watch struct {
 	flags uint32 // Saved value of Watch() flags param
 }
 
+type nameWatch struct {
+	re    *regexp.Regexp // Compiled WatchName() pattern, anchored
+	flags uint32         // Saved value of WatchName() flags param
+}
+
 type eventListener interface {
 	close() error // Watch.Close() closes the OS specific listener
 }
 
 type Watcher struct {
-	listener     eventListener  // OS specifics (kqueue or netlink)
-	watches      map[int]*watch // Map of watched process ids
+	// Accessed atomically, first for 64-bit alignment
+	dropped       uint64
+	droppedErrors uint64           // Errors not sent on a full Error channel
+	delivered     [numStats]uint64 // Events delivered by type
+	numWatches    int64            // Length of watches
+
+	listener     eventListener         // OS specifics (kqueue or netlink)
+	watches      map[int]*watch        // Map of watched process ids
+	names        map[string]*nameWatch // Map of watched name patterns
+	trees        map[int]int           // Map of WatchTree() members to their root pid
+	ignored      map[int]bool          // Pids whose events are never reported
 	watchesMutex *sync.Mutex
 
-	Error chan error          // Errors are sent on this channel
-	Fork  chan *ProcEventFork // Fork events are sent on this channel
-	Exec  chan *ProcEventExec // Exec events are sent on this channel
-	Exit  chan *ProcEventExit // Exit events are sent on this channel
-	Sid   chan *ProcEventSid  // Exit events are sent on this channel
-	Uid   chan *ProcEventUid  // Exit events are sent on this channel
-	done  chan bool           // Used to stop the readEvents() goroutine
+	Error    chan error              // Errors are sent on this channel
+	Fork     chan *ProcEventFork     // Fork events are sent on this channel
+	Exec     chan *ProcEventExec     // Exec events are sent on this channel
+	Exit     chan *ProcEventExit     // Exit events are sent on this channel
+	Sid      chan *ProcEventSid      // Exit events are sent on this channel
+	Uid      chan *ProcEventUID      // Uid change events are sent on this channel
+	Gid      chan *ProcEventGID      // Gid change events are sent on this channel
+	Comm     chan *ProcEventComm     // Command name change events are sent on this channel
+	Ptrace   chan *ProcEventPtrace   // Ptrace attach/detach events are sent on this channel
+	Coredump chan *ProcEventCoredump // Coredump events are sent on this channel
+	events   chan ProcEvent          // All events, when WatcherOptions.Unified is set
+	done     chan bool               // Used to stop the readEvents() goroutine
+	closing  chan struct{}           // Closed by Close() to abandon pending sends
 
 	breakLoop   chan struct{}
+	reportDrops bool // Send ErrEventsDropped on the Error channel
+	execDetails bool // Resolve the executable of exec events
+	dropErrors  bool // Discard the errors instead of blocking on the Error channel
+	rebind      bool // Reopen the netlink socket after a receive error
 	isClosed    bool // Set to true when Close() is first called
 	closedMutex *sync.Mutex
 }
 
+// Capacity of the event channels allocated by NewWatcher
+const defaultBufferSize = 16
+
+// WatcherOptions configures a Watcher created by NewWatcherWithOptions.
+type WatcherOptions struct {
+	// Capacity of the event channels, see NewWatcherBuffered.
+	BufferSize int
+
+	// Deliver every event on the channel returned by Events(), in the
+	// order the kernel reported them, instead of the typed channels.
+	// Poll() reads from the same channel.
+	Unified bool
+
+	// Send ErrEventsDropped on the Error channel when events were lost.
+	ReportDrops bool
+
+	// Fill in ProcEventExec.Filename and Args, at the cost of reading
+	// /proc for every exec event.
+	ExecDetails bool
+
+	// Discard the errors that do not fit in the Error channel, counting
+	// them in Stats(), instead of blocking the read loop until they are
+	// received. Callers that never read the Error channel need it to keep
+	// receiving events.
+	DropErrorsIfUnread bool
+
+	// Reopen and resubscribe the netlink socket after an error receiving
+	// from it, the error is still reported. Events sent in the meantime
+	// are lost. It is only supported on Linux.
+	Rebind bool
+}
+
 // Initialize event listener and channels
 func NewWatcher() (*Watcher, error) {
+	return NewWatcherBuffered(defaultBufferSize)
+}
+
+// NewWatcherBuffered is like NewWatcher but allocates every event channel
+// with a buffer of the given size.
+//
+// The read loop blocks whenever it delivers to a full channel, and while it
+// is blocked the kernel keeps queueing (and eventually dropping) events.
+// A larger buffer absorbs bursts such as fork storms when consumers are slow,
+// at the cost of memory and of events being observed later. A size of 0
+// gives unbuffered channels.
+func NewWatcherBuffered(size int) (*Watcher, error) {
+	return NewWatcherWithOptions(context.Background(), WatcherOptions{BufferSize: size})
+}
+
+// NewWatcherContext is like NewWatcher but ties the lifetime of the
+// Watcher to ctx: once ctx is cancelled the Watcher is closed as if
+// Close() had been called. Calling Close() before or after the
+// cancellation is safe.
+func NewWatcherContext(ctx context.Context) (*Watcher, error) {
+	return NewWatcherWithOptions(ctx, WatcherOptions{BufferSize: defaultBufferSize})
+}
+
+// NewWatcherWithOptions creates a Watcher configured by opts and closed
+// when ctx is cancelled, see NewWatcherContext.
+func NewWatcherWithOptions(ctx context.Context, opts WatcherOptions) (*Watcher, error) {
 	listener, err := createListener()
 
 	if err != nil {
 		return nil, err
 	}
 
-	w := &Watcher{
+	w := newWatcher(listener, opts.BufferSize)
+	if opts.Unified {
+		w.events = make(chan ProcEvent, opts.BufferSize)
+	}
+	w.reportDrops = opts.ReportDrops
+	w.execDetails = opts.ExecDetails
+	w.dropErrors = opts.DropErrorsIfUnread
+	w.rebind = opts.Rebind
+
+	go w.readEvents()
+
+	if ctx.Done() != nil {
+		go w.closeOnCancel(ctx)
+	}
+	return w, nil
+}
+
+// Close the Watcher when ctx is cancelled, returns as soon
+// as the readEvents() loop has stopped for any other reason.
+func (w *Watcher) closeOnCancel(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		w.Close()
+	case <-w.breakLoop:
+	}
+}
+
+// Allocate a Watcher around listener without starting the read loop
+func newWatcher(listener eventListener, size int) *Watcher {
+	if size < 0 {
+		size = 0
+	}
+
+	return &Watcher{
 		listener:     listener,
 		watches:      make(map[int]*watch),
+		names:        make(map[string]*nameWatch),
+		trees:        make(map[int]int),
+		ignored:      make(map[int]bool),
 		watchesMutex: &sync.Mutex{},
-		Fork:         make(chan *ProcEventFork),
-		Exec:         make(chan *ProcEventExec),
-		Exit:         make(chan *ProcEventExit),
-		Sid:          make(chan *ProcEventSid),
-		Uid:          make(chan *ProcEventUid),
-		Error:        make(chan error),
+		Fork:         make(chan *ProcEventFork, size),
+		Exec:         make(chan *ProcEventExec, size),
+		Exit:         make(chan *ProcEventExit, size),
+		Sid:          make(chan *ProcEventSid, size),
+		Uid:          make(chan *ProcEventUID, size),
+		Gid:          make(chan *ProcEventGID, size),
+		Comm:         make(chan *ProcEventComm, size),
+		Ptrace:       make(chan *ProcEventPtrace, size),
+		Coredump:     make(chan *ProcEventCoredump, size),
+		Error:        make(chan error, size),
 		done:         make(chan bool, 1),
+		closing:      make(chan struct{}),
 		breakLoop:    make(chan struct{}),
 		closedMutex:  &sync.Mutex{},
 	}
-
-	go w.readEvents()
-	return w, nil
 }
 
 // Close event channels when done message is received
@@ -93,26 +354,194 @@ func (w *Watcher) finish() {
 	close(w.Error)
 	close(w.Sid)
 	close(w.Uid)
+	close(w.Gid)
+	close(w.Comm)
+	close(w.Ptrace)
+	close(w.Coredump)
+	if w.events != nil {
+		close(w.events)
+	}
+}
+
+// Events returns the channel every event is sent on when the Watcher was
+// created with WatcherOptions.Unified, in which case the typed channels
+// only get closed. It returns nil otherwise.
+func (w *Watcher) Events() <-chan ProcEvent {
+	return w.events
+}
+
+// Poll returns the next event, waiting up to timeout for it, or the next
+// error of the Error channel, for consumers reading events from a single
+// loop. It returns ok=false when no event came in time, a timeout of 0 or
+// less does not wait at all. It requires a Watcher created with
+// WatcherOptions.Unified, whose events are only delivered once, either by
+// Poll() or by the Events() channel.
+func (w *Watcher) Poll(timeout time.Duration) (ProcEvent, bool, error) {
+	if w.events == nil {
+		return nil, false, errors.New("psnotify: Poll requires WatcherOptions.Unified")
+	}
+
+	if timeout <= 0 {
+		select {
+		case ev, ok := <-w.events:
+			return polled(ev, nil, ok)
+		case err, ok := <-w.Error:
+			return polled(nil, err, ok)
+		default:
+			return nil, false, nil
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case ev, ok := <-w.events:
+		return polled(ev, nil, ok)
+	case err, ok := <-w.Error:
+		return polled(nil, err, ok)
+	case <-timer.C:
+		return nil, false, nil
+	}
+}
+
+// Result of Poll() for a receive on the events or the Error channel,
+// open is false once Close() closed them
+func polled(ev ProcEvent, err error, open bool) (ProcEvent, bool, error) {
+	if !open {
+		return nil, false, errors.New("psnotify watcher is closed")
+	}
+	return ev, ev != nil, err
+}
+
+// Deliver ev on the unified or the typed channel, gives up when
+// the Watcher is closed while the channel is full.
+func (w *Watcher) emit(ev ProcEvent) {
+	if w.deliver(ev) {
+		atomic.AddUint64(&w.delivered[eventType(ev)], 1)
+	}
+}
+
+// Send ev to its channel, false when the Watcher was closed first
+func (w *Watcher) deliver(ev ProcEvent) bool {
+	if w.events != nil {
+		select {
+		case w.events <- ev:
+			return true
+		case <-w.closing:
+			return false
+		}
+	}
+
+	switch ev := ev.(type) {
+	case *ProcEventFork:
+		select {
+		case w.Fork <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventExec:
+		select {
+		case w.Exec <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventExit:
+		select {
+		case w.Exit <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventSid:
+		select {
+		case w.Sid <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventUID:
+		select {
+		case w.Uid <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventGID:
+		select {
+		case w.Gid <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventComm:
+		select {
+		case w.Comm <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventPtrace:
+		select {
+		case w.Ptrace <- ev:
+			return true
+		case <-w.closing:
+		}
+	case *ProcEventCoredump:
+		select {
+		case w.Coredump <- ev:
+			return true
+		case <-w.closing:
+		}
+	}
+	return false
+}
+
+// Deliver err on the Error channel, like emit(), with DropErrorsIfUnread
+// it is discarded when the channel is full.
+func (w *Watcher) sendError(err error) {
+	if w.dropErrors {
+		select {
+		case w.Error <- err:
+		default:
+			atomic.AddUint64(&w.droppedErrors, 1)
+		}
+		return
+	}
+
+	select {
+	case w.Error <- err:
+	case <-w.closing:
+	}
 }
 
 // Closes the OS specific event listener,
 // removes all watches and closes all event channels.
 func (w *Watcher) Close() error {
+	// the lock is not held while waiting for readEvents(),
+	// which calls Watch() and RemoveWatch() when following forks
 	w.closedMutex.Lock()
-	defer w.closedMutex.Unlock()
+	closed := w.isClosed
+	w.isClosed = true
+	w.closedMutex.Unlock()
 
-	if w.isClosed {
+	if closed {
 		return nil
 	}
-	w.isClosed = true
 
 	w.watchesMutex.Lock()
 	for pid := range w.watches {
 		delete(w.watches, pid)
 		w.unregister(pid)
 	}
+	w.watchesChanged()
+	for pattern := range w.names {
+		delete(w.names, pattern)
+	}
+	for pid := range w.trees {
+		delete(w.trees, pid)
+	}
 	w.watchesMutex.Unlock()
 
+	// unblock a readEvents loop waiting on a full channel, events
+	// read from now on are dropped instead of sent
+	close(w.closing)
+
 	// notify done signal to readEvents loop routine
 	w.done <- true
 
@@ -122,9 +551,75 @@ func (w *Watcher) Close() error {
 	return nil
 }
 
+// Dropped returns how many times the kernel reported that it lost events
+// because they were not read fast enough. The number of lost events is
+// not known; only the netlink connector on Linux reports losses.
+func (w *Watcher) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Record that the kernel lost events
+func (w *Watcher) drop() {
+	atomic.AddUint64(&w.dropped, 1)
+	if w.reportDrops {
+		w.sendError(ErrEventsDropped)
+	}
+}
+
+// Stats returns the number of watches, the events delivered so far and
+// the backlog of the channels. The counters are read without locking, so
+// calling it does not slow the read loop down. A growing Backlog means the
+// consumers do not keep up with the events.
+func (w *Watcher) Stats() WatcherStats {
+	stats := WatcherStats{
+		Watches:  int(atomic.LoadInt64(&w.numWatches)),
+		Dropped:  atomic.LoadUint64(&w.dropped),
+		Fork:     atomic.LoadUint64(&w.delivered[statFork]),
+		Exec:     atomic.LoadUint64(&w.delivered[statExec]),
+		Exit:     atomic.LoadUint64(&w.delivered[statExit]),
+		Sid:      atomic.LoadUint64(&w.delivered[statSid]),
+		Uid:      atomic.LoadUint64(&w.delivered[statUid]),
+		Gid:      atomic.LoadUint64(&w.delivered[statGid]),
+		Comm:     atomic.LoadUint64(&w.delivered[statComm]),
+		Ptrace:   atomic.LoadUint64(&w.delivered[statPtrace]),
+		Coredump: atomic.LoadUint64(&w.delivered[statCoredump]),
+
+		DroppedErrors: atomic.LoadUint64(&w.droppedErrors),
+	}
+
+	// the length of a channel is approximate while it is in use
+	stats.Backlog = len(w.Fork) + len(w.Exec) + len(w.Exit) + len(w.Sid) +
+		len(w.Uid) + len(w.Gid) + len(w.Comm) + len(w.Ptrace) +
+		len(w.Coredump) + len(w.Error)
+	if w.events != nil {
+		stats.Backlog += len(w.events)
+	}
+	return stats
+}
+
+// Publish the number of watches for Stats(), watchesMutex must be held
+func (w *Watcher) watchesChanged() {
+	atomic.StoreInt64(&w.numWatches, int64(len(w.watches)))
+}
+
+// SetBufferSize sets the size in bytes of the kernel buffer queueing events
+// until they are read, a larger buffer reduces drops during bursts. It is
+// only supported on Linux, where exceeding net.core.rmem_max requires
+// CAP_NET_ADMIN.
+func (w *Watcher) SetBufferSize(size int) error {
+	w.closedMutex.Lock()
+	defer w.closedMutex.Unlock()
+
+	if w.isClosed {
+		return errors.New("psnotify watcher is closed")
+	}
+	return w.setBufferSize(size)
+}
+
 // Add pid to the watched process set.
 // The flags param is a bitmask of process events to capture,
 // must be one or more of: PROC_EVENT_FORK, PROC_EVENT_EXEC, PROC_EVENT_EXIT
+// Add PROC_EVENT_FOLLOW to watch the descendants of pid with the same flags.
 func (w *Watcher) Watch(pid int, flags uint32) error {
 	w.closedMutex.Lock()
 	closed := w.isClosed
@@ -134,37 +629,336 @@ func (w *Watcher) Watch(pid int, flags uint32) error {
 		return errors.New("psnotify watcher is closed")
 	}
 
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
 	watchEntry, found := w.watches[pid]
 
 	if found {
+		// update the OS specific filter with the combined flags
+		if err := w.register(pid, watchEntry.flags|flags); err != nil {
+			return err
+		}
 		watchEntry.flags |= flags
 	} else {
 		if err := w.register(pid, flags); err != nil {
 			return err
 		}
 
-		w.watchesMutex.Lock()
 		w.watches[pid] = &watch{flags: flags}
-		w.watchesMutex.Unlock()
+		w.watchesChanged()
+	}
+
+	return nil
+}
+
+// WatchTree watches pid and every process it spawns from now on, down to
+// any depth, with flags and PROC_EVENT_FOLLOW. The descendants outliving
+// pid stay watched until they exit, RemoveWatch(pid) stops watching the
+// whole subtree. Like PROC_EVENT_FOLLOW, it is not supported on Darwin.
+func (w *Watcher) WatchTree(pid int, flags uint32) error {
+	if err := w.Watch(pid, flags|PROC_EVENT_FOLLOW); err != nil {
+		return err
+	}
+
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	w.trees[pid] = pid
+	return nil
+}
+
+// WatchAll watches every process with flags: the -1 wildcard catches
+// the processes started from now on, and the processes already running
+// are watched by pid, so that their exit is reported even when they never
+// fork or exec again, and after RemoveWatch(-1). Processes exiting while
+// they are listed are skipped. On Windows the wildcard covers both. It is
+// not supported on the BSDs, where kqueue has no wildcard.
+func (w *Watcher) WatchAll(flags uint32) error {
+	_, watched := w.watchFlags(-1)
+
+	// the wildcard is registered before the processes are listed, so that
+	// the ones started in between are caught by either
+	if err := w.Watch(-1, flags); err != nil {
+		return err
+	}
+
+	pids, err := existingPids()
+	if err != nil {
+		if !watched {
+			w.RemoveWatch(-1)
+		}
+		return err
 	}
 
+	for _, pid := range pids {
+		// the process may be gone already
+		w.Watch(pid, flags)
+	}
 	return nil
 }
 
-// Remove pid from the watched process set.
+// Remove pid from the watched process set, along with
+// its descendants when it was watched with WatchTree().
 func (w *Watcher) RemoveWatch(pid int) error {
 	w.watchesMutex.Lock()
 	defer w.watchesMutex.Unlock()
 
+	if root, ok := w.trees[pid]; ok && root == pid {
+		for member, root := range w.trees {
+			if root != pid {
+				continue
+			}
+			delete(w.trees, member)
+			if _, ok := w.watches[member]; ok {
+				delete(w.watches, member)
+				w.unregister(member)
+			}
+		}
+		w.watchesChanged()
+		return nil
+	}
+
 	_, ok := w.watches[pid]
 	if !ok {
 		msg := fmt.Sprintf("watch for pid=%d does not exist", pid)
 		return errors.New(msg)
 	}
 	delete(w.watches, pid)
+	delete(w.trees, pid)
+	w.watchesChanged()
 	return w.unregister(pid)
 }
 
+// Ignore suppresses the events of pids, even when they are watched by pid
+// or with the -1 wildcard, e.g. to keep a system wide watcher from seeing
+// its own activity. The watches of pids are removed and the forks of an
+// ignored process are not followed, its children are only reported
+// through the wildcard. A pid is ignored until the process exits, so that
+// an unrelated process reusing it is reported, or until Unignore(). The
+// pids of processes that do not exist are not ignored, and nothing is
+// once the watcher is closed.
+func (w *Watcher) Ignore(pids ...int) {
+	w.closedMutex.Lock()
+	closed := w.isClosed
+	w.closedMutex.Unlock()
+
+	if closed {
+		return
+	}
+
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	for _, pid := range pids {
+		if _, ok := w.watches[pid]; ok {
+			delete(w.watches, pid)
+			w.watchesChanged()
+		}
+		// only the exit is left in the OS specific filter,
+		// e.g. the kqueue filter of pid is replaced
+		if !processExists(pid) || w.register(pid, PROC_EVENT_EXIT) != nil {
+			w.unregister(pid)
+			continue
+		}
+		w.ignored[pid] = true
+	}
+}
+
+// Unignore reports the events of pids again. Their watches removed by
+// Ignore() are not restored, the -1 wildcard covers them right away.
+func (w *Watcher) Unignore(pids ...int) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	for _, pid := range pids {
+		if !w.ignored[pid] {
+			continue
+		}
+		delete(w.ignored, pid)
+		if _, ok := w.watches[pid]; !ok {
+			w.unregister(pid)
+		}
+	}
+}
+
+// Internal helper to check if pid is ignored
+func (w *Watcher) isIgnored(pid int) bool {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	return w.ignored[pid]
+}
+
+// Add pid to the WatchTree() subtree of its parent ppid, if any
+func (w *Watcher) addChild(ppid, pid int) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if root, ok := w.trees[ppid]; ok {
+		w.trees[pid] = root
+	}
+}
+
+// Forget the watch or the ignore of a process that exited, true when its
+// exit is to be reported.
+func (w *Watcher) handleExit(pid int) bool {
+	report := w.isWatching(pid, PROC_EVENT_EXIT)
+	if report || w.isIgnored(pid) {
+		w.removeExited(pid)
+	}
+	return report
+}
+
+// Remove the watch of a process that exited, or its ignore since the pid
+// can be reused. The root of a WatchTree()
+// subtree is forgotten once its last descendant exited too, until then
+// RemoveWatch(root) still removes the remaining descendants.
+func (w *Watcher) removeExited(pid int) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if _, ok := w.watches[pid]; ok {
+		delete(w.watches, pid)
+		w.unregister(pid)
+		w.watchesChanged()
+	} else if w.ignored[pid] {
+		w.unregister(pid)
+	}
+	delete(w.ignored, pid)
+
+	root, ok := w.trees[pid]
+	if !ok {
+		return
+	}
+	if root != pid {
+		delete(w.trees, pid)
+	}
+	if _, alive := w.watches[root]; alive {
+		return
+	}
+	for member, r := range w.trees {
+		if r == root && member != root {
+			return
+		}
+	}
+	delete(w.trees, root)
+}
+
+// WatchName watches the processes that exec a program whose name matches
+// pattern, a regular expression matched against the whole command name and
+// the whole base name of the executable, e.g. "sshd" or "python[23]?".
+// Every matching process is added to the watched process set with flags,
+// as if passed to Watch(), and its exec event is sent when flags contain
+// PROC_EVENT_EXEC.
+//
+// The names are not part of the kernel events: while a name is watched,
+// /proc/<pid>/comm and /proc/<pid>/exe are read for every exec on the
+// system, and processes that exit before are missed. It is only supported
+// on Linux.
+func (w *Watcher) WatchName(pattern string, flags uint32) error {
+	w.closedMutex.Lock()
+	closed := w.isClosed
+	w.closedMutex.Unlock()
+
+	if closed {
+		return errors.New("psnotify watcher is closed")
+	}
+	if err := w.canWatchNames(); err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return err
+	}
+
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if watchEntry, found := w.names[pattern]; found {
+		watchEntry.flags |= flags
+	} else {
+		w.names[pattern] = &nameWatch{re: re, flags: flags}
+	}
+	return nil
+}
+
+// RemoveWatchName removes pattern from the watched name patterns. The
+// processes that matched it stay watched until they exit or are removed
+// with RemoveWatch().
+func (w *Watcher) RemoveWatchName(pattern string) error {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if _, ok := w.names[pattern]; !ok {
+		return fmt.Errorf("watch for name=%q does not exist", pattern)
+	}
+	delete(w.names, pattern)
+	return nil
+}
+
+// Internal helper to check if any name pattern is watched
+func (w *Watcher) isWatchingNames() bool {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	return len(w.names) > 0
+}
+
+// Combined flags of the name patterns matching comm or
+// the base name of exe, false when none matches
+func (w *Watcher) matchName(comm, exe string) (uint32, bool) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	var flags uint32
+	matched := false
+	for _, watch := range w.names {
+		if (comm != "" && watch.re.MatchString(comm)) ||
+			(exe != "" && watch.re.MatchString(filepath.Base(exe))) {
+			flags |= watch.flags
+			matched = true
+		}
+	}
+	return flags, matched
+}
+
+// Internal helper to check if pid && event is being watched
+func (w *Watcher) isWatching(pid int, event uint32) bool {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if w.ignored[pid] {
+		return false
+	}
+	if watch, ok := w.watches[pid]; ok {
+		return (watch.flags & event) == event
+	}
+	//for any process
+	if watch, ok := w.watches[-1]; ok {
+		return (watch.flags & event) == event
+	}
+	return false
+}
+
+// Saved Watch() flags for pid, falling back to the any process watch
+func (w *Watcher) watchFlags(pid int) (uint32, bool) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if w.ignored[pid] {
+		return 0, false
+	}
+	if watch, ok := w.watches[pid]; ok {
+		return watch.flags, true
+	}
+	if watch, ok := w.watches[-1]; ok {
+		return watch.flags, true
+	}
+	return 0, false
+}
+
 // Internal helper to check if there is a message on the "done" channel.
 // The "done" message is sent by the Close() method; when received here,
 // the Watcher.finish method is called to close all channels and return
@@ -4,7 +4,10 @@
 package psnotify
 
 import (
+	"fmt"
+	"runtime"
 	"syscall"
+	"time"
 )
 
 const (
@@ -13,10 +16,30 @@ const (
 	PROC_EVENT_EXEC = syscall.NOTE_EXEC // exec() events
 	PROC_EVENT_EXIT = syscall.NOTE_EXIT // exit() events
 
+	// Watch the children of a process with the same flags,
+	// not a kqueue note, the bit is cleared before kevent()
+	PROC_EVENT_FOLLOW = 0x01000000
+
 	// Watch for all process events
-	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT
+	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT |
+		PROC_EVENT_FOLLOW
 )
 
+// How long a Kevent() poll waits before readEvents()
+// checks again whether the Watcher has been closed.
+const readTimeout = 250 * time.Millisecond
+
+// Forks are followed with NOTE_TRACK, which Darwin does
+// not support (the filter is rejected with ENOTSUP).
+var canTrack = runtime.GOOS != "darwin"
+
+// Darwin only puts the wait status in the data of NOTE_EXIT with
+// NOTE_EXITSTATUS (from <sys/event.h>), which it rejects with EACCES
+// unless the caller is the parent of the process.
+const _NOTE_EXITSTATUS = 0x04000000
+
+var needsExitStatus = runtime.GOOS == "darwin"
+
 type kqueueListener struct {
 	kq  int                 // The syscall.Kqueue() file descriptor
 	buf [1]syscall.Kevent_t // An event buffer for Add/Remove watch
@@ -50,39 +73,122 @@ func (w *Watcher) unregister(pid int) error {
 
 // Add and enable filter for given pid in the queue
 func (w *Watcher) register(pid int, flags uint32) error {
-	return w.kevent(pid, flags, syscall.EV_ADD|syscall.EV_ENABLE)
+	fflags := flags &^ PROC_EVENT_FOLLOW
+	if follows(flags) {
+		fflags |= syscall.NOTE_TRACK
+	}
+	if needsExitStatus && flags&PROC_EVENT_EXIT != 0 {
+		err := w.kevent(pid, fflags|_NOTE_EXITSTATUS, syscall.EV_ADD|syscall.EV_ENABLE)
+		if err != syscall.EACCES {
+			return err
+		}
+		// not a child, the exits are reported without their status
+	}
+	return w.kevent(pid, fflags, syscall.EV_ADD|syscall.EV_ENABLE)
+}
+
+// Forks of a process watched with PROC_EVENT_FOLLOW are tracked:
+// the kernel attaches the same filter to every child and reports
+// it with NOTE_CHILD.
+func follows(flags uint32) bool {
+	return canTrack && flags&PROC_EVENT_FOLLOW != 0
+}
+
+// Record the watch the kernel attached to a child of a tracked parent
+func (w *Watcher) trackChild(ppid, pid int) {
+	w.watchesMutex.Lock()
+	defer w.watchesMutex.Unlock()
+
+	if w.ignored[ppid] {
+		// the kernel tracks the children of ignored processes too
+		w.unregister(pid)
+		return
+	}
+	if parent, ok := w.watches[ppid]; ok {
+		w.watches[pid] = &watch{flags: parent.flags}
+		w.watchesChanged()
+	}
+	if root, ok := w.trees[ppid]; ok {
+		w.trees[pid] = root
+	}
+}
+
+// The kqueue listener has no receive buffer to resize
+func (w *Watcher) setBufferSize(size int) error {
+	return fmt.Errorf("psnotify: SetBufferSize is not supported on %s", runtime.GOOS)
+}
+
+// Only the processes registered with kqueue report events
+func (w *Watcher) canWatchNames() error {
+	return fmt.Errorf("psnotify: WatchName is not supported on %s", runtime.GOOS)
+}
+
+// kqueue refuses the filter of a pid that is not running with
+// ESRCH, which fails the register() of Ignore() on its own.
+func processExists(pid int) bool {
+	return true
+}
+
+// kqueue has no wildcard pid to catch the new processes
+func existingPids() ([]int, error) {
+	return nil, fmt.Errorf("psnotify: WatchAll is not supported on %s", runtime.GOOS)
 }
 
 // Poll the kqueue file descriptor and dispatch to the Event channels
 func (w *Watcher) readEvents() {
 	listener, _ := w.listener.(*kqueueListener)
 	events := make([]syscall.Kevent_t, 10)
+	timeout := syscall.NsecToTimespec(readTimeout.Nanoseconds())
 
 	for {
 		if w.isDone() {
-			return
+			break
 		}
 
-		n, err := syscall.Kevent(listener.kq, nil, events, nil)
+		n, err := syscall.Kevent(listener.kq, nil, events, &timeout)
+		if err == syscall.EINTR {
+			continue
+		}
 		if err != nil {
-			w.Error <- err
+			w.sendError(err)
 			continue
 		}
 
+		now := time.Now()
 		for _, ev := range events[:n] {
 			pid := int(ev.Ident)
 
-			switch ev.Fflags {
-			case syscall.NOTE_FORK:
-				w.Fork <- &ProcEventFork{ParentPid: pid}
-			case syscall.NOTE_EXEC:
-				w.Exec <- &ProcEventExec{Pid: pid}
-			case syscall.NOTE_EXIT:
-				w.RemoveWatch(pid)
-				w.Exit <- &ProcEventExit{Pid: pid}
+			// several notes can be coalesced into a single event
+			if ev.Fflags&syscall.NOTE_CHILD != 0 {
+				ppid := int(ev.Data)
+				w.trackChild(ppid, pid)
+
+				if w.isWatching(ppid, PROC_EVENT_FORK) {
+					w.emit(&ProcEventFork{ParentPid: ppid, ChildPid: pid, Timestamp: now})
+				}
+			}
+			if ev.Fflags&syscall.NOTE_TRACKERR != 0 {
+				w.sendError(fmt.Errorf("failed to follow fork of pid %d", pid))
+			}
+			if ev.Fflags&syscall.NOTE_FORK != 0 && w.isWatching(pid, PROC_EVENT_FORK) &&
+				!w.isWatching(pid, PROC_EVENT_FOLLOW) {
+				// tracked forks are reported by the NOTE_CHILD
+				// event of the child, which carries its pid
+				w.emit(&ProcEventFork{ParentPid: pid, Timestamp: now})
+			}
+			if ev.Fflags&syscall.NOTE_EXEC != 0 && w.isWatching(pid, PROC_EVENT_EXEC) {
+				w.emit(&ProcEventExec{Pid: pid, Timestamp: now})
+			}
+			if ev.Fflags&syscall.NOTE_EXIT != 0 && w.handleExit(pid) {
+				// the data of NOTE_EXIT is the wait status, darwin
+				// leaves it 0 for the processes registered without
+				// NOTE_EXITSTATUS
+				code, signal := waitStatus(uint32(ev.Data))
+				w.emit(&ProcEventExit{Pid: pid, ExitCode: code, ExitSignal: signal, Timestamp: now})
 			}
 		}
 	}
+	close(w.breakLoop)
 }
 
 // Close our kqueue file descriptor; deletes any remaining filters
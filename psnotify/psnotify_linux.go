@@ -5,8 +5,17 @@ package psnotify
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/chennqqi/gosigar/sys"
 )
@@ -20,27 +29,51 @@ const (
 	_PROC_CN_MCAST_LISTEN = 1
 	_PROC_CN_MCAST_IGNORE = 2
 
+	// internal flags (from <linux/time.h>)
+	_CLOCK_MONOTONIC = 1
+
+	// internal flags (from <linux/cn_proc.h>)
+	_PROC_EVENT_NONE = 0x00000000 // acknowledgement of a control message
+
 	// Flags (from <linux/cn_proc.h>)
-	PROC_EVENT_FORK = 0x00000001 // fork() events
-	PROC_EVENT_EXEC = 0x00000002 // exec() events
-	PROC_EVENT_EXIT = 0x80000000 // exit() events
-
-	PROC_EVENT_UID    = 0x00000004
-	PROC_EVENT_GID    = 0x00000040
-	PROC_EVENT_SID    = 0x00000080
-	PROC_EVENT_PTRACE = 0x00000100
-	PROC_EVENT_COMM   = 0x00000200
-	/* "next" should be 0x00000400 */
-	/* "last" is the last process event: exit,
-	 * while "next to last" is coredumping event */
-	PROC_EVENT_COREDUMP = 0x40000000
+	PROC_EVENT_FORK     = 0x00000001 // fork() events
+	PROC_EVENT_EXEC     = 0x00000002 // exec() events
+	PROC_EVENT_UID      = 0x00000004 // setuid() events
+	PROC_EVENT_GID      = 0x00000040 // setgid() events
+	PROC_EVENT_SID      = 0x00000080 // setsid() events
+	PROC_EVENT_PTRACE   = 0x00000100 // ptrace() attach and detach events
+	PROC_EVENT_COMM     = 0x00000200 // prctl(PR_SET_NAME) events
+	PROC_EVENT_COREDUMP = 0x40000000 // core dump events
+	PROC_EVENT_EXIT     = 0x80000000 // exit() events
+
+	// Watch the children of a process with the same flags,
+	// not a kernel event, the bit is unused by <linux/cn_proc.h>
+	PROC_EVENT_FOLLOW = 0x01000000
 
 	// Watch for all process events
-	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT | PROC_EVENT_GID | PROC_EVENT_SID | PROC_EVENT_UID
+	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_UID |
+		PROC_EVENT_GID | PROC_EVENT_SID | PROC_EVENT_PTRACE |
+		PROC_EVENT_COMM | PROC_EVENT_COREDUMP | PROC_EVENT_EXIT |
+		PROC_EVENT_FOLLOW
 )
 
+// How long a blocking read on the netlink socket waits before
+// readEvents() checks again whether the Watcher has been closed.
+const readTimeout = 250 * time.Millisecond
+
+// How long bind() waits for the connector driver to acknowledge
+// the listen control message.
+const ackTimeout = time.Second
+
 var (
 	byteOrder = sys.GetEndian()
+
+	// Mount point of procfs, for the exec event details
+	procd = "/proc"
+
+	// Wall clock time of the boot, see getBootTime()
+	bootTime     time.Time
+	bootTimeOnce sync.Once
 )
 
 // linux/connector.h: struct cb_id
@@ -65,6 +98,11 @@ type procEventHeader struct {
 	Timestamp uint64
 }
 
+// linux/cn_proc.h: struct proc_event.ack
+type ackProcEvent struct {
+	Err uint32
+}
+
 // linux/cn_proc.h: struct proc_event.fork
 type forkProcEvent struct {
 	ParentPid  uint32
@@ -122,6 +160,66 @@ type sidProcEvent struct {
 	ProcessTgid uint32
 }
 
+// linux/cn_proc.h: struct proc_event.ptrace
+type ptraceProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	TracerPid   uint32 // 0 on PTRACE_DETACH
+	TracerTgid  uint32
+}
+
+// linux/cn_proc.h: struct proc_event.comm
+type commProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	Comm        [16]byte // TASK_COMM_LEN, NUL padded
+}
+
+// linux/cn_proc.h: struct proc_event.coredump
+type coredumpProcEvent struct {
+	ProcessPid  uint32
+	ProcessTgid uint32
+	ParentPid   uint32
+	ParentTgid  uint32
+}
+
+// Sizes of the headers preceding the proc_event union in a message
+const (
+	sizeofCnMsg           = 20 // struct cn_msg without its data
+	sizeofProcEventHeader = 16
+)
+
+// Decode the connector and proc_event headers at the start of data,
+// false when it is too short. The fields are read at their offsets
+// rather than with binary.Read, which is slow for so many messages.
+func decodeHeaders(data []byte, msg *cnMsg, hdr *procEventHeader) bool {
+	if len(data) < sizeofCnMsg+sizeofProcEventHeader {
+		return false
+	}
+	msg.Id.Idx = byteOrder.Uint32(data[0:])
+	msg.Id.Val = byteOrder.Uint32(data[4:])
+	msg.Seq = byteOrder.Uint32(data[8:])
+	msg.Ack = byteOrder.Uint32(data[12:])
+	msg.Len = byteOrder.Uint16(data[16:])
+	msg.Flags = byteOrder.Uint16(data[18:])
+	hdr.What = byteOrder.Uint32(data[20:])
+	hdr.Cpu = byteOrder.Uint32(data[24:])
+	hdr.Timestamp = byteOrder.Uint64(data[28:])
+	return true
+}
+
+// Decode the consecutive 32 bit fields of an event, false when data is
+// too short
+func decodeUint32s(data []byte, fields ...*uint32) bool {
+	if len(data) < 4*len(fields) {
+		return false
+	}
+	for i, field := range fields {
+		*field = byteOrder.Uint32(data[4*i:])
+	}
+	return true
+}
+
 // standard netlink header + connector header
 type netlinkProcMessage struct {
 	Header syscall.NlMsghdr
@@ -129,16 +227,26 @@ type netlinkProcMessage struct {
 }
 
 type netlinkListener struct {
-	addr *syscall.SockaddrNetlink // Netlink socket address
-	sock int                      // The syscall.Socket() file descriptor
-	seq  uint32                   // struct cn_msg.seq
+	addr   *syscall.SockaddrNetlink // Netlink socket address
+	sock   int                      // The syscall.Socket() file descriptor
+	seq    uint32                   // struct cn_msg.seq
+	rcvbuf int                      // SetBufferSize() size, restored by rebind()
+
+	// Held by rebind() while it replaces sock and by SetBufferSize(), the
+	// read loop owns sock and reads it without the lock.
+	sockMutex sync.Mutex
 }
 
 // Initialize linux implementation of the eventListener interface
 func createListener() (eventListener, error) {
-	listener := &netlinkListener{}
-	err := listener.bind()
-	return listener, err
+	listener := &netlinkListener{sock: -1}
+	if err := listener.bind(); err != nil {
+		if listener.sock != -1 {
+			syscall.Close(listener.sock)
+		}
+		return nil, err
+	}
+	return listener, nil
 }
 
 // noop on linux
@@ -151,6 +259,30 @@ func (w *Watcher) register(pid int, flags uint32) error {
 	return nil
 }
 
+// Resize the socket receive buffer, SO_RCVBUFFORCE bypasses the
+// net.core.rmem_max limit when the process has CAP_NET_ADMIN.
+func (w *Watcher) setBufferSize(size int) error {
+	listener, _ := w.listener.(*netlinkListener)
+
+	listener.sockMutex.Lock()
+	defer listener.sockMutex.Unlock()
+
+	if err := listener.setRcvbuf(size); err != nil {
+		return err
+	}
+	listener.rcvbuf = size
+	return nil
+}
+
+// Resize the socket receive buffer of the listener, sockMutex must be held
+func (listener *netlinkListener) setRcvbuf(size int) error {
+	err := syscall.SetsockoptInt(listener.sock, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, size)
+	if err == syscall.EPERM {
+		err = syscall.SetsockoptInt(listener.sock, syscall.SOL_SOCKET, syscall.SO_RCVBUF, size)
+	}
+	return err
+}
+
 // Read events from the netlink socket
 func (w *Watcher) readEvents() {
 	buf := make([]byte, syscall.Getpagesize())
@@ -164,116 +296,309 @@ func (w *Watcher) readEvents() {
 
 		nr, _, err := syscall.Recvfrom(listener.sock, buf, 0)
 
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+			// read timeout, loop around to check for Close()
+			continue
+		}
+		if err == syscall.ENOBUFS {
+			// the socket receive buffer overflowed, the
+			// kernel dropped events and the socket is usable
+			w.drop()
+			continue
+		}
 		if err != nil {
-			w.Error <- err
+			w.sendError(err)
+			if w.rebind {
+				w.rebindListener(listener)
+			}
 			continue
 		}
 		if nr < syscall.NLMSG_HDRLEN {
-			w.Error <- syscall.EINVAL
+			w.sendError(syscall.EINVAL)
 			continue
 		}
 
 		msgs, _ := syscall.ParseNetlinkMessage(buf[:nr])
 
 		for _, m := range msgs {
-			if m.Header.Type == syscall.NLMSG_DONE {
-				w.handleEvent(m.Data)
-			}
+			w.handleMessage(m)
 		}
 	}
 	close(w.breakLoop)
 }
 
-// Internal helper to check if pid && event is being watched
-func (w *Watcher) isWatching(pid int, event uint32) bool {
-	w.watchesMutex.Lock()
-	defer w.watchesMutex.Unlock()
+// Replace the socket of listener after an error, the events sent while
+// there was no socket are lost. A failed attempt is reported and retried
+// on the next error, which Recvfrom() returns for the closed socket.
+func (w *Watcher) rebindListener(listener *netlinkListener) {
+	if err := listener.rebind(); err != nil {
+		w.sendError(err)
+		// do not spin while the connector is unavailable
+		time.Sleep(readTimeout)
+		return
+	}
+	w.drop()
+}
 
-	if watch, ok := w.watches[pid]; ok {
-		return (watch.flags & event) == event
+// Dispatch a netlink message: the connector sends events as NLMSG_DONE,
+// the kernel reports errors as NLMSG_ERROR and lost messages as
+// NLMSG_OVERRUN.
+func (w *Watcher) handleMessage(m syscall.NetlinkMessage) {
+	switch m.Header.Type {
+	case syscall.NLMSG_DONE:
+		w.handleEvent(m.Data)
+	case syscall.NLMSG_ERROR:
+		if err := netlinkError(m.Data); err != nil {
+			w.sendError(err)
+		}
+	case syscall.NLMSG_OVERRUN:
+		w.drop()
 	}
-	//for any process
-	if watch, ok := w.watches[-1]; ok {
-		return (watch.flags & event) == event
+}
+
+// Decode the payload of an NLMSG_ERROR message, the negated errno and the
+// header of the message in error. It returns nil for an acknowledgement,
+// which has an errno of 0.
+func netlinkError(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("psnotify: truncated netlink error message")
+	}
+
+	errno := syscall.Errno(-int32(byteOrder.Uint32(data)))
+	if errno == 0 {
+		return nil
+	}
+	if len(data) < 4+syscall.NLMSG_HDRLEN {
+		return fmt.Errorf("psnotify: netlink error: %v", errno)
 	}
-	return false
+	// nlmsg_seq of the message in error, after its len, type and flags
+	seq := byteOrder.Uint32(data[4+8:])
+	return fmt.Errorf("psnotify: netlink error replying to message %d: %v", seq, errno)
 }
 
 // Dispatch events from the netlink socket to the Event channels.
 // Unlike bsd kqueue, netlink receives events for all pids,
 // so we apply filtering based on the watch table via isWatching()
 func (w *Watcher) handleEvent(data []byte) {
-	buf := bytes.NewBuffer(data)
-	msg := &cnMsg{}
-	hdr := &procEventHeader{}
+	var msg cnMsg
+	var hdr procEventHeader
+	if !decodeHeaders(data, &msg, &hdr) {
+		return
+	}
+	data = data[sizeofCnMsg+sizeofProcEventHeader:]
 
-	binary.Read(buf, byteOrder, msg)
-	binary.Read(buf, byteOrder, hdr)
+	ts := eventTime(hdr.Timestamp)
 
 	switch hdr.What {
 	case PROC_EVENT_FORK:
-		event := &forkProcEvent{}
-		binary.Read(buf, byteOrder, event)
+		var event forkProcEvent
+		if !decodeUint32s(data, &event.ParentPid, &event.ParentTgid, &event.ChildPid, &event.ChildTgid) {
+			return
+		}
 		ppid := int(event.ParentTgid)
 		pid := int(event.ChildTgid)
 
-		if w.isWatching(ppid, PROC_EVENT_EXEC) {
+		if w.isWatching(ppid, PROC_EVENT_FOLLOW) {
 			// follow forks
-			watch, ok := w.watches[ppid]
-			if !ok {
-				if watch, ok := w.watches[-1]; ok {
-					w.Watch(pid, watch.flags)
-				}
-			} else {
-				w.Watch(pid, watch.flags)
+			if flags, ok := w.watchFlags(ppid); ok {
+				w.Watch(pid, flags)
+				w.addChild(ppid, pid)
 			}
 		}
 
 		if w.isWatching(ppid, PROC_EVENT_FORK) {
-			w.Fork <- &ProcEventFork{ParentPid: ppid, ChildPid: pid}
+			w.emit(&ProcEventFork{ParentPid: ppid, ChildPid: pid, Timestamp: ts})
 		}
 	case PROC_EVENT_EXEC:
-		event := &execProcEvent{}
-		binary.Read(buf, byteOrder, event)
+		var event execProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid) {
+			return
+		}
 		pid := int(event.ProcessTgid)
 
+		if w.isWatchingNames() {
+			if flags, ok := w.matchName(procNames(pid)); ok {
+				w.Watch(pid, flags)
+			}
+		}
+
 		if w.isWatching(pid, PROC_EVENT_EXEC) {
-			w.Exec <- &ProcEventExec{Pid: pid}
+			ev := &ProcEventExec{Pid: pid, Timestamp: ts}
+			if w.execDetails {
+				ev.Filename, ev.Args = execDetails(pid)
+			}
+			w.emit(ev)
 		}
 	case PROC_EVENT_EXIT:
-		event := &exitProcEvent{}
-		binary.Read(buf, byteOrder, event)
+		var event exitProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid, &event.ExitCode, &event.ExitSignal) {
+			return
+		}
 		pid := int(event.ProcessTgid)
 
-		if w.isWatching(pid, PROC_EVENT_EXIT) {
-			w.RemoveWatch(pid)
-			w.Exit <- &ProcEventExit{Pid: pid}
+		if w.handleExit(pid) {
+			// exit_code is the wait status, exit_signal is
+			// only the signal sent to the parent (SIGCHLD)
+			code, signal := waitStatus(event.ExitCode)
+			w.emit(&ProcEventExit{Pid: pid, ExitCode: code, ExitSignal: signal, Timestamp: ts})
 		}
 	case PROC_EVENT_UID:
-		event := &idProcEvent{}
-		binary.Read(buf, byteOrder, event)
-		pid := int(event.ProcessPid)
+		var event idProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid, &event.Rid, &event.Eid) {
+			return
+		}
+		pid := int(event.ProcessTgid)
+
+		// the process is still alive after a credential change,
+		// so the watch is kept in place
 		if w.isWatching(pid, PROC_EVENT_UID) {
-			w.RemoveWatch(pid)
-			w.Uid <- &ProcEventUid{Pid: pid, Tgid: int(event.ProcessTgid), Rid: int(event.Rid), Eid: int(event.Eid)}
+			w.emit(&ProcEventUID{Pid: pid, Ruid: event.Rid, Euid: event.Eid, Timestamp: ts})
 		}
 	case PROC_EVENT_GID:
-		event := &idProcEvent{}
-		binary.Read(buf, byteOrder, event)
-		pid := int(event.ProcessPid)
-		if w.isWatching(pid, PROC_EVENT_UID) {
-			w.RemoveWatch(pid)
-			w.Uid <- &ProcEventUid{IsGid: true, Pid: pid, Tgid: int(event.ProcessTgid), Rid: int(event.Rid), Eid: int(event.Eid)}
+		var event idProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid, &event.Rid, &event.Eid) {
+			return
+		}
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_GID) {
+			w.emit(&ProcEventGID{Pid: pid, Rgid: event.Rid, Egid: event.Eid, Timestamp: ts})
 		}
 	case PROC_EVENT_SID:
-		event := &sidProcEvent{}
-		binary.Read(buf, byteOrder, event)
+		var event sidProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid) {
+			return
+		}
 		pid := int(event.ProcessPid)
+
+		// setsid() does not end the process, keep the watch
 		if w.isWatching(pid, PROC_EVENT_SID) {
-			w.RemoveWatch(pid)
-			w.Sid <- &ProcEventSid{Pid: pid, Tgid: int(event.ProcessTgid)}
+			w.emit(&ProcEventSid{Pid: pid, Tgid: int(event.ProcessTgid), Timestamp: ts})
+		}
+	case PROC_EVENT_PTRACE:
+		var event ptraceProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid, &event.TracerPid, &event.TracerTgid) {
+			return
+		}
+		pid := int(event.ProcessTgid)
+
+		// the kernel reports a detach with a zero tracer
+		if w.isWatching(pid, PROC_EVENT_PTRACE) {
+			w.emit(&ProcEventPtrace{Pid: pid, TracerPid: int(event.TracerTgid), Timestamp: ts})
+		}
+	case PROC_EVENT_COMM:
+		var event commProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid) ||
+			len(data) < 8+len(event.Comm) {
+			return
+		}
+		copy(event.Comm[:], data[8:])
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_COMM) {
+			comm := event.Comm[:]
+			if n := bytes.IndexByte(comm, 0); n >= 0 {
+				comm = comm[:n]
+			}
+			w.emit(&ProcEventComm{Pid: pid, Comm: string(comm), Timestamp: ts})
+		}
+	case PROC_EVENT_COREDUMP:
+		var event coredumpProcEvent
+		if !decodeUint32s(data, &event.ProcessPid, &event.ProcessTgid, &event.ParentPid, &event.ParentTgid) {
+			return
+		}
+		pid := int(event.ProcessTgid)
+
+		if w.isWatching(pid, PROC_EVENT_COREDUMP) {
+			w.emit(&ProcEventCoredump{Pid: pid, Timestamp: ts})
+		}
+	}
+}
+
+// Wall clock time of the boot, the realtime clock minus the monotonic
+// clock the kernel timestamps events with, zero when it is unknown.
+// Later changes of the realtime clock are not taken into account.
+func getBootTime() time.Time {
+	bootTimeOnce.Do(func() {
+		var ts syscall.Timespec
+		_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME,
+			_CLOCK_MONOTONIC, uintptr(unsafe.Pointer(&ts)), 0)
+		if errno == 0 {
+			bootTime = time.Now().Add(-time.Duration(ts.Nano()))
 		}
+	})
+	return bootTime
+}
+
+// Convert the nanoseconds since boot of an event header to a wall
+// clock time, falling back to now when the boot time is unknown.
+func eventTime(ns uint64) time.Time {
+	boot := getBootTime()
+	if boot.IsZero() || ns == 0 {
+		return time.Now()
 	}
+	return boot.Add(time.Duration(ns))
+}
+
+// Best effort lookup of the executable and arguments of pid,
+// empty when the process is gone or not accessible.
+func execDetails(pid int) (string, []string) {
+	dir := filepath.Join(procd, strconv.Itoa(pid))
+
+	filename, _ := os.Readlink(filepath.Join(dir, "exe"))
+
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return filename, nil
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+
+	return filename, args
+}
+
+// Best effort lookup of the command name and executable of pid,
+// for the WatchName() patterns.
+func procNames(pid int) (string, string) {
+	dir := filepath.Join(procd, strconv.Itoa(pid))
+
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+
+	return strings.TrimSuffix(string(comm), "\n"), exe
+}
+
+// netlink receives the exec events of every process
+func (w *Watcher) canWatchNames() error {
+	return nil
+}
+
+// Whether pid is running, for Ignore(): the netlink
+// listener has no per pid filter to register.
+func processExists(pid int) bool {
+	_, err := os.Stat(filepath.Join(procd, strconv.Itoa(pid)))
+	return err == nil
+}
+
+// The pids of the running processes, for WatchAll()
+func existingPids() ([]int, error) {
+	d, err := os.Open(procd)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	pids := make([]int, 0, len(names))
+	for _, name := range names {
+		if pid, err := strconv.Atoi(name); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
 }
 
 // Bind our netlink socket and
@@ -300,7 +625,108 @@ func (listener *netlinkListener) bind() error {
 		return err
 	}
 
-	return listener.send(_PROC_CN_MCAST_LISTEN)
+	// bound the blocking Recvfrom() in readEvents()
+	tv := syscall.NsecToTimeval(readTimeout.Nanoseconds())
+	err = syscall.SetsockoptTimeval(listener.sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	if err != nil {
+		return err
+	}
+
+	if err = listener.send(_PROC_CN_MCAST_LISTEN); err != nil {
+		return err
+	}
+
+	return listener.waitAck()
+}
+
+// Close our netlink socket and subscribe again with a new one,
+// with the buffer size set by SetBufferSize().
+func (listener *netlinkListener) rebind() error {
+	listener.sockMutex.Lock()
+	defer listener.sockMutex.Unlock()
+
+	if listener.sock != -1 {
+		syscall.Close(listener.sock)
+		listener.sock = -1
+	}
+
+	if err := listener.bind(); err != nil {
+		if listener.sock != -1 {
+			syscall.Close(listener.sock)
+			listener.sock = -1
+		}
+		return err
+	}
+
+	if listener.rcvbuf > 0 {
+		return listener.setRcvbuf(listener.rcvbuf)
+	}
+	return nil
+}
+
+// Wait for the connector driver to acknowledge the last control message.
+// Acknowledgements are multicast, like events, so the socket may also
+// receive events and the acknowledgements of other listeners.
+func (listener *netlinkListener) waitAck() error {
+	buf := make([]byte, syscall.Getpagesize())
+	deadline := time.Now().Add(ackTimeout)
+
+	for time.Now().Before(deadline) {
+		nr, _, err := syscall.Recvfrom(listener.sock, buf, 0)
+
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		msgs, _ := syscall.ParseNetlinkMessage(buf[:nr])
+
+		for _, m := range msgs {
+			if m.Header.Type == syscall.NLMSG_ERROR {
+				if err := netlinkError(m.Data); err != nil {
+					return err
+				}
+				continue
+			}
+			if m.Header.Type != syscall.NLMSG_DONE {
+				continue
+			}
+			if acked, err := listener.checkAck(m.Data); acked {
+				return err
+			}
+		}
+	}
+
+	return errors.New("proc connector did not acknowledge the subscription, " +
+		"the kernel may lack CONFIG_PROC_EVENTS or the process may run " +
+		"outside the initial pid namespace")
+}
+
+// Report whether data acknowledges the last control message,
+// and the error the connector driver rejected it with.
+func (listener *netlinkListener) checkAck(data []byte) (bool, error) {
+	var msg cnMsg
+	var hdr procEventHeader
+	var ack ackProcEvent
+	if !decodeHeaders(data, &msg, &hdr) {
+		return false, nil
+	}
+
+	// the driver replies with the ack of the control message + 1,
+	// the seq of the reply is not ours on all kernel versions
+	if hdr.What != _PROC_EVENT_NONE || msg.Ack != listener.seq+1 {
+		return false, nil
+	}
+
+	decodeUint32s(data[sizeofCnMsg+sizeofProcEventHeader:], &ack.Err)
+	if ack.Err != 0 {
+		return true, fmt.Errorf("proc connector rejected the subscription: %v",
+			syscall.Errno(ack.Err))
+	}
+	return true, nil
 }
 
 // Send an ignore control message to the connector driver
@@ -325,6 +751,8 @@ func (listener *netlinkListener) send(op uint32) error {
 
 	pr.Data.Id.Idx = _CN_IDX_PROC
 	pr.Data.Id.Val = _CN_VAL_PROC
+	pr.Data.Seq = listener.seq
+	pr.Data.Ack = listener.seq
 
 	pr.Data.Len = uint16(binary.Size(op))
 
@@ -0,0 +1,913 @@
+package psnotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Watcher that is not bound to a netlink socket, events are
+// injected by calling handleEvent directly
+func newTestEventWatcher() *Watcher {
+	return newWatcher(nil, 1)
+}
+
+func TestEventAllContainsEveryFlag(t *testing.T) {
+	flags := map[string]uint32{
+		"PROC_EVENT_FORK":     PROC_EVENT_FORK,
+		"PROC_EVENT_EXEC":     PROC_EVENT_EXEC,
+		"PROC_EVENT_UID":      PROC_EVENT_UID,
+		"PROC_EVENT_GID":      PROC_EVENT_GID,
+		"PROC_EVENT_SID":      PROC_EVENT_SID,
+		"PROC_EVENT_PTRACE":   PROC_EVENT_PTRACE,
+		"PROC_EVENT_COMM":     PROC_EVENT_COMM,
+		"PROC_EVENT_COREDUMP": PROC_EVENT_COREDUMP,
+		"PROC_EVENT_EXIT":     PROC_EVENT_EXIT,
+		"PROC_EVENT_FOLLOW":   PROC_EVENT_FOLLOW,
+	}
+
+	for name, flag := range flags {
+		if PROC_EVENT_ALL&flag != flag {
+			t.Errorf("PROC_EVENT_ALL does not contain %s", name)
+		}
+	}
+}
+
+// Build the connector payload of a netlink message carrying a proc event
+func procEventData(what uint32, event interface{}) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, byteOrder, &cnMsg{Id: cbId{Idx: _CN_IDX_PROC, Val: _CN_VAL_PROC}})
+	binary.Write(buf, byteOrder, &procEventHeader{What: what})
+	binary.Write(buf, byteOrder, event)
+	return buf.Bytes()
+}
+
+func TestHandleCommEvent(t *testing.T) {
+	w := newTestEventWatcher()
+	w.watches[42] = &watch{flags: PROC_EVENT_COMM}
+
+	event := &commProcEvent{ProcessPid: 42, ProcessTgid: 42}
+	copy(event.Comm[:], "worker")
+	w.handleEvent(procEventData(PROC_EVENT_COMM, event))
+
+	select {
+	case ev := <-w.Comm:
+		if ev.Pid != 42 || ev.Comm != "worker" {
+			t.Errorf("Unexpected comm event %+v", ev)
+		}
+	default:
+		t.Fatal("Expected a comm event")
+	}
+}
+
+func TestHandlePtraceEvent(t *testing.T) {
+	w := newTestEventWatcher()
+	w.watches[42] = &watch{flags: PROC_EVENT_PTRACE}
+
+	w.handleEvent(procEventData(PROC_EVENT_PTRACE, &ptraceProcEvent{
+		ProcessPid:  42,
+		ProcessTgid: 42,
+		TracerPid:   7,
+		TracerTgid:  7,
+	}))
+	ev := <-w.Ptrace
+	if ev.Pid != 42 || ev.TracerPid != 7 || ev.Detached() {
+		t.Errorf("Expected attach event, got %+v", ev)
+	}
+
+	w.handleEvent(procEventData(PROC_EVENT_PTRACE, &ptraceProcEvent{
+		ProcessPid:  42,
+		ProcessTgid: 42,
+	}))
+	ev = <-w.Ptrace
+	if ev.Pid != 42 || !ev.Detached() {
+		t.Errorf("Expected detach event, got %+v", ev)
+	}
+}
+
+func TestHandleCoredumpEvent(t *testing.T) {
+	w := newTestEventWatcher()
+	w.watches[42] = &watch{flags: PROC_EVENT_COREDUMP}
+
+	w.handleEvent(procEventData(PROC_EVENT_COREDUMP, &coredumpProcEvent{
+		ProcessPid:  42,
+		ProcessTgid: 42,
+		ParentPid:   1,
+		ParentTgid:  1,
+	}))
+
+	select {
+	case ev := <-w.Coredump:
+		if ev.Pid != 42 {
+			t.Errorf("Expected coredump event for pid=42, got %+v", ev)
+		}
+	default:
+		t.Fatal("Expected a coredump event")
+	}
+}
+
+func TestBufferedWatcherSlowConsumer(t *testing.T) {
+	const events = 200
+
+	w := newWatcher(nil, 8)
+	w.watches[-1] = &watch{flags: PROC_EVENT_FORK}
+
+	go func() {
+		for i := 0; i < events; i++ {
+			w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{
+				ParentPid:  1,
+				ParentTgid: 1,
+				ChildPid:   uint32(1000 + i),
+				ChildTgid:  uint32(1000 + i),
+			}))
+		}
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < events; i++ {
+		select {
+		case ev := <-w.Fork:
+			if ev.ChildPid != 1000+i {
+				t.Fatalf("Expected child pid=%d, received=%d", 1000+i, ev.ChildPid)
+			}
+			// slow consumer
+			time.Sleep(time.Millisecond)
+		case <-timeout:
+			t.Fatalf("Deadlock after %d of %d fork events", i, events)
+		}
+	}
+}
+
+func TestHandleForkFollow(t *testing.T) {
+	const parent, child, grandchild = 100, 101, 102
+
+	w := newTestEventWatcher()
+	w.Watch(parent, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW)
+
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: child, ChildTgid: child}))
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: child, ParentTgid: child, ChildPid: grandchild, ChildTgid: grandchild}))
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: grandchild, ProcessTgid: grandchild}))
+
+	select {
+	case ev := <-w.Exit:
+		if ev.Pid != grandchild {
+			t.Errorf("Expected exit of pid=%d, received=%d", grandchild, ev.Pid)
+		}
+	default:
+		t.Fatal("Expected an exit event for the grandchild")
+	}
+
+	if !w.isWatching(child, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW) {
+		t.Error("Expected the child to inherit the watch flags")
+	}
+	if w.isWatching(grandchild, PROC_EVENT_EXIT) {
+		t.Error("Expected the watch to be removed on exit")
+	}
+}
+
+func TestHandleForkWithoutFollow(t *testing.T) {
+	const parent, child = 100, 101
+
+	w := newTestEventWatcher()
+	w.Watch(parent, PROC_EVENT_EXEC|PROC_EVENT_EXIT)
+
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: child, ChildTgid: child}))
+
+	if w.isWatching(child, PROC_EVENT_EXIT) {
+		t.Error("Expected the child not to be watched without PROC_EVENT_FOLLOW")
+	}
+}
+
+// Point procd at a directory listing pids as running, for Ignore(),
+// call the returned func to restore it.
+func fakeProcd(t *testing.T, pids ...int) func() {
+	dir, err := ioutil.TempDir("", "psnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pid := range pids {
+		if err := os.Mkdir(filepath.Join(dir, strconv.Itoa(pid)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := procd
+	procd = dir
+	return func() {
+		procd = saved
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHandleEventIgnore(t *testing.T) {
+	const self, child, other, followed, grandchild = 100, 101, 200, 300, 301
+	defer fakeProcd(t, self, followed)()
+
+	w := newTestEventWatcher()
+	w.Watch(-1, PROC_EVENT_FORK|PROC_EVENT_EXIT|PROC_EVENT_FOLLOW)
+	w.Watch(followed, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW)
+	w.Ignore(self, followed)
+
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: self, ParentTgid: self, ChildPid: child, ChildTgid: child}))
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: followed, ParentTgid: followed, ChildPid: grandchild, ChildTgid: grandchild}))
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: self, ProcessTgid: self}))
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: followed, ProcessTgid: followed}))
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: other, ProcessTgid: other}))
+
+	if len(w.Fork) != 0 {
+		t.Errorf("Expected no fork event of an ignored pid, received=%+v", <-w.Fork)
+	}
+	select {
+	case ev := <-w.Exit:
+		if ev.Pid != other {
+			t.Errorf("Expected exit of pid=%d, received=%d", other, ev.Pid)
+		}
+	default:
+		t.Fatal("Expected an exit event for the pid that is not ignored")
+	}
+	if len(w.Exit) != 0 {
+		t.Errorf("Expected a single exit event, received=%+v", <-w.Exit)
+	}
+
+	// the forks of the ignored pids are not followed
+	for _, pid := range []int{child, grandchild} {
+		if _, ok := w.watches[pid]; ok {
+			t.Errorf("Expected pid=%d not to be watched", pid)
+		}
+	}
+}
+
+func TestHandleEventIgnoreReusedPid(t *testing.T) {
+	const ignored, watched, parent = 100, 200, 1
+	defer fakeProcd(t, ignored, watched)()
+
+	exit := func(w *Watcher, pid uint32) {
+		w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: pid, ProcessTgid: pid}))
+	}
+	exits := func(w *Watcher) []int {
+		var pids []int
+		for len(w.Exit) > 0 {
+			pids = append(pids, (<-w.Exit).Pid)
+		}
+		return pids
+	}
+
+	w := newWatcher(nil, 4)
+	w.Watch(-1, PROC_EVENT_EXIT)
+	w.Watch(watched, PROC_EVENT_EXEC|PROC_EVENT_EXIT)
+	w.Ignore(ignored, watched)
+
+	if _, ok := w.watches[watched]; ok {
+		t.Error("Expected the watch of an ignored pid to be removed")
+	}
+
+	exit(w, ignored)
+	if pids := exits(w); len(pids) != 0 {
+		t.Errorf("Expected no exit event of an ignored pid, received=%v", pids)
+	}
+
+	// an unrelated process reuses the pid
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: ignored, ChildTgid: ignored}))
+	exit(w, ignored)
+	if pids := exits(w); !reflect.DeepEqual(pids, []int{ignored}) {
+		t.Errorf("Expected the exit of the reused pid=%d, received=%v", ignored, pids)
+	}
+
+	w.Unignore(watched)
+	exit(w, watched)
+	if pids := exits(w); !reflect.DeepEqual(pids, []int{watched}) {
+		t.Errorf("Expected the exit of the unignored pid=%d, received=%v", watched, pids)
+	}
+	if len(w.ignored) != 0 {
+		t.Errorf("Expected no ignored pid left, got=%v", w.ignored)
+	}
+}
+
+func TestIgnoreMissingPid(t *testing.T) {
+	const running, missing = 100, 200
+	defer fakeProcd(t, running)()
+
+	w := newTestEventWatcher()
+	w.Ignore(running, missing)
+	if !w.ignored[running] || w.ignored[missing] {
+		t.Errorf("Expected only the running pid=%d to be ignored, got=%v", running, w.ignored)
+	}
+
+	w.isClosed = true
+	w.Unignore(running)
+	w.Ignore(running)
+	if len(w.ignored) != 0 {
+		t.Errorf("Expected nothing to be ignored once closed, got=%v", w.ignored)
+	}
+}
+
+func TestHandleForkWatchTree(t *testing.T) {
+	const root, child, grandchild, other = 100, 101, 102, 200
+
+	fork := func(w *Watcher, ppid, pid uint32) {
+		w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: ppid, ParentTgid: ppid, ChildPid: pid, ChildTgid: pid}))
+	}
+	exit := func(w *Watcher, pid uint32) {
+		w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: pid, ProcessTgid: pid}))
+		<-w.Exit
+	}
+
+	w := newTestEventWatcher()
+	w.WatchTree(root, PROC_EVENT_EXIT)
+	w.Watch(other, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW)
+	fork(w, root, child)
+	fork(w, child, grandchild)
+	fork(w, other, other+1)
+
+	for _, pid := range []int{root, child, grandchild} {
+		if w.trees[pid] != root || !w.isWatching(pid, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW) {
+			t.Errorf("Expected pid=%d to be watched in the tree of %d", pid, root)
+		}
+	}
+
+	// the subtree is removed with its root, other watches are kept
+	if err := w.RemoveWatch(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, pid := range []int{root, child, grandchild} {
+		if w.isWatching(pid, PROC_EVENT_EXIT) {
+			t.Errorf("Expected pid=%d not to be watched", pid)
+		}
+	}
+	if !w.isWatching(other+1, PROC_EVENT_EXIT) {
+		t.Error("Expected the child of another watch to be kept")
+	}
+	if len(w.trees) != 0 {
+		t.Errorf("Expected no tree, got=%v", w.trees)
+	}
+
+	// the descendants outlive their root
+	w = newTestEventWatcher()
+	w.WatchTree(root, PROC_EVENT_EXIT)
+	fork(w, root, child)
+	fork(w, child, grandchild)
+	exit(w, root)
+	if !w.isWatching(grandchild, PROC_EVENT_EXIT) || w.trees[grandchild] != root {
+		t.Error("Expected the grandchild to stay watched after the root exited")
+	}
+	exit(w, grandchild)
+	exit(w, child)
+	if len(w.trees) != 0 || len(w.watches) != 0 {
+		t.Errorf("Expected the tree to be removed, got trees=%v watches=%v", w.trees, w.watches)
+	}
+}
+
+// Run with -race: the read loop and user goroutines share the watches
+func TestHandleEventConcurrentWatches(t *testing.T) {
+	const parent = 100
+
+	w := newTestEventWatcher()
+	w.Watch(parent, PROC_EVENT_ALL)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for pid := parent + 1; ; pid++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: uint32(pid), ChildTgid: uint32(pid)}))
+			w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: uint32(pid), ProcessTgid: uint32(pid)}))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-w.Fork:
+			case <-w.Exit:
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		w.Watch(-1, PROC_EVENT_EXIT)
+		w.Watch(parent, PROC_EVENT_ALL)
+		w.RemoveWatch(-1)
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestHandleEventAfterClosing(t *testing.T) {
+	const pid = 100
+
+	w := newTestEventWatcher()
+	w.Watch(pid, PROC_EVENT_COMM)
+	close(w.closing)
+
+	// the channel has room for a single event, the second send
+	// would block forever if it did not give up on closing
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2; i++ {
+			w.handleEvent(procEventData(PROC_EVENT_COMM, &commProcEvent{ProcessPid: pid, ProcessTgid: pid}))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handleEvent blocked on a full channel of a closing watcher")
+	}
+}
+
+func TestHandleEventUnified(t *testing.T) {
+	const parent, child = 100, 101
+
+	w := newTestEventWatcher()
+	w.events = make(chan ProcEvent, 3)
+	w.Watch(parent, PROC_EVENT_ALL)
+
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: child, ChildTgid: child}))
+	w.handleEvent(procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: child, ProcessTgid: child}))
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: child, ProcessTgid: child}))
+
+	if len(w.Fork) != 0 || len(w.Exec) != 0 || len(w.Exit) != 0 {
+		t.Error("Expected no events on the typed channels")
+	}
+
+	if ev, ok := (<-w.Events()).(*ProcEventFork); !ok || ev.ChildPid != child {
+		t.Errorf("Expected fork of pid=%d first, received=%#v", child, ev)
+	}
+	if ev, ok := (<-w.Events()).(*ProcEventExec); !ok || ev.Pid != child {
+		t.Errorf("Expected exec of pid=%d second, received=%#v", child, ev)
+	}
+	if ev, ok := (<-w.Events()).(*ProcEventExit); !ok || ev.Pid != child {
+		t.Errorf("Expected exit of pid=%d last, received=%#v", child, ev)
+	}
+}
+
+func TestHandleExitStatus(t *testing.T) {
+	const pid = 100
+
+	w := newTestEventWatcher()
+
+	tests := []struct {
+		status       uint32
+		code, signal int
+	}{
+		{0, 0, 0},
+		{3 << 8, 3, 0},
+		{uint32(syscall.SIGKILL), 0, int(syscall.SIGKILL)},
+		// core dumped flag
+		{0x80 | uint32(syscall.SIGSEGV), 0, int(syscall.SIGSEGV)},
+	}
+
+	for _, test := range tests {
+		w.Watch(pid, PROC_EVENT_EXIT)
+		w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: pid, ProcessTgid: pid, ExitCode: test.status, ExitSignal: uint32(syscall.SIGCHLD)}))
+
+		ev := <-w.Exit
+		if ev.ExitCode != test.code || ev.ExitSignal != test.signal {
+			t.Errorf("status=%#x: expected code=%d signal=%d, received code=%d signal=%d",
+				test.status, test.code, test.signal, ev.ExitCode, ev.ExitSignal)
+		}
+	}
+}
+
+func TestWatcherStats(t *testing.T) {
+	const parent, child = 100, 101
+
+	w := newTestEventWatcher()
+	if stats := w.Stats(); stats != (WatcherStats{}) {
+		t.Errorf("Expected zero stats, received=%+v", stats)
+	}
+
+	w.Watch(parent, PROC_EVENT_ALL)
+	w.handleEvent(procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: parent, ParentTgid: parent, ChildPid: child, ChildTgid: child}))
+	w.handleEvent(procEventData(PROC_EVENT_COMM, &commProcEvent{ProcessPid: child, ProcessTgid: child}))
+
+	// the followed child is watched and the events wait in their channels
+	stats := w.Stats()
+	if stats.Watches != 2 || stats.Fork != 1 || stats.Comm != 1 || stats.Backlog != 2 {
+		t.Errorf("Expected 2 watches, 1 fork, 1 comm and a backlog of 2, received=%+v", stats)
+	}
+
+	<-w.Fork
+	<-w.Comm
+	w.handleEvent(procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: child, ProcessTgid: child}))
+
+	stats = w.Stats()
+	if stats.Watches != 1 || stats.Exit != 1 || stats.Backlog != 1 {
+		t.Errorf("Expected 1 watch, 1 exit and a backlog of 1, received=%+v", stats)
+	}
+
+	w.RemoveWatch(parent)
+	if stats := w.Stats(); stats.Watches != 0 {
+		t.Errorf("Expected no watches, received=%d", stats.Watches)
+	}
+}
+
+func TestHandleNetlinkError(t *testing.T) {
+	w := newTestEventWatcher()
+
+	nlerr := func(errno syscall.Errno) syscall.NetlinkMessage {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, byteOrder, -int32(errno))
+		binary.Write(buf, byteOrder, &syscall.NlMsghdr{Len: syscall.NLMSG_HDRLEN, Type: syscall.NLMSG_DONE, Seq: 7})
+		return syscall.NetlinkMessage{
+			Header: syscall.NlMsghdr{Type: syscall.NLMSG_ERROR},
+			Data:   buf.Bytes(),
+		}
+	}
+
+	w.handleMessage(nlerr(syscall.EPERM))
+	select {
+	case err := <-w.Error:
+		if !strings.Contains(err.Error(), syscall.EPERM.Error()) || !strings.Contains(err.Error(), "message 7") {
+			t.Errorf("Expected the EPERM reply to message 7, received=%v", err)
+		}
+	default:
+		t.Fatal("Expected the netlink error on the Error channel")
+	}
+
+	// acknowledgements are errors with an errno of 0
+	w.handleMessage(nlerr(0))
+	if len(w.Error) != 0 {
+		t.Errorf("Expected no error for an acknowledgement, received=%v", <-w.Error)
+	}
+
+	w.handleMessage(syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.NLMSG_ERROR}, Data: []byte{1}})
+	if len(w.Error) != 1 {
+		t.Fatal("Expected an error for a truncated netlink error")
+	}
+	<-w.Error
+}
+
+func TestHandleNetlinkOverrun(t *testing.T) {
+	w := newTestEventWatcher()
+	w.reportDrops = true
+
+	w.handleMessage(syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.NLMSG_OVERRUN}})
+	if w.Dropped() != 1 {
+		t.Errorf("Expected 1 drop, received=%d", w.Dropped())
+	}
+	select {
+	case err := <-w.Error:
+		if err != ErrEventsDropped {
+			t.Errorf("Expected ErrEventsDropped, received=%v", err)
+		}
+	default:
+		t.Error("Expected ErrEventsDropped on the Error channel")
+	}
+}
+
+func TestDropErrorsIfUnread(t *testing.T) {
+	w := newTestEventWatcher()
+	w.dropErrors = true
+	w.watches[42] = &watch{flags: PROC_EVENT_COMM}
+
+	nlerr := syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.NLMSG_ERROR}, Data: []byte{1}}
+	event := &commProcEvent{ProcessPid: 42, ProcessTgid: 42}
+
+	// the Error channel is never drained, events keep flowing
+	for i := 0; i < 3; i++ {
+		w.handleMessage(nlerr)
+		w.handleEvent(procEventData(PROC_EVENT_COMM, event))
+
+		select {
+		case <-w.Comm:
+		default:
+			t.Fatalf("Expected comm event %d", i)
+		}
+	}
+
+	if s := w.Stats(); s.DroppedErrors != 2 || s.Comm != 3 {
+		t.Errorf("Expected 2 dropped errors and 3 comm events, received=%+v", s)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test must be run as root")
+	}
+
+	l, err := createListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := l.(*netlinkListener)
+	w := newWatcher(listener, 16)
+	if err := w.SetBufferSize(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	w.rebindListener(listener)
+	if len(w.Error) != 0 {
+		t.Fatal(<-w.Error)
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("Expected the rebind to count as a drop, received=%d", w.Dropped())
+	}
+
+	go w.readEvents()
+	defer w.Close()
+
+	pid := os.Getpid()
+	if err := w.Watch(pid, PROC_EVENT_FORK); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command("true").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-w.Fork:
+		if ev.ParentPid != pid {
+			t.Errorf("Expected a fork of %d, received=%+v", pid, ev)
+		}
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a fork event from the new socket")
+	}
+}
+
+// Run with -race: the socket is replaced by the read loop, which this test
+// stands in for, while SetBufferSize resizes it from another goroutine.
+func TestSetBufferSizeDuringRebind(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test must be run as root")
+	}
+
+	l, err := createListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := l.(*netlinkListener)
+	w := newWatcher(listener, 16)
+	defer listener.close()
+
+	const size = 1 << 20
+	if err := w.SetBufferSize(size); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := w.SetBufferSize(size); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		w.rebindListener(listener)
+	}
+	wg.Wait()
+
+	if len(w.Error) != 0 {
+		t.Fatal(<-w.Error)
+	}
+	rcvbuf, err := syscall.GetsockoptInt(listener.sock, syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the kernel doubles the size for its bookkeeping
+	if rcvbuf < size {
+		t.Errorf("Expected the rebound socket to keep the buffer size, received=%d", rcvbuf)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	const pid = 100
+
+	w := newTestEventWatcher()
+	if _, _, err := w.Poll(0); err == nil {
+		t.Error("Expected Poll to fail without WatcherOptions.Unified")
+	}
+
+	w.events = make(chan ProcEvent, 1)
+	w.Watch(pid, PROC_EVENT_ALL)
+
+	if ev, ok, err := w.Poll(0); ok || ev != nil || err != nil {
+		t.Errorf("Expected no event, received=%#v ok=%v err=%v", ev, ok, err)
+	}
+	if _, ok, err := w.Poll(10 * time.Millisecond); ok || err != nil {
+		t.Errorf("Expected a timeout, received ok=%v err=%v", ok, err)
+	}
+
+	w.handleEvent(procEventData(PROC_EVENT_COMM, &commProcEvent{ProcessPid: pid, ProcessTgid: pid}))
+	if ev, ok, err := w.Poll(time.Second); !ok || err != nil {
+		t.Errorf("Expected an event, received ok=%v err=%v", ok, err)
+	} else if ev, ok := ev.(*ProcEventComm); !ok || ev.Pid != pid {
+		t.Errorf("Expected the comm event of pid=%d, received=%#v", pid, ev)
+	}
+	// the event was only delivered once
+	if len(w.Events()) != 0 || len(w.Comm) != 0 {
+		t.Error("Expected the polled event to be consumed")
+	}
+
+	w.Error <- ErrEventsDropped
+	if _, ok, err := w.Poll(time.Second); ok || err != ErrEventsDropped {
+		t.Errorf("Expected ErrEventsDropped, received ok=%v err=%v", ok, err)
+	}
+
+	w.finish()
+	if _, ok, err := w.Poll(time.Second); ok || err == nil {
+		t.Errorf("Expected an error once closed, received ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCheckAck(t *testing.T) {
+	listener := &netlinkListener{seq: 3}
+
+	ack := func(seq, ack, errno uint32) []byte {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, byteOrder, &cnMsg{Seq: seq, Ack: ack})
+		binary.Write(buf, byteOrder, &procEventHeader{What: _PROC_EVENT_NONE})
+		binary.Write(buf, byteOrder, &ackProcEvent{Err: errno})
+		return buf.Bytes()
+	}
+
+	if acked, err := listener.checkAck(ack(1234, 4, 0)); !acked || err != nil {
+		t.Errorf("Expected a successful ack, got acked=%v err=%v", acked, err)
+	}
+	if acked, err := listener.checkAck(ack(3, 4, uint32(syscall.EPERM))); !acked || err == nil {
+		t.Errorf("Expected a rejected ack, got acked=%v err=%v", acked, err)
+	}
+	// acknowledgement of another listener
+	if acked, _ := listener.checkAck(ack(3, 1, 0)); acked {
+		t.Error("Expected an ack with another ack number to be ignored")
+	}
+	// regular events are not acknowledgements
+	data := procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: 1, ProcessTgid: 1})
+	if acked, _ := listener.checkAck(data); acked {
+		t.Error("Expected an exit event to be ignored")
+	}
+}
+
+func TestNewWatcherWithoutCapNetAdmin(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("test must be run as a regular user")
+	}
+
+	watcher, err := NewWatcher()
+	if err == nil {
+		watcher.Close()
+		t.Fatal("Expected NewWatcher to fail without CAP_NET_ADMIN")
+	}
+}
+
+func TestHandleExecDetails(t *testing.T) {
+	const pid = 100
+
+	dir, err := ioutil.TempDir("", "psnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { procd = d }(procd)
+	procd = dir
+
+	os.MkdirAll(filepath.Join(dir, "100"), 0755)
+	os.Symlink("/bin/sleep", filepath.Join(dir, "100", "exe"))
+	ioutil.WriteFile(filepath.Join(dir, "100", "cmdline"), []byte("sleep\x0010\x00"), 0644)
+
+	w := newTestEventWatcher()
+	w.execDetails = true
+	w.Watch(pid, PROC_EVENT_EXEC)
+	w.Watch(pid+1, PROC_EVENT_EXEC)
+
+	w.handleEvent(procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: pid, ProcessTgid: pid}))
+	ev := <-w.Exec
+	if ev.Filename != "/bin/sleep" {
+		t.Errorf("Expected filename=/bin/sleep, received=%q", ev.Filename)
+	}
+	if !reflect.DeepEqual(ev.Args, []string{"sleep", "10"}) {
+		t.Errorf("Expected args=[sleep 10], received=%q", ev.Args)
+	}
+
+	// the process exited before its details were read
+	w.handleEvent(procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: pid + 1, ProcessTgid: pid + 1}))
+	ev = <-w.Exec
+	if ev.Pid != pid+1 || ev.Filename != "" || ev.Args != nil {
+		t.Errorf("Expected an exec event without details, received=%#v", ev)
+	}
+}
+
+func TestHandleExecName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { procd = d }(procd)
+	procd = dir
+
+	os.MkdirAll(filepath.Join(dir, "100"), 0755)
+	os.Symlink("/usr/sbin/sshd", filepath.Join(dir, "100", "exe"))
+	ioutil.WriteFile(filepath.Join(dir, "100", "comm"), []byte("sshd\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "101"), 0755)
+	os.Symlink("/usr/sbin/sshd-session", filepath.Join(dir, "101", "exe"))
+	ioutil.WriteFile(filepath.Join(dir, "101", "comm"), []byte("sshd-session\n"), 0644)
+
+	w := newTestEventWatcher()
+	if err := w.WatchName("sshd", PROC_EVENT_EXEC|PROC_EVENT_EXIT); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pattern matches the whole name only
+	w.handleEvent(procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: 101, ProcessTgid: 101}))
+	w.handleEvent(procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: 100, ProcessTgid: 100}))
+	ev := <-w.Exec
+	if ev.Pid != 100 {
+		t.Errorf("Expected an exec event for pid=100, received=%d", ev.Pid)
+	}
+	if !w.isWatching(100, PROC_EVENT_EXIT) {
+		t.Error("Expected pid=100 to be watched after its exec")
+	}
+	if w.isWatching(101, PROC_EVENT_EXEC) {
+		t.Error("Expected pid=101 not to be watched")
+	}
+
+	if err := w.RemoveWatchName("sshd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RemoveWatchName("sshd"); err == nil {
+		t.Error("Expected an error removing a name that is not watched")
+	}
+	if err := w.WatchName("ssh(", PROC_EVENT_EXEC); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	boot := getBootTime()
+	if boot.IsZero() || boot.After(time.Now()) {
+		t.Fatalf("Unexpected boot time %v", boot)
+	}
+
+	if ts := eventTime(uint64(time.Minute)); !ts.Equal(boot.Add(time.Minute)) {
+		t.Errorf("Expected %v, received %v", boot.Add(time.Minute), ts)
+	}
+
+	// events without a kernel timestamp get the time they were read
+	before := time.Now()
+	if ts := eventTime(0); ts.Before(before) {
+		t.Errorf("Expected a time after %v, received %v", before, ts)
+	}
+
+	w := newTestEventWatcher()
+	w.watches[42] = &watch{flags: PROC_EVENT_EXIT}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, byteOrder, &cnMsg{Id: cbId{Idx: _CN_IDX_PROC, Val: _CN_VAL_PROC}})
+	binary.Write(buf, byteOrder, &procEventHeader{What: PROC_EVENT_EXIT, Timestamp: uint64(time.Hour)})
+	binary.Write(buf, byteOrder, &exitProcEvent{ProcessPid: 42, ProcessTgid: 42})
+	w.handleEvent(buf.Bytes())
+
+	ev := <-w.Exit
+	if !ev.Timestamp.Equal(boot.Add(time.Hour)) {
+		t.Errorf("Expected timestamp=%v, received=%v", boot.Add(time.Hour), ev.Timestamp)
+	}
+}
+
+// Decoding of the events of processes that are not watched, the bulk of
+// the messages under heavy fork activity
+func BenchmarkHandleEvent(b *testing.B) {
+	events := map[string][]byte{
+		"fork": procEventData(PROC_EVENT_FORK, &forkProcEvent{ParentPid: 1, ParentTgid: 1, ChildPid: 2, ChildTgid: 2}),
+		"exec": procEventData(PROC_EVENT_EXEC, &execProcEvent{ProcessPid: 2, ProcessTgid: 2}),
+		"exit": procEventData(PROC_EVENT_EXIT, &exitProcEvent{ProcessPid: 2, ProcessTgid: 2}),
+	}
+	for name, data := range events {
+		b.Run(name, func(b *testing.B) {
+			w := newTestEventWatcher()
+			w.watches[42] = &watch{flags: PROC_EVENT_ALL}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.handleEvent(data)
+			}
+		})
+	}
+}
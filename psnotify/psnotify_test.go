@@ -5,6 +5,7 @@
 package psnotify
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -241,6 +242,43 @@ func TestWatchExit(t *testing.T) {
 	}
 }
 
+func TestWatchExitSignal(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	watcher, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	cmd := startSleepCommand(t)
+	childPid := cmd.Process.Pid
+
+	if err := watcher.Watch(childPid, PROC_EVENT_EXIT); err != nil {
+		t.Fatal(err)
+	}
+
+	syscall.Kill(childPid, syscall.SIGKILL)
+	cmd.Wait()
+
+	select {
+	case ev := <-watcher.Exit:
+		expectEventPid(t, "exit", childPid, ev.Pid)
+		if ev.ExitSignal != int(syscall.SIGKILL) {
+			t.Errorf("Expected exit signal=%d, received=%d", syscall.SIGKILL, ev.ExitSignal)
+		}
+		if ev.ExitCode != 0 {
+			t.Errorf("Expected exit code=0, received=%d", ev.ExitCode)
+		}
+	case err := <-watcher.Error:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the exit event")
+	}
+}
+
 // combined version of TestWatchFork() and TestWatchExit()
 func TestWatchForkAndExit(t *testing.T) {
 	if skipTest(t) {
@@ -285,10 +323,10 @@ func TestWatchFollowFork(t *testing.T) {
 		return
 	}
 
-	// Darwin is not able to follow forks, as the kqueue fork event
-	// does not provide the child pid.
-	if runtime.GOOS != "linux" {
-		fmt.Println("SKIP: test follow forks is linux only")
+	// Darwin is not able to follow forks, as it does not
+	// support the kqueue NOTE_TRACK flag.
+	if runtime.GOOS == "darwin" {
+		fmt.Println("SKIP: test follow forks is not supported on darwin")
 		return
 	}
 
@@ -345,3 +383,276 @@ func TestWatchFollowFork(t *testing.T) {
 		}
 	}
 }
+
+func TestWatchFollowGrandchildExit(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	// Darwin is not able to follow forks, as it does not
+	// support the kqueue NOTE_TRACK flag.
+	if runtime.GOOS == "darwin" {
+		fmt.Println("SKIP: test follow forks is not supported on darwin")
+		return
+	}
+
+	pid := os.Getpid()
+
+	tw := newTestWatcher(t)
+
+	// only exit events, of this process and of its descendants
+	if err := tw.watcher.Watch(pid, PROC_EVENT_EXIT|PROC_EVENT_FOLLOW); err != nil {
+		t.Error(err)
+	}
+
+	// the shell forks a grandchild to run the background job
+	cmd := exec.Command("sh", "-c", "true & wait")
+	if err := cmd.Run(); err != nil {
+		t.Error(err)
+	}
+
+	tw.watcher.RemoveWatch(pid)
+	tw.close()
+
+	exits := tw.events.getExits()
+	if expectEvents(t, 2, "exits", exits) {
+		// the grandchild exits before the shell waiting for it
+		if exits[0] == cmd.Process.Pid {
+			t.Errorf("Expected the grandchild exit first, got=%v", exits)
+		}
+		expectEventPid(t, "exit", cmd.Process.Pid, exits[1])
+	}
+}
+
+func TestWatchTree(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	// Darwin is not able to follow forks, as it does not
+	// support the kqueue NOTE_TRACK flag.
+	if runtime.GOOS == "darwin" {
+		fmt.Println("SKIP: test follow forks is not supported on darwin")
+		return
+	}
+
+	pid := os.Getpid()
+
+	tw := newTestWatcher(t)
+	defer tw.close()
+
+	if err := tw.watcher.WatchTree(pid, PROC_EVENT_EXIT); err != nil {
+		t.Fatal(err)
+	}
+
+	// sh -> sh -> sleep and sh -> sleep, the trailing true
+	// keeps the shells from exec'ing their last command
+	cmd := exec.Command("sh", "-c", "sh -c 'sleep 100; true' & sleep 100; true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	members := func() []int {
+		tw.watcher.watchesMutex.Lock()
+		defer tw.watcher.watchesMutex.Unlock()
+
+		var pids []int
+		for member := range tw.watcher.trees {
+			pids = append(pids, member)
+		}
+		return pids
+	}
+	descendants := members()
+	if len(descendants) != 5 {
+		t.Errorf("Expected the test process and 4 descendants in the tree, got=%v", descendants)
+	}
+
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	cmd.Wait()
+	time.Sleep(500 * time.Millisecond)
+
+	if remaining := members(); len(remaining) != 1 || remaining[0] != pid {
+		t.Errorf("Expected only the test process in the tree, got=%v", remaining)
+	}
+	exited := make(map[int]bool)
+	for _, epid := range tw.events.getExits() {
+		exited[epid] = true
+	}
+	for _, member := range descendants {
+		if member != pid && !exited[member] {
+			t.Errorf("Expected an exit event for pid=%d", member)
+		}
+	}
+
+	if err := tw.watcher.RemoveWatch(pid); err != nil {
+		t.Error(err)
+	}
+	if remaining := members(); len(remaining) != 0 {
+		t.Errorf("Expected an empty tree, got=%v", remaining)
+	}
+}
+
+func TestWatchAll(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	// started before the watcher, it never forks nor execs afterwards
+	cmd := startSleepCommand(t)
+	childPid := cmd.Process.Pid
+
+	tw := newTestWatcher(t)
+
+	if err := tw.watcher.WatchAll(PROC_EVENT_EXIT); err != nil {
+		if runtime.GOOS == "linux" {
+			t.Fatal(err)
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+		tw.close()
+		return
+	}
+
+	// the running processes are watched by pid, not just by the wildcard
+	if err := tw.watcher.RemoveWatch(-1); err != nil {
+		t.Error(err)
+	}
+
+	syscall.Kill(childPid, syscall.SIGTERM)
+
+	cmd.Wait()
+
+	tw.close()
+
+	found := false
+	for _, pid := range tw.events.getExits() {
+		if pid == childPid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected an exit event for %d, got=%v", childPid, tw.events.getExits())
+	}
+}
+
+func TestCloseWithFullChannels(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	watcher, err := NewWatcherBuffered(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_ALL); err != nil {
+		t.Error(err)
+	}
+
+	// nobody reads the events, the read loop blocks on the first one
+	runCommand(t, "date")
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- watcher.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on an undelivered event")
+	}
+}
+
+func TestWatchReportsDrops(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	if runtime.GOOS != "linux" {
+		fmt.Println("SKIP: test drops is only supported on linux")
+		return
+	}
+
+	opts := WatcherOptions{BufferSize: 0, ReportDrops: true}
+	watcher, err := NewWatcherWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	// the kernel rounds the size up to its minimum
+	if err := watcher.SetBufferSize(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_ALL); err != nil {
+		t.Error(err)
+	}
+
+	// nobody reads the first exit, events pile up in the socket buffer
+	for i := 0; i < 50; i++ {
+		runCommand(t, "true")
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case <-watcher.Fork:
+		case <-watcher.Exec:
+		case <-watcher.Exit:
+		case err := <-watcher.Error:
+			if err != ErrEventsDropped {
+				t.Fatal(err)
+			}
+			if watcher.Dropped() == 0 {
+				t.Error("Expected the dropped counter to be incremented")
+			}
+			return
+		case <-timeout:
+			t.Fatal("Expected ErrEventsDropped to be reported")
+		}
+	}
+}
+
+func TestWatcherContextCancel(t *testing.T) {
+	if skipTest(t) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	watcher, err := NewWatcherContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_EXIT); err != nil {
+		t.Error(err)
+	}
+
+	cancel()
+
+	// the event channels are closed once the watcher shut down
+	select {
+	case _, ok := <-watcher.Exit:
+		if ok {
+			t.Error("Expected the exit channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher was not closed after the context was cancelled")
+	}
+
+	if err := watcher.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_EXIT); err == nil {
+		t.Error("Expected Watch to fail on a closed watcher")
+	}
+}
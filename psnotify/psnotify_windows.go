@@ -1,25 +1,431 @@
-// windows stub function
-
+// Go interface to Windows process events.
+//
+// Windows has no fork/exec split, a new process is reported as both a fork
+// of its parent and an exec of itself. The events are delivered by a WMI
+// event subscription filtered on the watched pids: the Win32_ProcessTrace
+// events, which the kernel sends for every process start and stop, and
+// when the caller is not allowed to receive those, which needs
+// administrator rights, the __InstanceCreationEvent and
+// __InstanceDeletionEvent of Win32_Process. WMI checks for the latter every
+// instanceWithin seconds, processes that live shorter than that can be
+// missed.
 package psnotify
 
 import (
-	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
 )
 
-// Initialize linux implementation of the eventListener interface
-func createListener() (eventListener, error) {
-	return nil, errors.New("Not support windows yet!")
+const (
+	// Flags
+	PROC_EVENT_FORK = 0x00000001 // process creation, sent for the parent
+	PROC_EVENT_EXEC = 0x00000002 // process creation, sent for the new process
+	PROC_EVENT_EXIT = 0x80000000 // process termination
+
+	// Watch the children of a process with the same flags
+	PROC_EVENT_FOLLOW = 0x01000000
+
+	// Watch for all process events
+	PROC_EVENT_ALL = PROC_EVENT_FORK | PROC_EVENT_EXEC | PROC_EVENT_EXIT |
+		PROC_EVENT_FOLLOW
+)
+
+// How long to wait for the next WMI event before checking whether the
+// watcher is closed or the watches changed. Watcher.Close() waits up to
+// this long.
+const eventTimeout = time.Second
+
+// Polling interval of the Win32_Process instance events, in seconds
+const instanceWithin = 1
+
+const (
+	// OpenProcess() access right (from <winnt.h>)
+	processQueryLimitedInformation = 0x1000
+
+	errorInvalidParameter syscall.Errno = 87 // ERROR_INVALID_PARAMETER
+)
+
+const (
+	sFalse          = 0x00000001 // COM is already initialized on the thread
+	wbemErrTimedout = 0x80043001 // NextEvent timed out
+)
+
+// Offset of the Unix epoch from January 1, 1601, the epoch of the WMI
+// event times, in 100-nanosecond intervals
+const filetimeEpoch = 116444736000000000
+
+type wmiListener struct {
+	pids    map[int]bool // Registered pids, -1 for any process
+	changed bool         // Whether pids changed since the last subscription
+	m       sync.Mutex
 }
 
-func (w *Watcher) readEvents() {
+// WMI connection and event subscription, they are only
+// used by the thread of the readEvents() goroutine.
+type wmiSession struct {
+	service *ole.VARIANT // SWbemServices
+	source  *ole.VARIANT // SWbemEventSource, nil when nothing is watched
+	trace   bool         // Whether source receives Win32_ProcessTrace events
 }
 
-// Delete filter for given pid from the queue
+// Initialize windows implementation of the eventListener interface
+func createListener() (eventListener, error) {
+	listener := &wmiListener{
+		pids: make(map[int]bool),
+	}
+	return listener, nil
+}
+
+// Remove pid from the WMI subscription filter
 func (w *Watcher) unregister(pid int) error {
+	listener, _ := w.listener.(*wmiListener)
+
+	listener.m.Lock()
+	defer listener.m.Unlock()
+
+	delete(listener.pids, pid)
+	listener.changed = true
 	return nil
 }
 
-// noop on linux
+// Add pid to the WMI subscription filter
 func (w *Watcher) register(pid int, flags uint32) error {
+	listener, _ := w.listener.(*wmiListener)
+
+	listener.m.Lock()
+	defer listener.m.Unlock()
+
+	listener.pids[pid] = true
+	listener.changed = true
+	return nil
+}
+
+// Build the WQL condition selecting the events of the watched processes
+// and their children, pidField and ppidField name the pid properties of
+// the events. Returns false when nothing is watched.
+func (listener *wmiListener) filter(pidField, ppidField string) (string, bool) {
+	listener.m.Lock()
+	defer listener.m.Unlock()
+
+	listener.changed = false
+	if len(listener.pids) == 0 {
+		return "", false
+	}
+	if listener.pids[-1] {
+		return "", true
+	}
+
+	clauses := make([]string, 0, 2*len(listener.pids))
+	for pid := range listener.pids {
+		clauses = append(clauses,
+			fmt.Sprintf("%s = %d", pidField, pid),
+			fmt.Sprintf("%s = %d", ppidField, pid))
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", true
+}
+
+// Whether the watches changed since the last call to filter()
+func (listener *wmiListener) hasChanged() bool {
+	listener.m.Lock()
+	defer listener.m.Unlock()
+
+	return listener.changed
+}
+
+// Make the readEvents() loop subscribe again
+func (listener *wmiListener) setChanged() {
+	listener.m.Lock()
+	defer listener.m.Unlock()
+
+	listener.changed = true
+}
+
+// The WMI listener has no receive buffer to resize
+func (w *Watcher) setBufferSize(size int) error {
+	return fmt.Errorf("psnotify: SetBufferSize is not supported on %s", runtime.GOOS)
+}
+
+// Only the events of the watched processes are subscribed to
+func (w *Watcher) canWatchNames() error {
+	return fmt.Errorf("psnotify: WatchName is not supported on %s", runtime.GOOS)
+}
+
+// Whether pid is running, for Ignore(): the WMI filter accepts
+// any pid. OpenProcess() fails with ERROR_INVALID_PARAMETER for
+// a pid that is not running and with ERROR_ACCESS_DENIED for
+// the protected processes, which do exist.
+func processExists(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return err != errorInvalidParameter
+	}
+	syscall.CloseHandle(h)
+	return true
+}
+
+// With the -1 wildcard the events of every process
+// are subscribed to, including the exits.
+func existingPids() ([]int, error) {
+	return nil, nil
+}
+
+// Read WMI events and dispatch to the Event channels
+func (w *Watcher) readEvents() {
+	listener, _ := w.listener.(*wmiListener)
+
+	// COM is initialized for the thread, not the goroutine
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var session *wmiSession
+	for {
+		if w.isDone() {
+			break
+		}
+
+		if session == nil {
+			var err error
+			if session, err = connectWMI(); err != nil {
+				w.sendError(err)
+				time.Sleep(eventTimeout)
+				continue
+			}
+			listener.setChanged()
+		}
+
+		if listener.hasChanged() {
+			if err := session.subscribe(listener); err != nil {
+				// retried after eventTimeout
+				listener.setChanged()
+				w.sendError(err)
+			}
+		}
+		if session.source == nil {
+			time.Sleep(eventTimeout)
+			continue
+		}
+
+		if err := w.nextEvent(session); err != nil {
+			w.sendError(err)
+		}
+	}
+
+	if session != nil {
+		session.close()
+	}
+	close(w.breakLoop)
+}
+
+// Wait for the next event of the subscription and handle it
+func (w *Watcher) nextEvent(session *wmiSession) error {
+	eventRaw, err := oleutil.CallMethod(session.source.ToIDispatch(), "NextEvent",
+		int(eventTimeout/time.Millisecond))
+	if err != nil {
+		if isTimeout(err) {
+			return nil
+		}
+		return fmt.Errorf("wmi NextEvent failed: %v", err)
+	}
+	defer eventRaw.Clear()
+
+	class, pid, ppid, timestamp, err := session.readEvent(eventRaw.ToIDispatch())
+	if err != nil {
+		return err
+	}
+
+	switch class {
+	case "Win32_ProcessStartTrace", "__InstanceCreationEvent":
+		if w.isWatching(ppid, PROC_EVENT_FOLLOW) {
+			// follow forks
+			if flags, ok := w.watchFlags(ppid); ok {
+				w.Watch(pid, flags)
+				w.addChild(ppid, pid)
+			}
+		}
+		if w.isWatching(ppid, PROC_EVENT_FORK) {
+			w.emit(&ProcEventFork{ParentPid: ppid, ChildPid: pid, Timestamp: timestamp})
+		}
+		if w.isWatching(ppid, PROC_EVENT_EXEC) || w.isWatching(pid, PROC_EVENT_EXEC) {
+			w.emit(&ProcEventExec{Pid: pid, Timestamp: timestamp})
+		}
+	case "Win32_ProcessStopTrace", "__InstanceDeletionEvent":
+		if w.handleExit(pid) {
+			w.emit(&ProcEventExit{Pid: pid, Timestamp: timestamp})
+		}
+	}
+	return nil
+}
+
+// Connect to the root\cimv2 WMI namespace of the local computer
+func connectWMI() (*wmiSession, error) {
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		oleErr, ok := err.(*ole.OleError)
+		if !ok || oleErr.Code() != sFalse {
+			return nil, fmt.Errorf("CoInitializeEx failed: %v", err)
+		}
+	}
+
+	unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		ole.CoUninitialize()
+		return nil, fmt.Errorf("wmi CreateObject failed: %v", err)
+	}
+	defer unknown.Release()
+
+	locator, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		ole.CoUninitialize()
+		return nil, fmt.Errorf("wmi QueryInterface failed: %v", err)
+	}
+	defer locator.Release()
+
+	service, err := oleutil.CallMethod(locator, "ConnectServer")
+	if err != nil {
+		ole.CoUninitialize()
+		return nil, fmt.Errorf("wmi ConnectServer failed: %v", err)
+	}
+	return &wmiSession{service: service}, nil
+}
+
+// Replace the event subscription with one for the current watches. The
+// Win32_ProcessTrace events are tried first, and the instance events of
+// Win32_Process when that subscription fails, as it does without
+// administrator rights.
+func (session *wmiSession) subscribe(listener *wmiListener) error {
+	session.cancel()
+
+	cond, ok := listener.filter("ProcessID", "ParentProcessID")
+	if !ok {
+		return nil
+	}
+	q := "SELECT * FROM Win32_ProcessTrace"
+	if cond != "" {
+		q += " WHERE " + cond
+	}
+	source, err := oleutil.CallMethod(session.service.ToIDispatch(), "ExecNotificationQuery", q)
+	if err == nil {
+		session.source, session.trace = source, true
+		return nil
+	}
+
+	cond, _ = listener.filter("TargetInstance.ProcessId", "TargetInstance.ParentProcessId")
+	q = fmt.Sprintf("SELECT * FROM __InstanceOperationEvent WITHIN %d "+
+		"WHERE (__Class = '__InstanceCreationEvent' OR __Class = '__InstanceDeletionEvent') "+
+		"AND TargetInstance ISA 'Win32_Process'", instanceWithin)
+	if cond != "" {
+		q += " AND " + cond
+	}
+	source, err = oleutil.CallMethod(session.service.ToIDispatch(), "ExecNotificationQuery", q)
+	if err != nil {
+		return fmt.Errorf("wmi ExecNotificationQuery for Win32_Process failed: %v", err)
+	}
+	session.source, session.trace = source, false
+	return nil
+}
+
+// Read the class, the pid and parent pid of the process
+// and the time of a Win32_ProcessTrace or instance event
+func (session *wmiSession) readEvent(event *ole.IDispatch) (string, int, int, time.Time, error) {
+	pathRaw, err := oleutil.GetProperty(event, "Path_")
+	if err != nil {
+		return "", 0, 0, time.Time{}, fmt.Errorf("wmi event Path_ failed: %v", err)
+	}
+	defer pathRaw.Clear()
+	classRaw, err := oleutil.GetProperty(pathRaw.ToIDispatch(), "Class")
+	if err != nil {
+		return "", 0, 0, time.Time{}, fmt.Errorf("wmi event class failed: %v", err)
+	}
+	defer classRaw.Clear()
+
+	created, err := intProperty(event, "TIME_CREATED")
+	if err != nil {
+		return "", 0, 0, time.Time{}, err
+	}
+	timestamp := time.Unix(0, (created-filetimeEpoch)*100)
+
+	process, pidField, ppidField := event, "ProcessID", "ParentProcessID"
+	if !session.trace {
+		instanceRaw, err := oleutil.GetProperty(event, "TargetInstance")
+		if err != nil {
+			return "", 0, 0, time.Time{}, fmt.Errorf("wmi event TargetInstance failed: %v", err)
+		}
+		defer instanceRaw.Clear()
+		process, pidField, ppidField = instanceRaw.ToIDispatch(), "ProcessId", "ParentProcessId"
+	}
+
+	pid, err := intProperty(process, pidField)
+	if err != nil {
+		return "", 0, 0, time.Time{}, err
+	}
+	ppid, err := intProperty(process, ppidField)
+	if err != nil {
+		return "", 0, 0, time.Time{}, err
+	}
+	return classRaw.ToString(), int(pid), int(ppid), timestamp, nil
+}
+
+// Read an integer property, WMI scripting returns the uint64 ones as strings
+func intProperty(obj *ole.IDispatch, name string) (int64, error) {
+	raw, err := oleutil.GetProperty(obj, name)
+	if err != nil {
+		return 0, fmt.Errorf("wmi event %s failed: %v", name, err)
+	}
+	defer raw.Clear()
+
+	switch v := raw.Value().(type) {
+	case int32:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("wmi event %s: %v", name, err)
+		}
+		return int64(n), nil
+	default:
+		return 0, fmt.Errorf("wmi event %s has unexpected type %T", name, v)
+	}
+}
+
+// Whether err is the timeout of SWbemEventSource.NextEvent
+func isTimeout(err error) bool {
+	oleErr, ok := err.(*ole.OleError)
+	if !ok {
+		return false
+	}
+	info, ok := oleErr.SubError().(ole.EXCEPINFO)
+	return ok && info.SCODE() == wbemErrTimedout
+}
+
+// Release the event subscription
+func (session *wmiSession) cancel() {
+	if session.source != nil {
+		session.source.Clear()
+		session.source = nil
+	}
+}
+
+// Release the subscription and the connection
+func (session *wmiSession) close() {
+	session.cancel()
+	session.service.Clear()
+	ole.CoUninitialize()
+}
+
+// The WMI connection is owned and released by the readEvents() goroutine
+func (listener *wmiListener) close() error {
 	return nil
 }
@@ -0,0 +1,81 @@
+// +build windows
+
+package psnotify
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestWatchChildExecAndExit(t *testing.T) {
+	watcher, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Watch(os.Getpid(), PROC_EVENT_ALL); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("ping", "-n", "3", "127.0.0.1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	child := cmd.Process.Pid
+	// release the process handle as soon as it exits
+	go cmd.Wait()
+
+	var forked, execed, exited bool
+	timeout := time.After(30 * time.Second)
+	for !exited {
+		select {
+		case ev := <-watcher.Fork:
+			if ev.ChildPid == child {
+				forked = true
+			}
+		case ev := <-watcher.Exec:
+			if ev.Pid == child {
+				execed = true
+			}
+		case ev := <-watcher.Exit:
+			if ev.Pid == child {
+				exited = true
+			}
+		case err := <-watcher.Error:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("timed out, fork=%v exec=%v exit=%v", forked, execed, exited)
+		}
+	}
+
+	if !forked {
+		t.Errorf("no fork event for %d", child)
+	}
+	if !execed {
+		t.Errorf("no exec event for %d", child)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	listener := &wmiListener{pids: make(map[int]bool)}
+	if _, ok := listener.filter("ProcessID", "ParentProcessID"); ok {
+		t.Error("filter without watches")
+	}
+
+	listener.pids[42] = true
+	cond, ok := listener.filter("TargetInstance.ProcessId", "TargetInstance.ParentProcessId")
+	if want := "(TargetInstance.ProcessId = 42 OR TargetInstance.ParentProcessId = 42)"; !ok || cond != want {
+		t.Errorf("filter = %q, %v, want %q", cond, ok, want)
+	}
+	if listener.hasChanged() {
+		t.Error("changed after filter")
+	}
+
+	listener.pids[-1] = true
+	if cond, ok := listener.filter("ProcessID", "ParentProcessID"); !ok || cond != "" {
+		t.Errorf("wildcard filter = %q, %v", cond, ok)
+	}
+}
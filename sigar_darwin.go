@@ -12,6 +12,7 @@ package gosigar
 #include <libproc.h>
 #include <mach/processor_info.h>
 #include <mach/vm_map.h>
+#include <mach/mach_time.h>
 */
 import "C"
 
@@ -23,6 +24,7 @@ import (
 	"os/user"
 	"runtime"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -88,6 +90,14 @@ func (self *Swap) Get() error {
 	self.Used = sw_usage.Used
 	self.Free = sw_usage.Avail
 
+	var vmstat C.vm_statistics64_data_t
+	if err := vm_info64(&vmstat); err != nil {
+		return err
+	}
+
+	self.PageIn = uint64(vmstat.swapins)
+	self.PageOut = uint64(vmstat.swapouts)
+
 	return nil
 }
 
@@ -95,6 +105,107 @@ func (self *HugeTLBPages) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *ProcMaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcCaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcDiskIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetProtoStats) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *SwapDeviceList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+// numCpu returns the number of available CPUs from hw.activecpu and the
+// number of CPUs of the machine from hw.ncpu
+func numCpu() (online, possible int, err error) {
+	var active, ncpu uint32
+	if err := sysctlbyname("hw.activecpu", &active); err != nil {
+		return 0, 0, err
+	}
+	if err := sysctlbyname("hw.ncpu", &ncpu); err != nil {
+		return 0, 0, err
+	}
+	return int(active), int(ncpu), nil
+}
+
+func getPressure() (cpu, mem, io PressureStall, err error) {
+	return PressureStall{}, PressureStall{}, PressureStall{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceName(major, minor int) (string, error) {
+	return "", ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcFDs) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcThreads) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *FanList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *BatteryList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *TemperatureList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NumaNodeList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuTopology) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcStatus) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcCred) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcNetConnections) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetConnectionList) Get(NetConnFlags) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuFreq) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (self *Cpu) Get() error {
 	var count C.mach_msg_type_number_t = C.HOST_CPU_LOAD_INFO_COUNT
 	var cpuload C.host_cpu_load_info_data_t
@@ -148,6 +259,11 @@ func (self *CpuList) Get() error {
 
 	bbuf := bytes.NewBuffer(buf)
 
+	running, err := cpusRunning()
+	if err != nil {
+		return err
+	}
+
 	self.List = make([]Cpu, 0, ncpu)
 
 	for i := 0; i < int(ncpu); i++ {
@@ -163,12 +279,47 @@ func (self *CpuList) Get() error {
 		cpu.Idle = uint64(cpu_ticks[C.CPU_STATE_IDLE])
 		cpu.Nice = uint64(cpu_ticks[C.CPU_STATE_NICE])
 
+		// offline CPUs keep their last counters, skip them like
+		// /proc/stat does on Linux
+		if i < len(running) && !running[i] {
+			continue
+		}
 		self.List = append(self.List, cpu)
 	}
 
 	return nil
 }
 
+// cpusRunning tells which processors are online, in the order of
+// host_processor_info.
+func cpusRunning() ([]bool, error) {
+	var count C.mach_msg_type_number_t
+	var info *C.processor_basic_info_data_t
+	var ncpu C.natural_t
+
+	status := C.host_processor_info(C.host_t(C.mach_host_self()),
+		C.PROCESSOR_BASIC_INFO,
+		&ncpu,
+		(*C.processor_info_array_t)(unsafe.Pointer(&info)),
+		&count)
+
+	if status != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("host_processor_info error=%d", status)
+	}
+
+	target := C.vm_map_t(C.mach_task_self_)
+	address := C.vm_address_t(uintptr(unsafe.Pointer(info)))
+	size := C.vm_size_t(uintptr(count) * unsafe.Sizeof(C.integer_t(0)))
+	defer C.vm_deallocate(target, address, size)
+
+	infos := (*[1 << 16]C.processor_basic_info_data_t)(unsafe.Pointer(info))[:ncpu:ncpu]
+	running := make([]bool, len(infos))
+	for i := range infos {
+		running[i] = infos[i].running != 0
+	}
+	return running, nil
+}
+
 func (self *FDUsage) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
@@ -269,6 +420,8 @@ func (self *ProcState) Get(pid int) error {
 
 	self.Nice = int(info.pbsd.pbi_nice)
 
+	self.NumThreads = int(info.ptinfo.pti_threadnum)
+
 	// Get process username. Fallback to UID if username is not available.
 	uid := strconv.Itoa(int(info.pbsd.pbi_uid))
 	user, err := user.LookupId(uid)
@@ -292,6 +445,9 @@ func (self *ProcMem) Get(pid int) error {
 	self.Resident = uint64(info.ptinfo.pti_resident_size)
 	self.PageFaults = uint64(info.ptinfo.pti_faults)
 
+	// the task info has no swap usage nor segment sizes,
+	// they are left zero
+
 	return nil
 }
 
@@ -303,10 +459,10 @@ func (self *ProcTime) Get(pid int) error {
 	}
 
 	self.User =
-		uint64(info.ptinfo.pti_total_user) / uint64(time.Millisecond)
+		machTimeToNanos(uint64(info.ptinfo.pti_total_user)) / uint64(time.Millisecond)
 
 	self.Sys =
-		uint64(info.ptinfo.pti_total_system) / uint64(time.Millisecond)
+		machTimeToNanos(uint64(info.ptinfo.pti_total_system)) / uint64(time.Millisecond)
 
 	self.Total = self.User + self.Sys
 
@@ -343,6 +499,15 @@ func (self *ProcEnv) Get(pid int) error {
 }
 
 func (self *ProcExe) Get(pid int) error {
+	// proc_pidpath also resolves the processes of other users,
+	// whose arguments are denied
+	buf := make([]byte, C.PROC_PIDPATHINFO_MAXSIZE)
+	n := C.proc_pidpath(C.int(pid), unsafe.Pointer(&buf[0]), C.uint32_t(len(buf)))
+	if n > 0 {
+		self.Name = string(buf[:n])
+		return nil
+	}
+
 	exe := func(arg string) {
 		self.Name = arg
 	}
@@ -366,8 +531,13 @@ func kern_procargs(pid int,
 	argmax := uintptr(C.ARG_MAX)
 	buf := make([]byte, argmax)
 	err := sysctl(mib, &buf[0], &argmax, nil, 0)
+	if err == syscall.EPERM || err == syscall.EINVAL {
+		// the arguments of the processes of
+		// other users are denied with EINVAL
+		return ErrNotPermitted{Path: fmt.Sprintf("kern.procargs2.%d", pid)}
+	}
 	if err != nil {
-		return nil
+		return err
 	}
 
 	bbuf := bytes.NewBuffer(buf)
@@ -466,6 +636,22 @@ func vm_info(vmstat *C.vm_statistics_data_t) error {
 	return nil
 }
 
+func vm_info64(vmstat *C.vm_statistics64_data_t) error {
+	var count C.mach_msg_type_number_t = C.HOST_VM_INFO64_COUNT
+
+	status := C.host_statistics64(
+		C.host_t(C.mach_host_self()),
+		C.HOST_VM_INFO64,
+		C.host_info64_t(unsafe.Pointer(vmstat)),
+		&count)
+
+	if status != C.KERN_SUCCESS {
+		return fmt.Errorf("host_statistics64=%d", status)
+	}
+
+	return nil
+}
+
 // generic Sysctl buffer unmarshalling
 func sysctlbyname(name string, data interface{}) (err error) {
 	val, err := syscall.Sysctl(name)
@@ -489,10 +675,37 @@ func task_info(pid int, info *C.struct_proc_taskallinfo) error {
 	size := C.int(unsafe.Sizeof(*info))
 	ptr := unsafe.Pointer(info)
 
-	n := C.proc_pidinfo(C.int(pid), C.PROC_PIDTASKALLINFO, 0, ptr, size)
+	n, err := C.proc_pidinfo(C.int(pid), C.PROC_PIDTASKALLINFO, 0, ptr, size)
 	if n != size {
+		if err == syscall.ESRCH {
+			return ErrProcessNotFound
+		}
+		if err == syscall.EPERM {
+			// the task info of the processes of other
+			// users needs root
+			return ErrNotPermitted{Path: fmt.Sprintf("proc_pidinfo.%d", pid)}
+		}
 		return fmt.Errorf("Could not read process info for pid %d", pid)
 	}
 
 	return nil
 }
+
+var (
+	timebase     C.mach_timebase_info_data_t
+	timebaseOnce sync.Once
+)
+
+// machTimeToNanos converts the CPU times of the task info, which are in
+// mach absolute time units: nanoseconds on Intel but not on Apple Silicon.
+func machTimeToNanos(t uint64) uint64 {
+	timebaseOnce.Do(func() {
+		if C.mach_timebase_info(&timebase) != C.KERN_SUCCESS || timebase.denom == 0 {
+			timebase.numer, timebase.denom = 1, 1
+		}
+	})
+	if timebase.numer == timebase.denom {
+		return t
+	}
+	return t * uint64(timebase.numer) / uint64(timebase.denom)
+}
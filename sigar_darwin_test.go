@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	sigar "github.com/elastic/gosigar"
 	"github.com/stretchr/testify/assert"
@@ -74,3 +77,65 @@ func TestDarwinProcState(t *testing.T) {
 		fmt.Println("Skipping ProcState test; run as root to test")
 	}
 }
+
+// The own process of the test can be read without root
+func TestDarwinProcSelf(t *testing.T) {
+	pid := os.Getpid()
+
+	state := sigar.ProcState{}
+	if assert.NoError(t, state.Get(pid)) {
+		assert.Equal(t, os.Getppid(), state.Ppid)
+		assert.True(t, state.NumThreads > 0, "NumThreads=%d", state.NumThreads)
+	}
+
+	mem := sigar.ProcMem{}
+	if assert.NoError(t, mem.Get(pid)) {
+		assert.True(t, mem.Resident > 0)
+		assert.True(t, mem.Size >= mem.Resident)
+	}
+
+	// burn 100ms of CPU, the times are in ms whatever the mach time units
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+	}
+	procTime := sigar.ProcTime{}
+	if assert.NoError(t, procTime.Get(pid)) {
+		assert.True(t, procTime.Total >= 50, "Total=%dms", procTime.Total)
+		assert.Equal(t, procTime.User+procTime.Sys, procTime.Total)
+	}
+
+	args := sigar.ProcArgs{}
+	if assert.NoError(t, args.Get(pid)) {
+		assert.Equal(t, os.Args, args.List)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, _ = filepath.EvalSymlinks(self)
+	exe := sigar.ProcExe{}
+	if assert.NoError(t, exe.Get(pid)) {
+		name, _ := filepath.EvalSymlinks(exe.Name)
+		assert.Equal(t, self, name)
+	}
+}
+
+func TestDarwinProcNotPermitted(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("test must be run as a regular user")
+	}
+
+	state := sigar.ProcState{}
+	err := state.Get(1)
+	assert.True(t, sigar.IsNotPermitted(err), "expected ErrNotPermitted, got %v", err)
+
+	args := sigar.ProcArgs{}
+	err = args.Get(1)
+	assert.True(t, sigar.IsNotPermitted(err), "expected ErrNotPermitted, got %v", err)
+
+	// the path of the executable is not restricted
+	exe := sigar.ProcExe{}
+	if assert.NoError(t, exe.Get(1)) {
+		assert.Equal(t, "/sbin/launchd", exe.Name)
+	}
+}
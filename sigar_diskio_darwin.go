@@ -0,0 +1,119 @@
+package gosigar
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework IOKit
+#include <stdint.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <IOKit/IOKitLib.h>
+#include <IOKit/IOBSD.h>
+#include <IOKit/storage/IOBlockStorageDriver.h>
+
+typedef struct {
+	char     name[64];
+	uint64_t reads;
+	uint64_t writes;
+	uint64_t read_bytes;
+	uint64_t write_bytes;
+	uint64_t read_time;  // nanoseconds
+	uint64_t write_time; // nanoseconds
+} disk_stats_t;
+
+static uint64_t dict_uint64(CFDictionaryRef dict, CFStringRef key) {
+	CFNumberRef num = (CFNumberRef)CFDictionaryGetValue(dict, key);
+	int64_t value = 0;
+
+	if (num != NULL) {
+		CFNumberGetValue(num, kCFNumberSInt64Type, &value);
+	}
+	return (uint64_t)value;
+}
+
+// Fill stats with up to max block storage drivers, returns the count or -1.
+static int disk_stats(disk_stats_t *stats, int max) {
+	io_iterator_t drives;
+	io_registry_entry_t drive;
+	int n = 0;
+
+	if (IOServiceGetMatchingServices(MACH_PORT_NULL,
+			IOServiceMatching(kIOBlockStorageDriverClass), &drives) != KERN_SUCCESS) {
+		return -1;
+	}
+
+	while (n < max && (drive = IOIteratorNext(drives)) != 0) {
+		io_registry_entry_t media;
+		CFMutableDictionaryRef props = NULL;
+		CFDictionaryRef statistics;
+		CFStringRef bsdName;
+
+		// the whole disk IOMedia below the driver carries the BSD name
+		if (IORegistryEntryGetChildEntry(drive, kIOServicePlane, &media) != KERN_SUCCESS) {
+			IOObjectRelease(drive);
+			continue;
+		}
+		bsdName = (CFStringRef)IORegistryEntryCreateCFProperty(media,
+			CFSTR(kIOBSDNameKey), kCFAllocatorDefault, 0);
+		IOObjectRelease(media);
+		if (bsdName == NULL) {
+			IOObjectRelease(drive);
+			continue;
+		}
+		CFStringGetCString(bsdName, stats[n].name, sizeof(stats[n].name), kCFStringEncodingUTF8);
+		CFRelease(bsdName);
+
+		if (IORegistryEntryCreateCFProperties(drive, &props, kCFAllocatorDefault, 0) != KERN_SUCCESS) {
+			IOObjectRelease(drive);
+			continue;
+		}
+		statistics = (CFDictionaryRef)CFDictionaryGetValue(props,
+			CFSTR(kIOBlockStorageDriverStatisticsKey));
+		if (statistics != NULL) {
+			stats[n].reads = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsReadsKey));
+			stats[n].writes = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsWritesKey));
+			stats[n].read_bytes = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsBytesReadKey));
+			stats[n].write_bytes = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsBytesWrittenKey));
+			stats[n].read_time = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsTotalReadTimeKey));
+			stats[n].write_time = dict_uint64(statistics, CFSTR(kIOBlockStorageDriverStatisticsTotalWriteTimeKey));
+			n++;
+		}
+		CFRelease(props);
+		IOObjectRelease(drive);
+	}
+	IOObjectRelease(drives);
+
+	return n;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"time"
+)
+
+// Upper bound of the disks listed by DiskIoList.Get()
+const maxDisks = 256
+
+// IOKit has statistics per storage driver, that is per whole disk,
+// so IncludePartitions has no effect.
+func (self *DiskIoList) Get() error {
+	var stats [maxDisks]C.disk_stats_t
+
+	n := C.disk_stats(&stats[0], maxDisks)
+	if n < 0 {
+		return errors.New("IOServiceGetMatchingServices failed for IOBlockStorageDriver")
+	}
+
+	self.List = make(map[string]DiskIo, int(n))
+	for _, s := range stats[:n] {
+		self.List[C.GoString(&s.name[0])] = DiskIo{
+			ReadOps:    uint64(s.reads),
+			WriteOps:   uint64(s.writes),
+			ReadBytes:  uint64(s.read_bytes),
+			WriteBytes: uint64(s.write_bytes),
+			ReadTime:   uint64(s.read_time) / uint64(time.Millisecond),
+			WriteTime:  uint64(s.write_time) / uint64(time.Millisecond),
+		}
+	}
+
+	return nil
+}
@@ -60,6 +60,9 @@ func FormatPercent(percent float64) string {
 }
 
 func (self *FileSystemUsage) UsePercent() float64 {
+	if self.Free > self.Total {
+		return 0.0
+	}
 	b_used := (self.Total - self.Free) / 1024
 	b_avail := self.Avail / 1024
 	utotal := b_used + b_avail
@@ -77,6 +80,33 @@ func (self *FileSystemUsage) UsePercent() float64 {
 	return 0.0
 }
 
+// ExceedsThreshold returns true if UsePercent reaches percent. A file
+// system reporting more space used than its size, like an overcommitted
+// network mount, exceeds every threshold.
+func (self *FileSystemUsage) ExceedsThreshold(percent float64) bool {
+	if self.Used > self.Total {
+		return true
+	}
+	return self.UsePercent() >= percent
+}
+
+// FilesUsed returns the number of inodes in use.
+func (self *FileSystemUsage) FilesUsed() uint64 {
+	if self.FreeFiles > self.Files {
+		return 0
+	}
+	return self.Files - self.FreeFiles
+}
+
+// FilesUsePercent returns the share of the inodes in use, or 0 for file
+// systems without a fixed number of inodes, like some network mounts.
+func (self *FileSystemUsage) FilesUsePercent() float64 {
+	if self.Files == 0 {
+		return 0.0
+	}
+	return float64(self.FilesUsed()) * 100.0 / float64(self.Files)
+}
+
 func (self *Uptime) Format() string {
 	buf := new(bytes.Buffer)
 	w := bufio.NewWriter(buf)
@@ -3,11 +3,16 @@
 package gosigar
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"unsafe"
+
+	"github.com/elastic/gosigar/sys"
+	"golang.org/x/sys/unix"
 )
 
 /*
@@ -16,6 +21,8 @@ import (
 #include <sys/ucred.h>
 #include <sys/types.h>
 #include <sys/sysctl.h>
+#include <sys/resource.h>
+#include <vm/vm_param.h>
 #include <stdlib.h>
 #include <stdint.h>
 #include <unistd.h>
@@ -73,7 +80,7 @@ func (self *FDUsage) Get() error {
 }
 
 func (self *ProcFDUsage) Get(pid int) error {
-	err := readFile("/proc/"+strconv.Itoa(pid)+"/rlimit", func(line string) bool {
+	err := readFile(procFileName(pid, "rlimit"), func(line string) bool {
 		if strings.HasPrefix(line, "nofile") {
 			fields := strings.Fields(line)
 			if len(fields) == 3 {
@@ -102,16 +109,224 @@ func (self *HugeTLBPages) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
-func parseCpuStat(self *Cpu, line string) error {
-	fields := strings.Fields(line)
+func (self *ProcMaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcCaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcDiskIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetProtoStats) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *SwapDeviceList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func numCpu() (online, possible int, err error) {
+	return 0, 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func getPressure() (cpu, mem, io PressureStall, err error) {
+	return PressureStall{}, PressureStall{}, PressureStall{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceName(major, minor int) (string, error) {
+	return "", ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcFDs) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcThreads) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *FanList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *BatteryList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *TemperatureList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NumaNodeList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuTopology) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcStatus) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcNetConnections) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetConnectionList) Get(NetConnFlags) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetIfaceStatList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *DiskIoList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuFreq) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *LoadAverage) Get() error {
+	buf, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		return err
+	}
+	if len(buf) < int(unsafe.Sizeof(C.struct_loadavg{})) {
+		return fmt.Errorf("unexpected vm.loadavg size %d", len(buf))
+	}
+
+	// the averages are fixed-point numbers scaled by fscale
+	avg := (*C.struct_loadavg)(unsafe.Pointer(&buf[0]))
+	scale := float64(avg.fscale)
+
+	self.One = float64(avg.ldavg[0]) / scale
+	self.Five = float64(avg.ldavg[1]) / scale
+	self.Fifteen = float64(avg.ldavg[2]) / scale
 
-	self.User, _ = strtoull(fields[1])
-	self.Nice, _ = strtoull(fields[2])
-	self.Sys, _ = strtoull(fields[3])
-	self.Idle, _ = strtoull(fields[4])
 	return nil
 }
 
+func (self *Swap) Get() error {
+	pagesize := uint64(os.Getpagesize())
+
+	// one struct xswdev per swap device, the sizes are in pages
+	for i := 0; ; i++ {
+		buf, err := unix.SysctlRaw("vm.swap_info", i)
+		if err == unix.ENOENT {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(buf) < int(unsafe.Sizeof(C.struct_xswdev{})) {
+			return fmt.Errorf("unexpected vm.swap_info size %d", len(buf))
+		}
+
+		xsw := (*C.struct_xswdev)(unsafe.Pointer(&buf[0]))
+		self.Total += uint64(xsw.xsw_nblks) * pagesize
+		self.Used += uint64(xsw.xsw_used) * pagesize
+	}
+	self.Free = self.Total - self.Used
+
+	pageIn, err := unix.SysctlUint32("vm.stats.vm.v_swappgsin")
+	if err != nil {
+		return err
+	}
+	pageOut, err := unix.SysctlUint32("vm.stats.vm.v_swappgsout")
+	if err != nil {
+		return err
+	}
+	self.PageIn = uint64(pageIn)
+	self.PageOut = uint64(pageOut)
+
+	return nil
+}
+
+func (self *Cpu) Get() error {
+	times, err := sysctlLongs("kern.cp_time")
+	if err != nil {
+		return err
+	}
+	if len(times) < C.CPUSTATES {
+		return fmt.Errorf("unexpected kern.cp_time length %d", len(times))
+	}
+	setCpTime(self, times)
+
+	return nil
+}
+
+func (self *CpuList) Get() error {
+	// kern.cp_times holds the kern.cp_time of every CPU
+	times, err := sysctlLongs("kern.cp_times")
+	if err != nil {
+		return err
+	}
+
+	list := make([]Cpu, 0, len(times)/C.CPUSTATES)
+	for ; len(times) >= C.CPUSTATES; times = times[C.CPUSTATES:] {
+		cpu := Cpu{}
+		setCpTime(&cpu, times)
+		list = append(list, cpu)
+	}
+
+	self.List = list
+
+	return nil
+}
+
+// setCpTime fills cpu from the CPUSTATES clock ticks of a kern.cp_time
+func setCpTime(cpu *Cpu, times []uint64) {
+	cpu.User = times[C.CP_USER]
+	cpu.Nice = times[C.CP_NICE]
+	cpu.Sys = times[C.CP_SYS]
+	cpu.Irq = times[C.CP_INTR]
+	cpu.Idle = times[C.CP_IDLE]
+}
+
+// sysctlLongs reads a sysctl holding an array of C longs
+func sysctlLongs(name string) ([]uint64, error) {
+	buf, err := unix.SysctlRaw(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLongs(buf, int(unsafe.Sizeof(C.long(0)))), nil
+}
+
+// decodeLongs decodes an array of size bytes integers in the
+// byte order of the host, a trailing partial integer is ignored
+func decodeLongs(buf []byte, size int) []uint64 {
+	order := sys.GetEndian()
+
+	vals := make([]uint64, 0, len(buf)/size)
+	for ; len(buf) >= size; buf = buf[size:] {
+		if size == 8 {
+			vals = append(vals, order.Uint64(buf))
+		} else {
+			vals = append(vals, uint64(order.Uint32(buf)))
+		}
+	}
+	return vals
+}
+
 func (self *Mem) Get() error {
 	val := C.uint32_t(0)
 	sc := C.size_t(4)
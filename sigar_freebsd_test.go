@@ -0,0 +1,54 @@
+package gosigar_test
+
+import (
+	"runtime"
+	"testing"
+
+	sigar "github.com/elastic/gosigar"
+	"github.com/stretchr/testify/assert"
+)
+
+// The sysctl readers do not need linprocfs
+
+func TestFreeBSDCpu(t *testing.T) {
+	cpu := sigar.Cpu{}
+	if assert.NoError(t, cpu.Get()) {
+		assert.True(t, cpu.Total() > 0)
+		assert.True(t, cpu.Idle > 0)
+	}
+
+	cpus := sigar.CpuList{}
+	if assert.NoError(t, cpus.Get()) {
+		assert.Len(t, cpus.List, runtime.NumCPU())
+	}
+}
+
+func TestFreeBSDLoadAverage(t *testing.T) {
+	avg := sigar.LoadAverage{}
+	if assert.NoError(t, avg.Get()) {
+		assert.True(t, avg.One >= 0)
+		assert.True(t, avg.Five >= 0)
+		assert.True(t, avg.Fifteen >= 0)
+	}
+}
+
+func TestFreeBSDMemAndSwap(t *testing.T) {
+	mem := sigar.Mem{}
+	if assert.NoError(t, mem.Get()) {
+		assert.True(t, mem.Total > 0)
+		assert.True(t, mem.Free <= mem.Total)
+	}
+
+	swap := sigar.Swap{}
+	if assert.NoError(t, swap.Get()) {
+		assert.True(t, swap.Used <= swap.Total)
+		assert.Equal(t, swap.Total-swap.Used, swap.Free)
+	}
+}
+
+func TestFreeBSDUptime(t *testing.T) {
+	uptime := sigar.Uptime{}
+	if assert.NoError(t, uptime.Get()) {
+		assert.True(t, uptime.Length > 0)
+	}
+}
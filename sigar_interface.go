@@ -1,6 +1,17 @@
 package gosigar
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -12,6 +23,12 @@ func (e ErrNotImplemented) Error() string {
 	return "not implemented on " + e.OS
 }
 
+// Is reports whether target is an ErrNotImplemented of any OS, so that
+// errors.Is(err, ErrNotImplemented{}) matches all of them.
+func (e ErrNotImplemented) Is(target error) bool {
+	return IsNotImplemented(target)
+}
+
 func IsNotImplemented(err error) bool {
 	switch err.(type) {
 	case ErrNotImplemented, *ErrNotImplemented:
@@ -21,26 +38,159 @@ func IsNotImplemented(err error) bool {
 	}
 }
 
+// ErrNotPermitted is returned when reading a metric requires privileges
+// the caller does not have, such as the I/O counters of another user's
+// process.
+type ErrNotPermitted struct {
+	Path string
+}
+
+func (e ErrNotPermitted) Error() string {
+	return "permission denied reading " + e.Path
+}
+
+// Is reports whether target is an ErrNotPermitted of any path, so that
+// errors.Is(err, ErrNotPermitted{}) matches all of them.
+func (e ErrNotPermitted) Is(target error) bool {
+	return IsNotPermitted(target)
+}
+
+func IsNotPermitted(err error) bool {
+	switch err.(type) {
+	case ErrNotPermitted, *ErrNotPermitted:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrProcessNotFound is returned by the Proc readers when the process
+// exited between listing it and reading it. It is syscall.ESRCH, which
+// the readers returned before, so that comparing with either works.
+var ErrProcessNotFound error = syscall.ESRCH
+
+// IsProcessNotFound returns true when err reports that the process, or one
+// of its threads, does not exist, like ErrProcessNotFound.
+func IsProcessNotFound(err error) bool {
+	switch e := err.(type) {
+	case syscall.Errno:
+		return e == syscall.ESRCH
+	case *os.PathError:
+		return e.Err == syscall.ESRCH
+	case *os.SyscallError:
+		return e.Err == syscall.ESRCH
+	default:
+		return false
+	}
+}
+
+// ErrTimeout is returned when reading a metric took longer than the
+// allowed Timeout, such as the usage of a hung network file system.
+type ErrTimeout struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("timeout after %v reading %s", e.Timeout, e.Path)
+}
+
+func IsTimeout(err error) bool {
+	switch err.(type) {
+	case ErrTimeout, *ErrTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrPartial is returned when only some of the values of a metric could be
+// read, the others are set. Errors holds the error of each value that
+// failed, by name.
+type ErrPartial struct {
+	Errors map[string]error
+}
+
+func (e ErrPartial) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e.Errors[name].Error()
+	}
+	return "partial read, failed " + strings.Join(msgs, ", ")
+}
+
+func IsPartial(err error) bool {
+	switch err.(type) {
+	case ErrPartial, *ErrPartial:
+		return true
+	default:
+		return false
+	}
+}
+
 type Sigar interface {
 	CollectCpuStats(collectionInterval time.Duration) (<-chan Cpu, chan<- struct{})
+	CollectCpuListStats(collectionInterval time.Duration) (<-chan CpuList, chan<- struct{})
+	GetCpuPercentage() (CpuPercent, error)
 	GetLoadAverage() (LoadAverage, error)
+	GetLoadAveragePercent() (LoadAverage, error)
+	GetUptime() (Uptime, error)
 	GetMem() (Mem, error)
 	GetSwap() (Swap, error)
-	GetHugeTLBPages(HugeTLBPages, error)
+	GetSwapDevices() ([]SwapDevice, error)
+	GetCpuList() (CpuList, error)
+	GetCpuFreq(core int) (CpuFreq, error)
+	GetCpuTopology() (CpuTopology, error)
+	GetNumaNodes() ([]NumaNode, error)
+	GetTemperatures() ([]Temperature, error)
+	GetFans() ([]Fan, error)
+	GetBatteries() ([]Battery, error)
+	GetHugeTLBPages() (HugeTLBPages, error)
+	GetHugePages() ([]HugePages, error)
+	GetFileSystemList() (FileSystemList, error)
 	GetFileSystemUsage(string) (FileSystemUsage, error)
+	GetFileSystemUsageTimeout(path string, timeout time.Duration) (FileSystemUsage, error)
+	GetFileSystemUsages(paths []string, timeout time.Duration) (map[string]FileSystemUsage, error)
+	GetFileSystemUsageByDevice(dev string) (FileSystemUsage, error)
+	GetDiskIoList() (DiskIoList, error)
+	GetNetIfaceStats() ([]NetIfaceStat, error)
+	GetNetProtoStats() (NetProtoStats, error)
+	GetNetConnections(flags NetConnFlags) ([]NetConnection, error)
+	GetProcNetConnections(pid int) ([]NetConnection, error)
+	GetProcList() ([]int, error)
+	GetProcListFiltered(f ProcFilter) ([]int, error)
+	GetProcArgs(pid int) ([]string, error)
+	GetProcCwd(pid int) (string, error)
+	GetProcRoot(pid int) (string, error)
 	GetFDUsage() (FDUsage, error)
 	GetRusage(who int) (Rusage, error)
+	GetProcStateBatch(pids []int) (map[int]ProcState, []error)
+	NumCpu() (online, possible int, err error)
+	GetPressure() (cpu, mem, io PressureStall, err error)
+	DeviceName(major, minor int) (string, error)
+	DeviceNumber(path string) (major, minor int, err error)
 }
 
 type Cpu struct {
-	User    uint64
-	Nice    uint64
-	Sys     uint64
-	Idle    uint64
-	Wait    uint64
-	Irq     uint64
-	SoftIrq uint64
-	Stolen  uint64
+	User    uint64 `json:"user"`
+	Nice    uint64 `json:"nice"`
+	Sys     uint64 `json:"sys"`
+	Idle    uint64 `json:"idle"`
+	Wait    uint64 `json:"wait"`
+	Irq     uint64 `json:"irq"`
+	SoftIrq uint64 `json:"softirq"`
+	Stolen  uint64 `json:"stolen"`
+
+	// Time spent running virtual CPUs of guests, on Linux. It is
+	// already accounted for in User and Nice, and not in Total().
+	Guest     uint64 `json:"guest"`
+	GuestNice uint64 `json:"guest_nice"`
 }
 
 func (cpu *Cpu) Total() uint64 {
@@ -58,150 +208,1370 @@ func (cpu Cpu) Delta(other Cpu) Cpu {
 		Irq:     cpu.Irq - other.Irq,
 		SoftIrq: cpu.SoftIrq - other.SoftIrq,
 		Stolen:  cpu.Stolen - other.Stolen,
+
+		Guest:     cpu.Guest - other.Guest,
+		GuestNice: cpu.GuestNice - other.GuestNice,
+	}
+}
+
+// CpuPercent holds the share of CPU time spent in each state
+// over an interval, in percent.
+type CpuPercent struct {
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	Sys     float64 `json:"sys"`
+	Idle    float64 `json:"idle"`
+	Wait    float64 `json:"wait"`
+	Irq     float64 `json:"irq"`
+	SoftIrq float64 `json:"softirq"`
+	Stolen  float64 `json:"stolen"`
+}
+
+// Busy returns the share of time not spent idle.
+func (p CpuPercent) Busy() float64 {
+	return p.User + p.Nice + p.Sys + p.Wait + p.Irq + p.SoftIrq + p.Stolen
+}
+
+// DeltaPercent returns the CPU usage between the prev sample and a
+// later cur sample. It returns zeros when a counter went backwards,
+// e.g. after a counter reset or when a CPU went offline.
+func (prev Cpu) DeltaPercent(cur Cpu) CpuPercent {
+	if cur.User < prev.User || cur.Nice < prev.Nice || cur.Sys < prev.Sys ||
+		cur.Idle < prev.Idle || cur.Wait < prev.Wait || cur.Irq < prev.Irq ||
+		cur.SoftIrq < prev.SoftIrq || cur.Stolen < prev.Stolen ||
+		cur.Guest < prev.Guest || cur.GuestNice < prev.GuestNice {
+		return CpuPercent{}
+	}
+
+	delta := cur.Delta(prev)
+	total := float64(delta.Total())
+	if total == 0 {
+		return CpuPercent{}
+	}
+
+	percent := func(ticks uint64) float64 {
+		return float64(ticks) * 100 / total
+	}
+
+	return CpuPercent{
+		User:    percent(delta.User),
+		Nice:    percent(delta.Nice),
+		Sys:     percent(delta.Sys),
+		Idle:    percent(delta.Idle),
+		Wait:    percent(delta.Wait),
+		Irq:     percent(delta.Irq),
+		SoftIrq: percent(delta.SoftIrq),
+		Stolen:  percent(delta.Stolen),
 	}
 }
 
 type LoadAverage struct {
-	One, Five, Fifteen float64
+	One     float64 `json:"one"`
+	Five    float64 `json:"five"`
+	Fifteen float64 `json:"fifteen"`
+
+	// Scheduling entities, on Linux only
+	Runnable uint64 `json:"runnable"` // Currently runnable
+	Total    uint64 `json:"total"`    // Existing
+	LastPid  int    `json:"last_pid"` // Most recently created
+}
+
+// PerCpu returns the load averages divided by ncpu, 1 meaning that every
+// CPU is busy, the counts are unchanged. A ncpu below 1 is taken as a
+// single CPU.
+func (l LoadAverage) PerCpu(ncpu int) LoadAverage {
+	if ncpu < 1 {
+		ncpu = 1
+	}
+	n := float64(ncpu)
+	l.One /= n
+	l.Five /= n
+	l.Fifteen /= n
+	return l
 }
 
+// Uptime holds the time since the system booted. Idle is the sum of the
+// idle time of every CPU, it is only read on Linux.
 type Uptime struct {
-	Length float64
+	Length float64 `json:"length"` // Seconds since boot
+	Idle   float64 `json:"idle"`   // Seconds the CPUs were idle since boot
+}
+
+// IdlePerCpu returns the Idle seconds divided by ncpu, the time an average
+// CPU was idle. Divided by Length it is the idle share since boot. A ncpu
+// below 1 is taken as a single CPU.
+func (u Uptime) IdlePerCpu(ncpu int) float64 {
+	if ncpu < 1 {
+		ncpu = 1
+	}
+	return u.Idle / float64(ncpu)
+}
+
+var (
+	cachedBootTime     time.Time
+	cachedBootTimeLock sync.Mutex
+)
+
+// BootTime returns when the system booted, derived from the uptime and
+// the wall clock. It is computed once, to the second, so it does not
+// drift between calls; later changes of the wall clock are not followed.
+func BootTime() (time.Time, error) {
+	cachedBootTimeLock.Lock()
+	defer cachedBootTimeLock.Unlock()
+
+	if cachedBootTime.IsZero() {
+		uptime := Uptime{}
+		if err := uptime.Get(); err != nil {
+			return time.Time{}, err
+		}
+		length := time.Duration(uptime.Length * float64(time.Second))
+		cachedBootTime = time.Now().Add(-length).Round(time.Second)
+	}
+	return cachedBootTime, nil
 }
 
 type Mem struct {
-	Total      uint64
-	Used       uint64
-	Free       uint64
-	ActualFree uint64
-	ActualUsed uint64
+	Total      uint64 `json:"total"`
+	Used       uint64 `json:"used"`
+	Free       uint64 `json:"free"`
+	ActualFree uint64 `json:"actual_free"`
+	ActualUsed uint64 `json:"actual_used"`
+
+	// Breakdown of the memory from /proc/meminfo, on Linux. Available
+	// is the kernel's estimate of MemAvailable, 0 before Linux 3.14.
+	Buffers      uint64 `json:"buffers"`
+	Cached       uint64 `json:"cached"`
+	SReclaimable uint64 `json:"sreclaimable"`
+	Available    uint64 `json:"available"`
 }
 
 type Swap struct {
-	Total uint64
-	Used  uint64
-	Free  uint64
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+	Free  uint64 `json:"free"`
+
+	// Pages swapped in and out since boot, on Linux and Darwin. They
+	// only grow, compare two samples to get the swap activity.
+	PageIn  uint64 `json:"page_in"`
+	PageOut uint64 `json:"page_out"`
+}
+
+// SwapDevice is a swap partition or file, with its sizes in bytes.
+// Devices with a higher Priority are used first.
+type SwapDevice struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // partition or file
+	Size     uint64 `json:"size"`
+	Used     uint64 `json:"used"`
+	Priority int    `json:"priority"`
+}
+
+// SwapDeviceList lists the active swap areas, it is empty without swap.
+type SwapDeviceList struct {
+	List []SwapDevice `json:"list"`
+}
+
+// PressureStall is the pressure stall information of a resource: the
+// share of time, in percent, in which some or all of the non-idle tasks
+// were stalled waiting for it, averaged over 10, 60 and 300 seconds, and
+// the total stall time in microseconds. Full is zero for the CPU before
+// Linux 5.13.
+type PressureStall struct {
+	Some10    float64 `json:"some10"`
+	Some60    float64 `json:"some60"`
+	Some300   float64 `json:"some300"`
+	SomeTotal uint64  `json:"some_total"`
+	Full10    float64 `json:"full10"`
+	Full60    float64 `json:"full60"`
+	Full300   float64 `json:"full300"`
+	FullTotal uint64  `json:"full_total"`
 }
 
 type HugeTLBPages struct {
-	Total              uint64
-	Free               uint64
-	Reserved           uint64
-	Surplus            uint64
-	DefaultSize        uint64
-	TotalAllocatedSize uint64
+	Total              uint64 `json:"total"`
+	Free               uint64 `json:"free"`
+	Reserved           uint64 `json:"reserved"`
+	Surplus            uint64 `json:"surplus"`
+	DefaultSize        uint64 `json:"default_size"`
+	TotalAllocatedSize uint64 `json:"total_allocated_size"`
+
+	// Pools of each huge page size, by increasing size. The fields
+	// above only count the pages of the default size.
+	Sizes []HugePages `json:"sizes"`
+}
+
+// HugePages holds the counters of the pool of huge pages of one size.
+type HugePages struct {
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Reserved  uint64 `json:"reserved"`
+	Surplus   uint64 `json:"surplus"`
+	SizeBytes uint64 `json:"size_bytes"`
 }
 
+// pools returns Sizes, or the pool of the default size when the kernel
+// does not list the pools of each size.
+func (self *HugeTLBPages) pools() []HugePages {
+	if len(self.Sizes) > 0 {
+		return self.Sizes
+	}
+	if self.DefaultSize == 0 {
+		return []HugePages{}
+	}
+	return []HugePages{{
+		Total:     self.Total,
+		Free:      self.Free,
+		Reserved:  self.Reserved,
+		Surplus:   self.Surplus,
+		SizeBytes: self.DefaultSize,
+	}}
+}
+
+// CpuList holds the counters of each online CPU, offline CPUs are
+// not listed.
 type CpuList struct {
-	List []Cpu
+	List []Cpu `json:"list"`
+}
+
+// CpuFreq holds the clock speeds of a CPU core in MHz.
+// Min and Max are 0 when the platform does not report them.
+type CpuFreq struct {
+	Current uint64 `json:"current"`
+	Min     uint64 `json:"min"`
+	Max     uint64 `json:"max"`
+}
+
+// LogicalCpu is a hardware thread and its place in the CPU topology. Core
+// ids are only unique within a package.
+type LogicalCpu struct {
+	Cpu     int `json:"cpu"`
+	Package int `json:"package"`
+	Core    int `json:"core"`
+	Node    int `json:"node"`
+}
+
+// CpuTopology lists the online logical CPUs with their physical package,
+// core and NUMA node, which is 0 on systems without NUMA.
+type CpuTopology struct {
+	Cpus []LogicalCpu `json:"cpus"`
+}
+
+// Packages returns the number of physical packages, or sockets.
+func (t CpuTopology) Packages() int {
+	packages := make(map[int]bool)
+	for _, cpu := range t.Cpus {
+		packages[cpu.Package] = true
+	}
+	return len(packages)
+}
+
+// PhysicalCores returns the number of cores, each running one or more
+// hardware threads.
+func (t CpuTopology) PhysicalCores() int {
+	cores := make(map[[2]int]bool)
+	for _, cpu := range t.Cpus {
+		cores[[2]int{cpu.Package, cpu.Core}] = true
+	}
+	return len(cores)
+}
+
+// ThreadsPerCore returns the number of hardware threads of each core,
+// e.g. 2 with hyper-threading.
+func (t CpuTopology) ThreadsPerCore() int {
+	cores := t.PhysicalCores()
+	if cores == 0 {
+		return 0
+	}
+	return len(t.Cpus) / cores
+}
+
+// NumaNode holds the memory and the CPUs of a NUMA node.
+type NumaNode struct {
+	Node       int    `json:"node"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	Cpus       []int  `json:"cpus"`
+}
+
+// NumaNodeList lists the NUMA nodes, systems without NUMA have a
+// single node 0 with all the memory and the online CPUs.
+type NumaNodeList struct {
+	List []NumaNode `json:"list"`
+}
+
+// Temperature is the reading of a hardware temperature sensor in degrees
+// Celsius, the thresholds are 0 when the sensor does not report them.
+type Temperature struct {
+	SensorName        string  `json:"sensor_name"`
+	Label             string  `json:"label"`
+	Celsius           float64 `json:"celsius"`
+	HighThreshold     float64 `json:"high_threshold"`
+	CriticalThreshold float64 `json:"critical_threshold"`
+}
+
+type TemperatureList struct {
+	List []Temperature `json:"list"`
+}
+
+// Fan is the speed of a fan reported by a hardware sensor.
+type Fan struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	RPM   int    `json:"rpm"`
+}
+
+// FanList lists the fans, it is empty on systems without fan sensors.
+type FanList struct {
+	List []Fan `json:"list"`
+}
+
+// BatteryState is the charging state of a battery.
+type BatteryState string
+
+const (
+	BatteryUnknown     BatteryState = "unknown"
+	BatteryCharging    BatteryState = "charging"
+	BatteryDischarging BatteryState = "discharging"
+	BatteryNotCharging BatteryState = "not_charging"
+	BatteryFull        BatteryState = "full"
+)
+
+// Battery holds the charge of a battery. TimeRemaining is the time to
+// empty while discharging and to full while charging, 0 when unknown.
+type Battery struct {
+	Name          string        `json:"name"`
+	Percent       float64       `json:"percent"`
+	State         BatteryState  `json:"state"`
+	TimeRemaining time.Duration `json:"time_remaining"`
+	Cycles        int           `json:"cycles"`
+}
+
+// BatteryList lists the batteries, it is empty on systems without any.
+type BatteryList struct {
+	List []Battery `json:"list"`
 }
 
 type FDUsage struct {
-	Open   uint64
-	Unused uint64
-	Max    uint64
+	Open   uint64 `json:"open"`
+	Unused uint64 `json:"unused"`
+	Max    uint64 `json:"max"`
 }
 
 type FileSystem struct {
-	DirName     string
-	DevName     string
-	TypeName    string
-	SysTypeName string
-	Options     string
-	Flags       uint32
+	DirName     string `json:"dir_name"`
+	DevName     string `json:"dev_name"`
+	TypeName    string `json:"type_name"`
+	SysTypeName string `json:"sys_type_name"`
+	Options     string `json:"options"`
+	Flags       uint32 `json:"flags"`
+}
+
+// HasOption returns true if opt is one of the comma separated mount
+// options, like "ro" or "noexec". Options with a value, like "mode=755",
+// match by their name.
+func (fs FileSystem) HasOption(opt string) bool {
+	for _, o := range strings.Split(fs.Options, ",") {
+		if i := strings.IndexByte(o, '='); i >= 0 {
+			o = o[:i]
+		}
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnly returns true if the file system is mounted read-only.
+func (fs FileSystem) ReadOnly() bool {
+	return fs.HasOption("ro")
+}
+
+// NoExec returns true if executing programs from the file system is denied.
+func (fs FileSystem) NoExec() bool {
+	return fs.HasOption("noexec")
+}
+
+// NoSuid returns true if the set-user-ID and set-group-ID bits are ignored.
+func (fs FileSystem) NoSuid() bool {
+	return fs.HasOption("nosuid")
+}
+
+var remoteFileSystems = map[string]bool{
+	"9p":         true,
+	"afs":        true,
+	"ceph":       true,
+	"cifs":       true,
+	"fuse.sshfs": true,
+	"glusterfs":  true,
+	"lustre":     true,
+	"ncpfs":      true,
+	"nfs":        true,
+	"nfs4":       true,
+	"smbfs":      true,
+	"smb3":       true,
+	"sshfs":      true,
+	"webdav":     true,
+}
+
+// Remote returns true if the file system type is a network file system,
+// like nfs or cifs.
+func (fs FileSystem) Remote() bool {
+	return remoteFileSystems[fs.SysTypeName]
+}
+
+// DefaultPseudoFileSystems are the types of the virtual file systems,
+// which hold no data on a disk, left out by GetFileSystemList.
+var DefaultPseudoFileSystems = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs",
+	"debugfs", "devfs", "devpts", "devtmpfs", "efivarfs", "fdescfs",
+	"fusectl", "hugetlbfs", "linprocfs", "linsysfs", "mqueue", "nsfs",
+	"overlay", "proc", "procfs", "pstore", "ramfs", "rpc_pipefs",
+	"securityfs", "selinuxfs", "sysfs", "tmpfs", "tracefs",
+}
+
+// PseudoFileSystems overrides the types left out by GetFileSystemList.
+// When nil, the DefaultPseudoFileSystems are left out, as well as the
+// types marked nodev in /proc/filesystems on Linux, except the network
+// file systems.
+var PseudoFileSystems []string
+
+func pseudoFileSystemTypes() map[string]bool {
+	types := map[string]bool{}
+	if PseudoFileSystems != nil {
+		for _, t := range PseudoFileSystems {
+			types[t] = true
+		}
+		return types
+	}
+
+	for _, t := range DefaultPseudoFileSystems {
+		types[t] = true
+	}
+	nodev, _ := nodevFileSystems()
+	for _, t := range nodev {
+		if !remoteFileSystems[t] {
+			types[t] = true
+		}
+	}
+	return types
 }
 
 type FileSystemList struct {
-	List []FileSystem
+	List []FileSystem `json:"list"`
+}
+
+// ForPath returns the file system holding path, an absolute path without
+// symlinks: the one with the longest mount point containing it. The last
+// one mounted wins among several on the same mount point, as it hides the
+// others.
+func (self *FileSystemList) ForPath(path string) (FileSystem, bool) {
+	path = filepath.Clean(path)
+
+	var found FileSystem
+	ok := false
+	for _, fs := range self.List {
+		dir := filepath.Clean(fs.DirName)
+		if !pathContains(dir, path) {
+			continue
+		}
+		if !ok || len(dir) >= len(filepath.Clean(found.DirName)) {
+			found, ok = fs, true
+		}
+	}
+	return found, ok
+}
+
+// ForDevice returns the file system mounted from the device dev, such as
+// /dev/sda1. Symlinks like the ones of /dev/disk/by-uuid are resolved. When
+// the device is mounted at several points, like with bind mounts, the first
+// one mounted is returned.
+func (self *FileSystemList) ForDevice(dev string) (FileSystem, bool) {
+	resolved := resolveDevice(dev)
+	for _, fs := range self.List {
+		if fs.DevName == dev || resolveDevice(fs.DevName) == resolved {
+			return fs, true
+		}
+	}
+	return FileSystem{}, false
+}
+
+// resolveDevice follows the symlinks of a device path, other names
+// like "tmpfs" are returned as is
+func resolveDevice(dev string) string {
+	if !filepath.IsAbs(dev) {
+		return dev
+	}
+	if resolved, err := filepath.EvalSymlinks(dev); err == nil {
+		return resolved
+	}
+	return filepath.Clean(dev)
+}
+
+// pathContains returns true if path is dir or below it
+func pathContains(dir, path string) bool {
+	if !strings.HasPrefix(path, dir) {
+		return false
+	}
+	return len(path) == len(dir) ||
+		strings.HasSuffix(dir, string(filepath.Separator)) ||
+		path[len(dir)] == filepath.Separator
 }
 
 type FileSystemUsage struct {
-	Total     uint64
-	Used      uint64
-	Free      uint64
-	Avail     uint64
-	Files     uint64
-	FreeFiles uint64
+	Total     uint64 `json:"total"`
+	Used      uint64 `json:"used"`
+	Free      uint64 `json:"free"`
+	Avail     uint64 `json:"avail"`
+	Files     uint64 `json:"files"`
+	FreeFiles uint64 `json:"free_files"`
+}
+
+// DiskIo holds the cumulative I/O counters of a block device,
+// times are in milliseconds.
+type DiskIo struct {
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	IoTime     uint64 `json:"io_time"` // Time the device had I/O in flight, 0 on Darwin
+	ReadTime   uint64 `json:"read_time"`
+	WriteTime  uint64 `json:"write_time"`
+}
+
+// DiskIoList holds the counters of each block device by device name.
+// Partitions are only listed with IncludePartitions, on Linux.
+type DiskIoList struct {
+	List              map[string]DiskIo `json:"list"`
+	IncludePartitions bool              `json:"include_partitions"`
+}
+
+// NetIfaceStat holds the cumulative counters of a network interface.
+type NetIfaceStat struct {
+	Name      string `json:"name"`
+	Loopback  bool   `json:"loopback"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+type NetIfaceStatList struct {
+	List []NetIfaceStat `json:"list"`
+}
+
+// NetProtoStats holds the system wide counters of the IP, TCP and UDP
+// protocols since boot, as found in /proc/net/snmp and /proc/net/netstat.
+type NetProtoStats struct {
+	IP  NetIPStats  `json:"ip"`
+	TCP NetTCPStats `json:"tcp"`
+	UDP NetUDPStats `json:"udp"`
+}
+
+type NetIPStats struct {
+	InReceives    uint64 `json:"in_receives"`
+	InHdrErrors   uint64 `json:"in_hdr_errors"`
+	InAddrErrors  uint64 `json:"in_addr_errors"`
+	InDiscards    uint64 `json:"in_discards"`
+	InDelivers    uint64 `json:"in_delivers"`
+	ForwDatagrams uint64 `json:"forw_datagrams"`
+	OutRequests   uint64 `json:"out_requests"`
+	OutDiscards   uint64 `json:"out_discards"`
+	OutNoRoutes   uint64 `json:"out_no_routes"`
+	ReasmFails    uint64 `json:"reasm_fails"`
+	FragFails     uint64 `json:"frag_fails"`
+}
+
+// NetTCPStats holds the TCP counters. CurrEstab is the number of
+// connections currently established or closing, not a counter. The
+// counters read from /proc/net/netstat are zero when it is missing.
+type NetTCPStats struct {
+	ActiveOpens  uint64 `json:"active_opens"`
+	PassiveOpens uint64 `json:"passive_opens"`
+	AttemptFails uint64 `json:"attempt_fails"`
+	EstabResets  uint64 `json:"estab_resets"`
+	CurrEstab    uint64 `json:"curr_estab"`
+	InSegs       uint64 `json:"in_segs"`
+	OutSegs      uint64 `json:"out_segs"`
+	RetransSegs  uint64 `json:"retrans_segs"`
+	InErrs       uint64 `json:"in_errs"`
+	OutRsts      uint64 `json:"out_rsts"`
+
+	// Connections dropped because the accept queue of a listening
+	// socket was full (ListenOverflows), or for any reason (ListenDrops)
+	ListenOverflows uint64 `json:"listen_overflows"`
+	ListenDrops     uint64 `json:"listen_drops"`
+
+	// Retransmission timeouts
+	Timeouts uint64 `json:"timeouts"`
+}
+
+type NetUDPStats struct {
+	InDatagrams  uint64 `json:"in_datagrams"`
+	NoPorts      uint64 `json:"no_ports"`
+	InErrors     uint64 `json:"in_errors"`
+	OutDatagrams uint64 `json:"out_datagrams"`
+	RcvbufErrors uint64 `json:"rcvbuf_errors"`
+	SndbufErrors uint64 `json:"sndbuf_errors"`
+}
+
+// NetConnFlags selects the sockets listed by NetConnectionList.Get().
+// Without any protocol flag all protocols are listed, likewise for
+// the address families.
+type NetConnFlags int
+
+const (
+	NetConnTCP  NetConnFlags = 1 << iota // TCP sockets
+	NetConnUDP                           // UDP sockets
+	NetConnIPv4                          // IPv4 sockets
+	NetConnIPv6                          // IPv6 sockets
+	NetConnPid                           // Resolve the pid owning each socket, scans the fds of all processes
+
+	NetConnAll = NetConnTCP | NetConnUDP | NetConnIPv4 | NetConnIPv6
+)
+
+// NetConnection describes an open TCP or UDP socket.
+type NetConnection struct {
+	Protocol   string `json:"protocol"` // One of "tcp", "tcp6", "udp" or "udp6"
+	LocalAddr  net.IP `json:"local_addr"`
+	LocalPort  uint16 `json:"local_port"`
+	RemoteAddr net.IP `json:"remote_addr"`
+	RemotePort uint16 `json:"remote_port"`
+	State      string `json:"state"` // TCP state, like ss(8) prints it
+	Inode      uint64 `json:"inode"`
+	Pid        int    `json:"pid"` // Owning process, 0 if unknown or not resolved
+}
+
+type NetConnectionList struct {
+	List []NetConnection `json:"list"`
 }
 
 type ProcList struct {
-	List []int
+	List []int `json:"list"`
+}
+
+// ProcFilter selects processes for GetProcListFiltered, a process must
+// match every criterion that is set.
+type ProcFilter struct {
+	States []RunState        // Any of these run states, every state when empty
+	Uids   []int             // Owned by any of these real uids, every user when empty
+	Name   func(string) bool // Accepts the name, like ProcState.Name, every name when nil
+}
+
+// matchState reports whether state is one of the filtered States
+func (f ProcFilter) matchState(state RunState) bool {
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUid reports whether uid is one of the filtered Uids
+func (f ProcFilter) matchUid(uid int) bool {
+	if len(f.Uids) == 0 {
+		return true
+	}
+	for _, u := range f.Uids {
+		if u == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcTree maps the pid of each process to the pids of its children, in
+// increasing order. It is built from the Ppid of every ProcState,
+// processes exiting while they are read are left out. The other processes
+// that could not be read are left out too and returned in an ErrPartial.
+type ProcTree struct {
+	Children map[int][]int `json:"children"`
+}
+
+func (self *ProcTree) Get() error {
+	pids := ProcList{}
+	if err := pids.Get(); err != nil {
+		return err
+	}
+
+	self.Children = make(map[int][]int)
+	errs := make(map[string]error)
+	for _, pid := range pids.List {
+		state := ProcState{}
+		if err := state.Get(pid); err != nil {
+			if !IsProcessNotFound(err) {
+				errs[strconv.Itoa(pid)] = err
+			}
+			continue
+		}
+		if state.Ppid == pid {
+			continue
+		}
+		self.Children[state.Ppid] = append(self.Children[state.Ppid], pid)
+	}
+	for _, children := range self.Children {
+		sort.Ints(children)
+	}
+	if len(errs) > 0 {
+		return ErrPartial{Errors: errs}
+	}
+	return nil
+}
+
+// Descendants returns the children of pid, their children and so on,
+// breadth first.
+func (self *ProcTree) Descendants(pid int) []int {
+	var descendants []int
+	seen := map[int]bool{pid: true}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range self.Children[parent] {
+			// a pid reused while the tree was read can make a loop
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			descendants = append(descendants, child)
+			queue = append(queue, child)
+		}
+	}
+	return descendants
 }
 
+// RunState is the scheduling state of a process, as the letter used in
+// /proc/<pid>/stat on Linux.
 type RunState byte
 
 const (
-	RunStateSleep   = 'S'
-	RunStateRun     = 'R'
-	RunStateStop    = 'T'
-	RunStateZombie  = 'Z'
-	RunStateIdle    = 'D'
-	RunStateUnknown = '?'
+	RunStateSleep       = 'S'
+	RunStateRun         = 'R'
+	RunStateStop        = 'T'
+	RunStateZombie      = 'Z'
+	RunStateIdle        = 'D' // Uninterruptible sleep, usually on I/O
+	RunStateIdleKernel  = 'I' // Idle kernel thread
+	RunStateTracingStop = 't'
+	RunStateDead        = 'X'
+	RunStateParked      = 'P'
+	RunStateWaking      = 'W' // Paging before Linux 2.6.0
+	RunStateWakeKill    = 'K' // Linux 2.6.33 to 3.13
+	RunStateTaskDead    = 'x' // Linux 2.6.33 to 3.13
+	RunStateUnknown     = '?'
 )
 
+var runStateNames = map[RunState]string{
+	RunStateSleep:       "sleeping",
+	RunStateRun:         "running",
+	RunStateStop:        "stopped",
+	RunStateZombie:      "zombie",
+	RunStateIdle:        "disk sleep",
+	RunStateIdleKernel:  "idle",
+	RunStateTracingStop: "tracing stop",
+	RunStateDead:        "dead",
+	RunStateParked:      "parked",
+	RunStateWaking:      "waking",
+	RunStateWakeKill:    "wakekill",
+	RunStateTaskDead:    "task dead",
+	RunStateUnknown:     "unknown",
+}
+
+// ParseRunState returns the state of the letter c, or RunStateUnknown
+// when it is not a known state.
+func ParseRunState(c byte) RunState {
+	if _, ok := runStateNames[RunState(c)]; ok {
+		return RunState(c)
+	}
+	return RunStateUnknown
+}
+
+// String returns the name of the state, like "disk sleep", or its letter
+// when it has no name.
+func (s RunState) String() string {
+	if name, ok := runStateNames[s]; ok {
+		return name
+	}
+	if s == 0 {
+		return ""
+	}
+	return string(rune(s))
+}
+
+// MarshalJSON encodes the state by its name, like "running", states
+// without a name are encoded as their single letter.
+func (s RunState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes the names written by MarshalJSON.
+func (s *RunState) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	for state, n := range runStateNames {
+		if n == name {
+			*s = state
+			return nil
+		}
+	}
+
+	switch len(name) {
+	case 0:
+		*s = 0
+	case 1:
+		*s = RunState(name[0])
+	default:
+		return fmt.Errorf("invalid process state %q", name)
+	}
+	return nil
+}
+
 type ProcState struct {
-	Name      string
-	Username  string
-	State     RunState
-	Ppid      int
-	Pgid      int
-	Tty       int
-	Priority  int
-	Nice      int
-	Processor int
+	Name      string   `json:"name"`
+	Username  string   `json:"username"`
+	State     RunState `json:"state"`
+	Ppid      int      `json:"ppid"`
+	Pgid      int      `json:"pgid"`
+	Tty       int      `json:"tty"`
+	Priority  int      `json:"priority"`
+	Nice      int      `json:"nice"`
+	Processor int      `json:"processor"`
+
+	NumThreads int    `json:"num_threads"` // Linux and Darwin
+	StartTime  uint64 `json:"start_time"`  // Clock ticks after boot the process started at, Linux only
+}
+
+// NsProc reads a process as seen from its own pid namespace, like the
+// main process of a container, by its pid in the namespace of the caller.
+// The stats are read from the proc mounted in the root of the process,
+// /proc/<HostPid>/root/proc, so pids like the Ppid are the ones of the
+// namespace. Following that root needs the same privileges as ptrace on the
+// process, to be its owner or to have CAP_SYS_PTRACE, ErrNotPermitted is
+// returned otherwise. It is only implemented on Linux 4.1 and later.
+type NsProc struct {
+	HostPid int
+}
+
+// ProcInNamespace returns the reader of hostPid in its own pid namespace
+func ProcInNamespace(hostPid int) *NsProc {
+	return &NsProc{HostPid: hostPid}
 }
 
+// ProcMem is the memory usage of a process in bytes. The Swap and the
+// segment sizes are only known on Linux and FreeBSD, they are zero elsewhere.
 type ProcMem struct {
-	Size        uint64
-	Resident    uint64
-	Share       uint64
-	MinorFaults uint64
-	MajorFaults uint64
-	PageFaults  uint64
+	Size        uint64 `json:"size"`
+	Resident    uint64 `json:"resident"`
+	Share       uint64 `json:"share"`
+	Swap        uint64 `json:"swap"`
+	Data        uint64 `json:"data"`
+	Stack       uint64 `json:"stack"`
+	Text        uint64 `json:"text"`
+	MinorFaults uint64 `json:"minor_faults"`
+	MajorFaults uint64 `json:"major_faults"`
+	PageFaults  uint64 `json:"page_faults"`
 }
 
+// ProcTime is the CPU time of a process in milliseconds and its StartTime,
+// in milliseconds since the epoch, see StartedAt.
 type ProcTime struct {
-	StartTime uint64
-	User      uint64
-	Sys       uint64
-	Total     uint64
+	StartTime uint64 `json:"start_time"`
+	User      uint64 `json:"user"`
+	Sys       uint64 `json:"sys"`
+	Total     uint64 `json:"total"`
+}
+
+// StartedAt returns the StartTime of the process as a time.Time, to compute
+// its age or to tell apart two processes that had the same pid
+func (self ProcTime) StartedAt() time.Time {
+	return time.Unix(0, int64(self.StartTime)*int64(time.Millisecond))
+}
+
+// ProcCpuTracker computes the CPU usage of processes from the ProcTime of
+// consecutive calls. The zero value is ready to use, and it is safe for
+// concurrent use.
+type ProcCpuTracker struct {
+	lock    sync.Mutex
+	samples map[int]procCpuSample
+}
+
+type procCpuSample struct {
+	time ProcTime
+	at   time.Time
+}
+
+// Percent returns the CPU usage of pid since the previous call for it,
+// 100 being one core fully used, so it exceeds 100 for a multithreaded
+// process. The first call for a pid, or for a new process reusing it,
+// returns 0.
+func (t *ProcCpuTracker) Percent(pid int) (float64, error) {
+	cur := ProcTime{}
+	if err := cur.Get(pid); err != nil {
+		t.Remove(pid)
+		return 0, err
+	}
+	return t.Update(pid, cur, time.Now()), nil
+}
+
+// Remove forgets the previous sample of pid, like when it exited.
+func (t *ProcCpuTracker) Remove(pid int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.samples, pid)
+}
+
+// Update is like Percent for callers that already read the ProcTime of pid,
+// at now.
+func (t *ProcCpuTracker) Update(pid int, cur ProcTime, now time.Time) float64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.samples == nil {
+		t.samples = make(map[int]procCpuSample)
+	}
+	prev, ok := t.samples[pid]
+	t.samples[pid] = procCpuSample{time: cur, at: now}
+
+	if !ok || prev.time.StartTime != cur.StartTime || cur.Total < prev.time.Total {
+		return 0
+	}
+	elapsed := now.Sub(prev.at)
+	if elapsed <= 0 {
+		return 0
+	}
+	// Total is in milliseconds
+	return float64(cur.Total-prev.time.Total) / (elapsed.Seconds() * 1000) * 100
+}
+
+// ThreadInfo holds the state and the CPU time, in milliseconds, of a thread.
+type ThreadInfo struct {
+	Tid      int      `json:"tid"`
+	Name     string   `json:"name"`
+	State    RunState `json:"state"`
+	UserTime uint64   `json:"user_time"`
+	SysTime  uint64   `json:"sys_time"`
+}
+
+// ProcThreads lists the threads of a process, threads exiting while they
+// are listed are left out.
+type ProcThreads struct {
+	List []ThreadInfo `json:"list"`
 }
 
 type ProcArgs struct {
-	List []string
+	List []string `json:"list"`
 }
 
+// ProcEnv holds the environment of a process. Reading the environment of
+// the processes of other users fails with an ErrNotPermitted.
 type ProcEnv struct {
-	Vars map[string]string
+	Vars map[string]string `json:"vars"`
+}
+
+// Lookup returns the value of the environment variable key and whether
+// it is set, like os.LookupEnv.
+func (self *ProcEnv) Lookup(key string) (string, bool) {
+	value, ok := self.Vars[key]
+	return value, ok
+}
+
+// ProcChange lists the pids that appeared and disappeared between two
+// snapshots of the process list taken by WatchProcesses.
+type ProcChange struct {
+	Added   []int `json:"added"`
+	Removed []int `json:"removed"`
+}
+
+// ProcCred holds the real, effective and saved user and group ids of a
+// process and its supplementary groups. With ResolveNames, Get also looks
+// up the names of the real user, the real group and the supplementary
+// groups, falling back to the numeric id for unknown ids.
+type ProcCred struct {
+	Uid    int   `json:"uid"`
+	Euid   int   `json:"euid"`
+	Suid   int   `json:"suid"`
+	Gid    int   `json:"gid"`
+	Egid   int   `json:"egid"`
+	Sgid   int   `json:"sgid"`
+	Groups []int `json:"groups"`
+
+	ResolveNames bool     `json:"-"`
+	Username     string   `json:"username,omitempty"`
+	Groupname    string   `json:"groupname,omitempty"`
+	GroupNames   []string `json:"group_names,omitempty"`
 }
 
+// ProcExe holds the executable, working directory and root directory of a
+// process. Get returns an ErrPartial, keyed by "exe", "cwd" and "root",
+// when only some of them could be read.
 type ProcExe struct {
-	Name string
-	Cwd  string
-	Root string
+	Name string `json:"name"`
+	Cwd  string `json:"cwd"`
+	Root string `json:"root"`
+}
+
+// ProcNetConnections holds the TCP and UDP sockets open by a process.
+type ProcNetConnections struct {
+	List []NetConnection `json:"list"`
+}
+
+// ProcIo holds the I/O counters of a process, in bytes and read/write
+// calls, as accounted by the kernel in /proc/<pid>/io.
+type ProcIo struct {
+	RChar               uint64 `json:"rchar"`
+	WChar               uint64 `json:"wchar"`
+	Syscr               uint64 `json:"syscr"`
+	Syscw               uint64 `json:"syscw"`
+	ReadBytes           uint64 `json:"read_bytes"`
+	WriteBytes          uint64 `json:"write_bytes"`
+	CancelledWriteBytes uint64 `json:"cancelled_write_bytes"`
+}
+
+// ProcDiskIo holds the I/O counters of a process along with the block
+// devices backing the files it has open, to attribute I/O pressure to
+// processes. The attribution is approximate: the kernel does not split
+// the counters by device, the devices of the files read or written and
+// closed since, of memory mapped files and of the writeback done for the
+// process are missed, and the device of a file on LVM or device mapper is
+// the dm device, not the disks under it.
+type ProcDiskIo struct {
+	Io      ProcIo   `json:"io"`
+	Devices []string `json:"devices"` // Block device names, like sda1, sorted
+}
+
+// ProcMap is a memory region of a process, a line of /proc/<pid>/maps.
+type ProcMap struct {
+	Start  uint64 `json:"start"`
+	End    uint64 `json:"end"`
+	Perms  string `json:"perms"` // Like "r-xp", p for private and s for shared
+	Offset uint64 `json:"offset"`
+	Dev    string `json:"dev"` // Device of the file as hex major:minor, like "08:01"
+	Inode  uint64 `json:"inode"`
+	Path   string `json:"path"` // File, pseudo path like "[heap]" or empty
+}
+
+// Size returns the size of the region in bytes.
+func (m ProcMap) Size() uint64 {
+	return m.End - m.Start
+}
+
+// Anonymous reports whether the region is not backed by a file, like the
+// heap, the stacks or the regions of anonymous mmap()s.
+func (m ProcMap) Anonymous() bool {
+	return m.Inode == 0
+}
+
+// ProcMaps lists the memory regions of a process by address. The resident
+// sizes, in bytes, are the sums of /proc/<pid>/smaps_rollup, added in
+// Linux 4.14, they are left zero on older kernels.
+type ProcMaps struct {
+	List []ProcMap `json:"list"`
+
+	Rss     uint64 `json:"rss"`
+	Pss     uint64 `json:"pss"`      // Rss with the shared pages split among their users
+	AnonRss uint64 `json:"anon_rss"` // Resident anonymous pages
+	FileRss uint64 `json:"file_rss"` // Resident pages of files, including shared memory
+	Swap    uint64 `json:"swap"`
+}
+
+// SchedPolicy is the scheduling policy of a process, as numbered by
+// sched_setscheduler(2).
+type SchedPolicy int
+
+const (
+	SchedOther    SchedPolicy = 0
+	SchedFIFO     SchedPolicy = 1
+	SchedRR       SchedPolicy = 2
+	SchedBatch    SchedPolicy = 3
+	SchedIdle     SchedPolicy = 5
+	SchedDeadline SchedPolicy = 6 // Linux 3.14 and later
+)
+
+var schedPolicyNames = map[SchedPolicy]string{
+	SchedOther:    "SCHED_OTHER",
+	SchedFIFO:     "SCHED_FIFO",
+	SchedRR:       "SCHED_RR",
+	SchedBatch:    "SCHED_BATCH",
+	SchedIdle:     "SCHED_IDLE",
+	SchedDeadline: "SCHED_DEADLINE",
+}
+
+// String returns the name of the policy, like "SCHED_FIFO", or its
+// number when it is not known.
+func (p SchedPolicy) String() string {
+	if name, ok := schedPolicyNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ProcSched holds the scheduling policy of a process and its real-time
+// priority, from 1 to 99 for SchedFIFO and SchedRR and 0 otherwise.
+type ProcSched struct {
+	Policy     SchedPolicy `json:"policy"`
+	RtPriority int         `json:"rt_priority"`
+}
+
+// CapSet is a set of Linux capabilities, with bit n set for capability
+// number n. It is encoded in JSON as the list of its names.
+type CapSet uint64
+
+// Names of the capabilities by number, from <linux/capability.h>
+var capNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",            // Linux 5.8 and later
+	"CAP_BPF",                // Linux 5.8 and later
+	"CAP_CHECKPOINT_RESTORE", // Linux 5.9 and later
+}
+
+// capNumber returns the number of the capability name, like
+// "CAP_NET_ADMIN", or of its decimal number for unnamed ones.
+func capNumber(name string) (uint, bool) {
+	for n, capName := range capNames {
+		if strings.EqualFold(name, capName) {
+			return uint(n), true
+		}
+	}
+	n, err := strconv.ParseUint(name, 10, 8)
+	if err != nil || n > 63 {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// Has reports whether the set holds the capability name, like
+// "CAP_SYS_ADMIN", matched regardless of case.
+func (s CapSet) Has(name string) bool {
+	n, ok := capNumber(name)
+	return ok && s&(1<<n) != 0
+}
+
+// Names returns the names of the capabilities in the set by number, the
+// ones newer than this package by their number.
+func (s CapSet) Names() []string {
+	names := []string{}
+	for n := uint(0); n < 64; n++ {
+		if s&(1<<n) == 0 {
+			continue
+		}
+		if n < uint(len(capNames)) {
+			names = append(names, capNames[n])
+		} else {
+			names = append(names, strconv.Itoa(int(n)))
+		}
+	}
+	return names
+}
+
+// MarshalJSON encodes the set as the list of its Names.
+func (s CapSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Names())
+}
+
+// UnmarshalJSON decodes the names written by MarshalJSON.
+func (s *CapSet) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+
+	var set CapSet
+	for _, name := range names {
+		n, ok := capNumber(name)
+		if !ok {
+			return fmt.Errorf("invalid capability %q", name)
+		}
+		set |= 1 << n
+	}
+	*s = set
+	return nil
+}
+
+// ProcCaps holds the capability sets of a process from /proc/<pid>/status.
+// The ambient set, added in Linux 4.3, is left empty on older kernels.
+type ProcCaps struct {
+	Inheritable CapSet `json:"inheritable"`
+	Permitted   CapSet `json:"permitted"`
+	Effective   CapSet `json:"effective"`
+	Bounding    CapSet `json:"bounding"`
+	Ambient     CapSet `json:"ambient"`
+}
+
+// Has reports whether the process has the capability name, like
+// "CAP_NET_ADMIN", in its effective set.
+func (c ProcCaps) Has(name string) bool {
+	return c.Effective.Has(name)
+}
+
+// ProcStatus holds the memory, thread, context switch and signal details
+// of a process from /proc/<pid>/status. Memory sizes are in bytes, signal
+// masks have bit n-1 set for signal n. Fields missing on older kernels,
+// like VmSwap, are left zero.
+type ProcStatus struct {
+	VmPeak uint64 `json:"vm_peak"`
+	VmSize uint64 `json:"vm_size"`
+	VmLck  uint64 `json:"vm_lck"`
+	VmHWM  uint64 `json:"vm_hwm"`
+	VmRSS  uint64 `json:"vm_rss"`
+	VmData uint64 `json:"vm_data"`
+	VmStk  uint64 `json:"vm_stk"`
+	VmExe  uint64 `json:"vm_exe"`
+	VmLib  uint64 `json:"vm_lib"`
+	VmPTE  uint64 `json:"vm_pte"`
+	VmSwap uint64 `json:"vm_swap"`
+
+	Threads                  int    `json:"threads"`
+	VoluntaryCtxtSwitches    uint64 `json:"voluntary_ctxt_switches"`
+	NonvoluntaryCtxtSwitches uint64 `json:"nonvoluntary_ctxt_switches"`
+
+	SigPnd uint64 `json:"sig_pnd"`
+	ShdPnd uint64 `json:"shd_pnd"`
+	SigBlk uint64 `json:"sig_blk"`
+	SigIgn uint64 `json:"sig_ign"`
+	SigCgt uint64 `json:"sig_cgt"`
 }
 
 type ProcFDUsage struct {
-	Open      uint64
-	SoftLimit uint64
-	HardLimit uint64
+	Open      uint64 `json:"open"`
+	SoftLimit uint64 `json:"soft_limit"`
+	HardLimit uint64 `json:"hard_limit"`
+}
+
+// ProcFD is an open file descriptor of a process. Target is the file path,
+// or a kernel object like "socket:[34567]" or "pipe:[12345]".
+type ProcFD struct {
+	Fd     int    `json:"fd"`
+	Target string `json:"target"`
+}
+
+// SocketInode returns the inode of the socket fd refers to, which is the
+// NetConnection.Inode of the socket.
+func (fd ProcFD) SocketInode() (uint64, bool) {
+	if !strings.HasPrefix(fd.Target, "socket:[") || !strings.HasSuffix(fd.Target, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(fd.Target[len("socket:["):len(fd.Target)-1], 10, 64)
+	return inode, err == nil
+}
+
+// ProcFDs lists the open file descriptors of a process sorted by number,
+// fds closed while they are listed are left out. Listing the fds of the
+// processes of other users fails with an ErrNotPermitted.
+type ProcFDs struct {
+	List []ProcFD `json:"list"`
+}
+
+// LimitUnlimited is the value of the resource limits set to "unlimited".
+const LimitUnlimited uint64 = math.MaxUint64
+
+// ProcLimit is a soft and hard resource limit, in Units.
+type ProcLimit struct {
+	Soft  uint64 `json:"soft"`
+	Hard  uint64 `json:"hard"`
+	Units string `json:"units,omitempty"`
+}
+
+// ProcLimits holds the resource limits of a process, keyed by their name
+// in /proc/<pid>/limits, like "Max open files" or "Max stack size".
+type ProcLimits struct {
+	Limits map[string]ProcLimit `json:"limits"`
+}
+
+// OpenFiles returns the soft and hard limits of the open file descriptors.
+func (self *ProcLimits) OpenFiles() (soft, hard uint64) {
+	limit := self.Limits["Max open files"]
+	return limit.Soft, limit.Hard
 }
 
 type Rusage struct {
-	Utime    time.Duration
-	Stime    time.Duration
-	Maxrss   int64
-	Ixrss    int64
-	Idrss    int64
-	Isrss    int64
-	Minflt   int64
-	Majflt   int64
-	Nswap    int64
-	Inblock  int64
-	Oublock  int64
-	Msgsnd   int64
-	Msgrcv   int64
-	Nsignals int64
-	Nvcsw    int64
-	Nivcsw   int64
+	Utime    time.Duration `json:"utime"`
+	Stime    time.Duration `json:"stime"`
+	Maxrss   int64         `json:"maxrss"`
+	Ixrss    int64         `json:"ixrss"`
+	Idrss    int64         `json:"idrss"`
+	Isrss    int64         `json:"isrss"`
+	Minflt   int64         `json:"minflt"`
+	Majflt   int64         `json:"majflt"`
+	Nswap    int64         `json:"nswap"`
+	Inblock  int64         `json:"inblock"`
+	Oublock  int64         `json:"oublock"`
+	Msgsnd   int64         `json:"msgsnd"`
+	Msgrcv   int64         `json:"msgrcv"`
+	Nsignals int64         `json:"nsignals"`
+	Nvcsw    int64         `json:"nvcsw"`
+	Nivcsw   int64         `json:"nivcsw"`
+}
+
+// Snapshot holds the host metrics gathered by Collect. The sections that
+// failed or were not requested are left empty.
+type Snapshot struct {
+	Time        time.Time                  `json:"time"`
+	Mem         Mem                        `json:"mem"`
+	Swap        Swap                       `json:"swap"`
+	LoadAverage LoadAverage                `json:"load_average"`
+	Uptime      Uptime                     `json:"uptime"`
+	Cpus        CpuList                    `json:"cpus"`
+	FileSystems map[string]FileSystemUsage `json:"file_systems"` // By mount point
+	Processes   []int                      `json:"processes,omitempty"`
+	Connections []NetConnection            `json:"connections,omitempty"`
 }
+
+// SnapshotOptions selects the expensive sections of a Snapshot.
+type SnapshotOptions struct {
+	Processes   bool         // List the pids
+	Connections NetConnFlags // Sockets to list, none when zero
+
+	// How long to wait for the usage of each file system, defaults to
+	// DefaultFileSystemTimeout
+	FileSystemTimeout time.Duration
+}
+
+// DefaultFileSystemTimeout is the SnapshotOptions.FileSystemTimeout used
+// when it is not set.
+const DefaultFileSystemTimeout = 5 * time.Second
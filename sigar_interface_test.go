@@ -1,6 +1,8 @@
 package gosigar_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	. "github.com/elastic/gosigar"
+	"github.com/elastic/gosigar/sigartest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,11 +23,189 @@ func TestCpu(t *testing.T) {
 	assert.NoError(t, cpu.Get())
 }
 
+// errors.Is calls the Is method of the errors, matching them by type
+func TestErrorsIs(t *testing.T) {
+	assert.True(t, ErrNotPermitted{Path: "/proc/1/io"}.Is(ErrNotPermitted{}))
+	assert.True(t, ErrNotPermitted{Path: "/proc/1/io"}.Is(&ErrNotPermitted{Path: "/proc/2/io"}))
+	assert.False(t, ErrNotPermitted{}.Is(ErrNotImplemented{}))
+
+	assert.True(t, ErrNotImplemented{OS: "plan9"}.Is(ErrNotImplemented{}))
+	assert.False(t, ErrNotImplemented{}.Is(ErrNotPermitted{}))
+}
+
+func TestCpuDeltaPercent(t *testing.T) {
+	prev := Cpu{User: 100, Sys: 50, Idle: 1000, Wait: 10}
+	cur := Cpu{User: 150, Sys: 75, Idle: 1100, Wait: 35}
+
+	percent := prev.DeltaPercent(cur)
+	assert.Equal(t, CpuPercent{User: 25, Sys: 12.5, Idle: 50, Wait: 12.5}, percent)
+	assert.InDelta(t, 50, percent.Busy(), 0.001)
+
+	// counters went backwards
+	assert.Equal(t, CpuPercent{}, cur.DeltaPercent(prev))
+
+	// no time elapsed
+	assert.Equal(t, CpuPercent{}, cur.DeltaPercent(cur))
+}
+
 func TestLoadAverage(t *testing.T) {
 	avg := LoadAverage{}
 	assert.NoError(t, skipNotImplemented(t, avg.Get(), "windows"))
 }
 
+func TestLoadAveragePerCpu(t *testing.T) {
+	avg := LoadAverage{One: 2, Five: 4, Fifteen: 1}
+	assert.Equal(t, LoadAverage{One: 0.5, Five: 1, Fifteen: 0.25}, avg.PerCpu(4))
+	assert.Equal(t, avg, avg.PerCpu(1))
+	assert.Equal(t, avg, avg.PerCpu(0))
+
+	avg = LoadAverage{One: 2, Runnable: 3, Total: 80, LastPid: 11206}
+	assert.Equal(t, LoadAverage{One: 1, Runnable: 3, Total: 80, LastPid: 11206}, avg.PerCpu(2))
+}
+
+func TestProcCpuTrackerPercent(t *testing.T) {
+	tracker := ProcCpuTracker{}
+	start := time.Now()
+
+	// first sample
+	assert.Equal(t, 0.0, tracker.Update(42, ProcTime{StartTime: 1000, Total: 500}, start))
+	// 1.5s of CPU in 1s, e.g. two busy threads
+	assert.Equal(t, 150.0, tracker.Update(42, ProcTime{StartTime: 1000, Total: 2000}, start.Add(time.Second)))
+	assert.Equal(t, 25.0, tracker.Update(42, ProcTime{StartTime: 1000, Total: 3000}, start.Add(5*time.Second)))
+	// no time elapsed
+	assert.Equal(t, 0.0, tracker.Update(42, ProcTime{StartTime: 1000, Total: 3000}, start.Add(5*time.Second)))
+
+	// the pid is reused by a new process
+	assert.Equal(t, 0.0, tracker.Update(42, ProcTime{StartTime: 9000, Total: 100}, start.Add(6*time.Second)))
+	assert.Equal(t, 10.0, tracker.Update(42, ProcTime{StartTime: 9000, Total: 200}, start.Add(7*time.Second)))
+
+	tracker.Remove(42)
+	assert.Equal(t, 0.0, tracker.Update(42, ProcTime{StartTime: 9000, Total: 300}, start.Add(8*time.Second)))
+}
+
+func TestProcCpuTrackerSelf(t *testing.T) {
+	tracker := ProcCpuTracker{}
+	pct, err := tracker.Percent(os.Getpid())
+	if assert.NoError(t, skipNotImplemented(t, err, "openbsd")) {
+		assert.Equal(t, 0.0, pct)
+	}
+
+	// burn some CPU
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+
+	pct, err = tracker.Percent(os.Getpid())
+	if assert.NoError(t, err) {
+		assert.True(t, pct >= 0, "percent (%f) must not be negative", pct)
+	}
+}
+
+func TestFileSystemListForPath(t *testing.T) {
+	l := FileSystemList{List: []FileSystem{
+		{DirName: "/", DevName: "/dev/sda1"},
+		{DirName: "/var", DevName: "/dev/sda2"},
+		{DirName: "/var/lib/docker", DevName: "/dev/sdb1"},
+		{DirName: "/var/lib/docker", DevName: "overlay"},
+		{DirName: "/srv/data", DevName: "/dev/sdc1"},
+	}}
+
+	tests := map[string]string{
+		"/":                         "/dev/sda1",
+		"/etc/hosts":                "/dev/sda1",
+		"/var":                      "/dev/sda2",
+		"/var/log/syslog":           "/dev/sda2",
+		"/variable":                 "/dev/sda1",
+		"/var/lib/docker/overlay2":  "overlay",
+		"/srv/data/":                "/dev/sdc1",
+		"/srv/database":             "/dev/sda1",
+		"/var/lib/../lib/docker/db": "overlay",
+	}
+	for path, dev := range tests {
+		fs, ok := l.ForPath(filepath.FromSlash(path))
+		if assert.True(t, ok, path) {
+			assert.Equal(t, dev, fs.DevName, path)
+		}
+	}
+
+	l = FileSystemList{List: []FileSystem{{DirName: "/var"}}}
+	_, ok := l.ForPath("/etc")
+	assert.False(t, ok)
+}
+
+func TestFileSystemUsageExceedsThreshold(t *testing.T) {
+	half := FileSystemUsage{Total: 4096, Used: 2048, Free: 2048, Avail: 2048}
+	assert.True(t, half.ExceedsThreshold(50))
+	assert.False(t, half.ExceedsThreshold(50.5))
+
+	full := FileSystemUsage{Total: 4096, Used: 4096}
+	assert.True(t, full.ExceedsThreshold(100))
+
+	// overcommitted network mount
+	over := FileSystemUsage{Total: 4096, Used: 8192}
+	assert.True(t, over.ExceedsThreshold(100))
+
+	empty := FileSystemUsage{}
+	assert.False(t, empty.ExceedsThreshold(90))
+}
+
+func TestFileSystemsAboveThreshold(t *testing.T) {
+	fake := sigartest.NewFakeSigar()
+	fake.FileSystemUsages = map[string]FileSystemUsage{
+		"/":        {Total: 4096, Used: 1024, Free: 3072, Avail: 3072},
+		"/var":     {Total: 4096, Used: 4096},
+		"/mnt/nfs": {Total: 4096, Used: 8192},
+		"/boot":    {Total: 4096, Used: 4096},
+		"/proc":    {Total: 4096, Used: 4096},
+	}
+	fake.FileSystemUsagesErr = ErrPartial{Errors: map[string]error{"/mnt/hung": ErrTimeout{Path: "/mnt/hung"}}}
+
+	DefaultSigar = fake
+	defer func() { DefaultSigar = &ConcreteSigar{} }()
+
+	list := FileSystemList{List: []FileSystem{
+		{DirName: "/", SysTypeName: "ext4", Options: "rw,relatime"},
+		{DirName: "/var", SysTypeName: "ext4", Options: "rw"},
+		{DirName: "/boot", SysTypeName: "ext4", Options: "ro,relatime"},
+		{DirName: "/proc", SysTypeName: "proc", Options: "rw"},
+		{DirName: "/mnt/nfs", SysTypeName: "nfs4", Options: "rw,vers=4.2"},
+		{DirName: "/mnt/hung", SysTypeName: "nfs4", Options: "rw"},
+	}}
+	above, err := FileSystemsAboveThreshold(list, 90)
+	assert.True(t, IsPartial(err), "err=%v", err)
+	assert.Equal(t, []string{"/var", "/mnt/nfs"}, above)
+}
+
+func TestDefaultSigar(t *testing.T) {
+	fake := sigartest.NewFakeSigar()
+	fake.Mem = Mem{Total: 1024, Used: 256}
+	fake.ProcArgsErr = ErrNotPermitted{Path: "kern.procargs2.42"}
+	fake.NumCpuOnline, fake.NumCpuPossible = 2, 4
+	fake.DeviceNameValue = "/dev/sda1"
+
+	DefaultSigar = fake
+	defer func() { DefaultSigar = &ConcreteSigar{} }()
+
+	mem, err := GetMem()
+	if assert.NoError(t, err) {
+		assert.Equal(t, fake.Mem, mem)
+	}
+	_, err = GetProcArgs(42)
+	assert.True(t, IsNotPermitted(err))
+	assert.Equal(t, 42, fake.ProcArgsPid)
+
+	online, possible, err := NumCpu()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, online)
+		assert.Equal(t, 4, possible)
+	}
+	name, err := DeviceName(8, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/dev/sda1", name)
+	}
+	assert.Equal(t, 1, fake.DeviceNameMinor)
+}
+
 func TestUptime(t *testing.T) {
 	uptime := Uptime{}
 	if assert.NoError(t, uptime.Get()) {
@@ -80,6 +261,94 @@ func TestFileSystemUsage(t *testing.T) {
 	assert.Error(t, fsusage.Get("T O T A L L Y B O G U S"))
 }
 
+func TestFileSystemOptions(t *testing.T) {
+	tests := []struct {
+		options                  string
+		readOnly, noExec, noSuid bool
+	}{
+		{"rw,relatime", false, false, false},
+		{"ro", true, false, false},
+		{"ro,nosuid,nodev,noexec", true, true, true},
+		{"rw,nosuid,nodev,noexec,relatime,size=65536k,mode=755", false, true, true},
+		{"rw,errors=remount-ro", false, false, false},
+		{"rw,root=ro,fmask=0022", false, false, false},
+		{"rw,rootcontext=system_u:object_r:tmp_t:s0", false, false, false},
+		{"rw,noexecute", false, false, false},
+		{"", false, false, false},
+	}
+
+	for _, test := range tests {
+		fs := FileSystem{Options: test.options}
+		assert.Equal(t, test.readOnly, fs.ReadOnly(), "ReadOnly(%q)", test.options)
+		assert.Equal(t, test.noExec, fs.NoExec(), "NoExec(%q)", test.options)
+		assert.Equal(t, test.noSuid, fs.NoSuid(), "NoSuid(%q)", test.options)
+	}
+
+	assert.True(t, FileSystem{SysTypeName: "nfs4"}.Remote())
+	assert.True(t, FileSystem{SysTypeName: "cifs"}.Remote())
+	assert.False(t, FileSystem{SysTypeName: "ext4"}.Remote())
+	assert.False(t, FileSystem{SysTypeName: "tmpfs"}.Remote())
+}
+
+func TestFileSystemUsagePercent(t *testing.T) {
+	tests := []struct {
+		name         string
+		usage        FileSystemUsage
+		usePercent   float64
+		filesUsed    uint64
+		filesPercent float64
+	}{
+		{
+			name:         "half",
+			usage:        FileSystemUsage{Total: 4096, Free: 2048, Avail: 2048, Files: 100, FreeFiles: 75},
+			usePercent:   50,
+			filesUsed:    25,
+			filesPercent: 25,
+		},
+		{
+			name:         "no inodes",
+			usage:        FileSystemUsage{Total: 4096, Free: 1024, Avail: 1024},
+			usePercent:   75,
+			filesUsed:    0,
+			filesPercent: 0,
+		},
+		{
+			name:         "inodes exhausted",
+			usage:        FileSystemUsage{Total: 4096, Free: 3072, Avail: 3072, Files: 1000, FreeFiles: 0},
+			usePercent:   25,
+			filesUsed:    1000,
+			filesPercent: 100,
+		},
+		{
+			name:         "full",
+			usage:        FileSystemUsage{Total: 4096, Used: 4096, Free: 0, Avail: 0},
+			usePercent:   100,
+			filesUsed:    0,
+			filesPercent: 0,
+		},
+		{
+			name:         "more free than total",
+			usage:        FileSystemUsage{Total: 4096, Free: 8192, Avail: 8192},
+			usePercent:   0,
+			filesUsed:    0,
+			filesPercent: 0,
+		},
+		{
+			name:         "empty",
+			usage:        FileSystemUsage{},
+			usePercent:   0,
+			filesUsed:    0,
+			filesPercent: 0,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.usePercent, test.usage.UsePercent(), test.name)
+		assert.Equal(t, test.filesUsed, test.usage.FilesUsed(), test.name)
+		assert.Equal(t, test.filesPercent, test.usage.FilesUsePercent(), test.name)
+	}
+}
+
 func TestProcList(t *testing.T) {
 	pids := ProcList{}
 	if assert.NoError(t, pids.Get()) {
@@ -104,6 +373,131 @@ func TestProcState(t *testing.T) {
 	assert.Error(t, state.Get(invalidPid))
 }
 
+func TestSchedPolicyString(t *testing.T) {
+	assert.Equal(t, "SCHED_OTHER", SchedOther.String())
+	assert.Equal(t, "SCHED_RR", SchedRR.String())
+	assert.Equal(t, "4", SchedPolicy(4).String())
+}
+
+func TestCapSetJSON(t *testing.T) {
+	set := CapSet(1<<0 | 1<<21 | 1<<45)
+	assert.Equal(t, []string{"CAP_CHOWN", "CAP_SYS_ADMIN", "45"}, set.Names())
+	assert.True(t, set.Has("cap_sys_admin"))
+	assert.False(t, set.Has("CAP_NET_ADMIN"))
+	assert.False(t, set.Has("CAP_NO_SUCH_CAP"))
+
+	data, err := json.Marshal(set)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `["CAP_CHOWN","CAP_SYS_ADMIN","45"]`, string(data))
+	}
+	var decoded CapSet
+	if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		assert.Equal(t, set, decoded)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`["CAP_NO_SUCH_CAP"]`), &decoded))
+
+	data, err = json.Marshal(CapSet(0))
+	if assert.NoError(t, err) {
+		assert.Equal(t, `[]`, string(data))
+	}
+}
+
+func TestRunStateJSON(t *testing.T) {
+	states := map[RunState]string{
+		RunStateSleep:      `"sleeping"`,
+		RunStateRun:        `"running"`,
+		RunStateStop:       `"stopped"`,
+		RunStateZombie:     `"zombie"`,
+		RunStateIdle:       `"disk sleep"`,
+		RunStateIdleKernel: `"idle"`,
+		RunStateUnknown:    `"unknown"`,
+		'A':                `"A"`,
+		0:                  `""`,
+	}
+
+	for state, encoded := range states {
+		data, err := json.Marshal(state)
+		if assert.NoError(t, err) {
+			assert.Equal(t, encoded, string(data))
+		}
+
+		var decoded RunState
+		if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+			assert.Equal(t, state, decoded)
+		}
+	}
+
+	var decoded RunState
+	assert.Error(t, json.Unmarshal([]byte(`"sleepy"`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`83`), &decoded))
+}
+
+func TestRunStateString(t *testing.T) {
+	// the states of fs/proc/array.c, past and present
+	states := map[byte]string{
+		'R': "running",
+		'S': "sleeping",
+		'D': "disk sleep",
+		'T': "stopped",
+		't': "tracing stop",
+		'X': "dead",
+		'x': "task dead",
+		'Z': "zombie",
+		'P': "parked",
+		'I': "idle",
+		'W': "waking",
+		'K': "wakekill",
+	}
+	for c, name := range states {
+		state := ParseRunState(c)
+		assert.Equal(t, RunState(c), state, "state %c", c)
+		assert.Equal(t, name, state.String(), "state %c", c)
+	}
+
+	assert.Equal(t, RunState(RunStateUnknown), ParseRunState('A'))
+	assert.Equal(t, "unknown", ParseRunState('A').String())
+	assert.Equal(t, "A", RunState('A').String())
+	assert.Equal(t, "", RunState(0).String())
+}
+
+func TestMetricsJSON(t *testing.T) {
+	state := ProcState{Name: "cron", State: RunStateSleep, Ppid: 1, NumThreads: 2}
+	data, err := json.Marshal(state)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"state":"sleeping"`)
+		assert.Contains(t, string(data), `"num_threads":2`)
+
+		var decoded ProcState
+		if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+			assert.Equal(t, state, decoded)
+		}
+	}
+
+	mem := Mem{Total: 4, Used: 3, Free: 1, ActualFree: 2, ActualUsed: 2}
+	data, err = json.Marshal(mem)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"total":4,"used":3,"free":1,"actual_free":2,"actual_used":2,
+			"buffers":0,"cached":0,"sreclaimable":0,"available":0}`, string(data))
+
+		var decoded Mem
+		if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+			assert.Equal(t, mem, decoded)
+		}
+	}
+
+	cpu := Cpu{User: 1, SoftIrq: 2, GuestNice: 3}
+	data, err = json.Marshal(cpu)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"softirq":2`)
+		assert.Contains(t, string(data), `"guest_nice":3`)
+
+		var decoded Cpu
+		if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+			assert.Equal(t, cpu, decoded)
+		}
+	}
+}
+
 func TestProcMem(t *testing.T) {
 	mem := ProcMem{}
 	assert.NoError(t, mem.Get(os.Getppid()))
@@ -115,13 +509,23 @@ func TestProcTime(t *testing.T) {
 	procTime := ProcTime{}
 	if assert.NoError(t, procTime.Get(os.Getppid())) {
 		// Sanity check the start time of the "go test" process.
-		delta := time.Now().Sub(time.Unix(0, int64(procTime.StartTime*uint64(time.Millisecond))))
+		delta := time.Since(procTime.StartedAt())
 		assert.True(t, delta > 0 && delta < 2*time.Minute, "ProcTime.StartTime differs by %v", delta)
 	}
 
 	assert.Error(t, procTime.Get(invalidPid))
 }
 
+func TestClockTicks(t *testing.T) {
+	assert.True(t, ClockTicks() > 0, "ClockTicks=%d", ClockTicks())
+}
+
+func TestProcTimeStartedAt(t *testing.T) {
+	procTime := ProcTime{StartTime: 1500000000123}
+	assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 123*int(time.Millisecond), time.UTC), procTime.StartedAt().UTC())
+	assert.Equal(t, time.Unix(0, 0), ProcTime{}.StartedAt())
+}
+
 func TestProcArgs(t *testing.T) {
 	args := ProcArgs{}
 	if assert.NoError(t, args.Get(os.Getppid())) {
@@ -147,6 +551,47 @@ func TestProcExe(t *testing.T) {
 	}
 }
 
+func TestProcFDs(t *testing.T) {
+	f, err := ioutil.TempFile("", "sigarFDs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	fds := ProcFDs{}
+	err = fds.Get(os.Getpid())
+	if !assert.NoError(t, skipNotImplemented(t, err, "darwin", "freebsd", "openbsd", "windows")) {
+		return
+	}
+
+	path, _ := filepath.EvalSymlinks(f.Name())
+	found := false
+	for i, fd := range fds.List {
+		if i > 0 {
+			assert.True(t, fds.List[i-1].Fd < fd.Fd, "fds not sorted")
+		}
+		if fd.Fd == int(f.Fd()) {
+			found = true
+			assert.Equal(t, path, fd.Target)
+		}
+	}
+	assert.True(t, found, "fd %d of %s not listed", f.Fd(), f.Name())
+
+	assert.True(t, IsProcessNotFound(fds.Get(invalidPid)))
+}
+
+func TestProcFDSocketInode(t *testing.T) {
+	inode, ok := ProcFD{Fd: 3, Target: "socket:[34567]"}.SocketInode()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(34567), inode)
+
+	_, ok = ProcFD{Fd: 4, Target: "pipe:[12345]"}.SocketInode()
+	assert.False(t, ok)
+	_, ok = ProcFD{Fd: 5, Target: "/var/log/socket:[1]"}.SocketInode()
+	assert.False(t, ok)
+}
+
 func skipNotImplemented(t testing.TB, err error, goos ...string) error {
 	for _, os := range goos {
 		if runtime.GOOS == os {
@@ -3,21 +3,45 @@
 package gosigar
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/elastic/gosigar/sys"
+	"github.com/elastic/gosigar/sys/linux"
+	"golang.org/x/sys/unix"
 )
 
-func init() {
-	system.ticks = 100 // C.sysconf(C._SC_CLK_TCK)
+// Sysd is the sysfs mount point the readers use, see Procd.
+var Sysd string
 
+func init() {
 	Procd = "/proc"
+	Sysd = "/sys"
+
+	system.ticks = uint64(linux.GetClockTicks())
 
 	getLinuxBootTime()
 }
 
 func getMountTableFileName() string {
+	if Procd != "/proc" {
+		// the mounts seen by the init process of another proc
+		return Procd + "/1/mounts"
+	}
 	return "/etc/mtab"
 }
 
@@ -30,9 +54,130 @@ func (self *Uptime) Get() error {
 
 	self.Length = float64(sysinfo.Uptime)
 
+	// e.g. 350735.47 234388.90, the idle time is not in sysinfo
+	self.Idle = 0
+	err := scanFile(Procd+"/uptime", func(line []byte) bool {
+		_, rest := nextField(line)
+		idle, _ := nextField(rest)
+		self.Idle, _ = strconv.ParseFloat(string(idle), 64)
+		return false
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (self *LoadAverage) Get() error {
+	parsed := false
+	var parseErr error
+	err := scanFile(Procd+"/loadavg", func(line []byte) bool {
+		parsed, parseErr = true, self.parse(line)
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if !parsed {
+		return self.parse(nil)
+	}
+	return parseErr
+}
+
+// parse reads a loadavg line, e.g. 0.20 0.18 0.12 1/80 11206
+func (self *LoadAverage) parse(line []byte) error {
+	var fields [5][]byte
+	n := 0
+	for rest := line; n < len(fields); n++ {
+		if fields[n], rest = nextField(rest); len(fields[n]) == 0 {
+			break
+		}
+	}
+	if n < 3 {
+		return fmt.Errorf("unexpected loadavg format: %q", line)
+	}
+
+	self.One, _ = strconv.ParseFloat(string(fields[0]), 64)
+	self.Five, _ = strconv.ParseFloat(string(fields[1]), 64)
+	self.Fifteen, _ = strconv.ParseFloat(string(fields[2]), 64)
+
+	if n > 3 {
+		if i := bytes.IndexByte(fields[3], '/'); i > 0 {
+			self.Runnable, _ = parseUint(fields[3][:i])
+			self.Total, _ = parseUint(fields[3][i+1:])
+		}
+	}
+	if n > 4 {
+		pid, _ := parseUint(fields[4])
+		self.LastPid = int(pid)
+	}
+
+	return nil
+}
+
+func (self *Swap) Get() error {
+
+	table, err := parseMeminfo()
+	if err != nil {
+		return err
+	}
+	self.Total, _ = table["SwapTotal"]
+	self.Free, _ = table["SwapFree"]
+
+	self.Used = self.Total - self.Free
+
+	// linprocfs on FreeBSD has no vmstat
+	err = readFile(Procd+"/vmstat", func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return true
+		}
+		switch fields[0] {
+		case "pswpin":
+			self.PageIn, _ = strtoull(fields[1])
+		case "pswpout":
+			self.PageOut, _ = strtoull(fields[1])
+		}
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
+func (self *Cpu) Get() error {
+	return scanFile(Procd+"/stat", func(line []byte) bool {
+		if len(line) > 4 && string(line[0:4]) == "cpu " {
+			parseCpuStat(self, line)
+			return false
+		}
+		return true
+
+	})
+}
+
+func (self *CpuList) Get() error {
+	capacity := len(self.List)
+	if capacity == 0 {
+		capacity = 4
+	}
+	list := make([]Cpu, 0, capacity)
+
+	err := scanFile(Procd+"/stat", func(line []byte) bool {
+		if len(line) > 3 && string(line[0:3]) == "cpu" && line[3] != ' ' {
+			cpu := Cpu{}
+			parseCpuStat(&cpu, line)
+			list = append(list, cpu)
+		}
+		return true
+	})
+
+	self.List = list
+
+	return err
+}
+
 func (self *FDUsage) Get() error {
 	return readFile(Procd+"/sys/fs/file-nr", func(line string) bool {
 		fields := strings.Fields(line)
@@ -57,52 +202,1573 @@ func (self *HugeTLBPages) Get() error {
 	self.Surplus, _ = table["HugePages_Surp"]
 	self.DefaultSize, _ = table["Hugepagesize"]
 
+	self.Sizes, err = readHugePageSizes()
+	if err != nil {
+		return err
+	}
+
 	if totalSize, found := table["Hugetlb"]; found {
 		self.TotalAllocatedSize = totalSize
+	} else if len(self.Sizes) > 0 {
+		// Before Linux 4.16 meminfo only counts the default size
+		self.TotalAllocatedSize = 0
+		for _, pages := range self.Sizes {
+			self.TotalAllocatedSize += (pages.Total - pages.Free + pages.Reserved) * pages.SizeBytes
+		}
 	} else {
-		// If Hugetlb is not present, or huge pages of different sizes
-		// are used, this figure can be unaccurate.
-		// TODO (jsoriano): Extract information from /sys/kernel/mm/hugepages too
 		self.TotalAllocatedSize = (self.Total - self.Free + self.Reserved) * self.DefaultSize
 	}
 
 	return nil
 }
 
-func (self *ProcFDUsage) Get(pid int) error {
-	err := readFile(procFileName(pid, "limits"), func(line string) bool {
-		if strings.HasPrefix(line, "Max open files") {
+// readHugePageSizes reads the pools of /sys/kernel/mm/hugepages, which
+// does not exist when the kernel has no huge pages support
+func readHugePageSizes() ([]HugePages, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(Sysd, "kernel/mm/hugepages"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sizes []HugePages
+	for _, dir := range dirs {
+		// e.g. hugepages-2048kB
+		name := dir.Name()
+		if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+			continue
+		}
+		kB, err := strtoull(name[len("hugepages-") : len(name)-len("kB")])
+		if err != nil {
+			continue
+		}
+
+		pages := HugePages{SizeBytes: kB * 1024}
+		for file, value := range map[string]*uint64{
+			"nr_hugepages":      &pages.Total,
+			"free_hugepages":    &pages.Free,
+			"resv_hugepages":    &pages.Reserved,
+			"surplus_hugepages": &pages.Surplus,
+		} {
+			contents, err := ioutil.ReadFile(filepath.Join(Sysd, "kernel/mm/hugepages", name, file))
+			if err != nil {
+				return nil, err
+			}
+			*value, _ = strtoull(strings.TrimSpace(string(contents)))
+		}
+		sizes = append(sizes, pages)
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].SizeBytes < sizes[j].SizeBytes })
+	return sizes, nil
+}
+
+// /proc/swaps escapes the whitespace and backslashes of the file names
+var swapNameUnescaper = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+func (self *SwapDeviceList) Get() error {
+	self.List = []SwapDevice{}
+
+	// missing when the kernel has no swap support
+	err := readFile(Procd+"/swaps", func(line string) bool {
+		// Filename  Type  Size  Used  Priority, the sizes in kB
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] == "Filename" {
+			return true
+		}
+
+		size, err := strtoull(fields[2])
+		if err != nil {
+			return true
+		}
+		used, _ := strtoull(fields[3])
+		priority, _ := strconv.Atoi(fields[4])
+
+		self.List = append(self.List, SwapDevice{
+			Name:     swapNameUnescaper.Replace(fields[0]),
+			Type:     fields[1],
+			Size:     size * 1024,
+			Used:     used * 1024,
+			Priority: priority,
+		})
+		return true
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (self *CpuFreq) Get(core int) error {
+	dir := filepath.Join(Sysd, "devices/system/cpu", "cpu"+strconv.Itoa(core), "cpufreq")
+
+	cur, err := readKHz(filepath.Join(dir, "scaling_cur_freq"))
+	if os.IsNotExist(err) {
+		// no cpufreq driver, e.g. in most virtual machines
+		return self.getCpuinfo(core)
+	}
+	if err != nil {
+		return err
+	}
+
+	self.Current = cur / 1000
+	if min, err := readKHz(filepath.Join(dir, "cpuinfo_min_freq")); err == nil {
+		self.Min = min / 1000
+	}
+	if max, err := readKHz(filepath.Join(dir, "cpuinfo_max_freq")); err == nil {
+		self.Max = max / 1000
+	}
+
+	return nil
+}
+
+func (self *CpuTopology) Get() error {
+	dir := filepath.Join(Sysd, "devices/system/cpu")
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	self.Cpus = nil
+	for _, entry := range entries {
+		// cpu0, cpu1... next to cpufreq, cpuidle and others
+		if !strings.HasPrefix(entry.Name(), "cpu") {
+			continue
+		}
+		n, err := strconv.Atoi(entry.Name()[len("cpu"):])
+		if err != nil {
+			continue
+		}
+		cpuDir := filepath.Join(dir, entry.Name())
+
+		// offline CPUs have no topology
+		pkg, err := readInt(filepath.Join(cpuDir, "topology/physical_package_id"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		core, err := readInt(filepath.Join(cpuDir, "topology/core_id"))
+		if err != nil {
+			return err
+		}
+
+		cpu := LogicalCpu{Cpu: n, Package: pkg, Core: core}
+		if nodes, _ := filepath.Glob(filepath.Join(cpuDir, "node[0-9]*")); len(nodes) > 0 {
+			cpu.Node, _ = strconv.Atoi(strings.TrimPrefix(filepath.Base(nodes[0]), "node"))
+		}
+		self.Cpus = append(self.Cpus, cpu)
+	}
+
+	sort.Slice(self.Cpus, func(i, j int) bool { return self.Cpus[i].Cpu < self.Cpus[j].Cpu })
+	return nil
+}
+
+func (self *NumaNodeList) Get() error {
+	dir := filepath.Join(Sysd, "devices/system/node")
+	nodes, err := filepath.Glob(filepath.Join(dir, "node[0-9]*"))
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return self.getSingleNode()
+	}
+
+	self.List = nil
+	for _, nodeDir := range nodes {
+		n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDir), "node"))
+		if err != nil {
+			continue
+		}
+		node := NumaNode{Node: n}
+
+		// Node 0 MemTotal:       16305372 kB
+		err = readFile(filepath.Join(nodeDir, "meminfo"), func(line string) bool {
 			fields := strings.Fields(line)
-			if len(fields) == 6 {
-				self.SoftLimit, _ = strconv.ParseUint(fields[3], 10, 64)
-				self.HardLimit, _ = strconv.ParseUint(fields[4], 10, 64)
+			if len(fields) < 4 {
+				return true
+			}
+			value, err := strtoull(fields[3])
+			if err != nil {
+				return true
+			}
+			switch fields[2] {
+			case "MemTotal:":
+				node.TotalBytes = value * 1024
+			case "MemFree:":
+				node.FreeBytes = value * 1024
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(nodeDir, "cpulist"))
+		if err != nil {
+			return err
+		}
+		if node.Cpus, err = parseCpuList(string(contents)); err != nil {
+			return err
+		}
+
+		self.List = append(self.List, node)
+	}
+
+	sort.Slice(self.List, func(i, j int) bool { return self.List[i].Node < self.List[j].Node })
+	return nil
+}
+
+// Describe a kernel without NUMA support as a single node
+func (self *NumaNodeList) getSingleNode() error {
+	mem := Mem{}
+	if err := mem.Get(); err != nil {
+		return err
+	}
+	node := NumaNode{TotalBytes: mem.Total, FreeBytes: mem.Free}
+
+	var err error
+	if node.Cpus, err = readCpuList("online"); err != nil {
+		return err
+	}
+
+	self.List = []NumaNode{node}
+	return nil
+}
+
+// numCpu counts the online and possible CPU lists of the kernel.
+func numCpu() (online, possible int, err error) {
+	cpus, err := readCpuList("online")
+	if err != nil {
+		return 0, 0, err
+	}
+	all, err := readCpuList("possible")
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(cpus), len(all), nil
+}
+
+// getPressure returns the pressure stall information of the CPU, memory
+// and I/O from /proc/pressure. It returns an ErrNotImplemented before
+// Linux 4.20 and when PSI is disabled.
+func getPressure() (cpu, mem, io PressureStall, err error) {
+	for name, psi := range map[string]*PressureStall{"cpu": &cpu, "memory": &mem, "io": &io} {
+		if err = psi.get(Procd + "/pressure/" + name); err != nil {
+			return PressureStall{}, PressureStall{}, PressureStall{}, err
+		}
+	}
+	return cpu, mem, io, nil
+}
+
+// e.g. some avg10=0.12 avg60=0.34 avg300=0.56 total=123456
+func (self *PressureStall) get(file string) error {
+	err := readFile(file, func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return true
+		}
+
+		var avg10, avg60, avg300 *float64
+		var total *uint64
+		switch fields[0] {
+		case "some":
+			avg10, avg60, avg300, total = &self.Some10, &self.Some60, &self.Some300, &self.SomeTotal
+		case "full":
+			avg10, avg60, avg300, total = &self.Full10, &self.Full60, &self.Full300, &self.FullTotal
+		default:
+			return true
+		}
+
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "avg10":
+				*avg10, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				*avg60, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				*avg300, _ = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				*total, _ = strtoull(kv[1])
 			}
-			return false
 		}
 		return true
 	})
+	// the files are missing before Linux 4.20 and
+	// cannot be read when PSI is disabled at boot
+	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EOPNOTSUPP || os.IsNotExist(err) {
+		return ErrNotImplemented{runtime.GOOS}
+	}
+	return err
+}
+
+// readCpuList reads a list of /sys/devices/system/cpu, like "online"
+func readCpuList(name string) ([]int, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(Sysd, "devices/system/cpu", name))
+	if err != nil {
+		return nil, err
+	}
+	return parseCpuList(string(contents))
+}
+
+// parseCpuList parses the CPU list format of sysfs, like "0-3,8-11"
+func parseCpuList(list string) ([]int, error) {
+	cpus := []int{}
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q: %v", list, err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid cpu list %q: %v", list, err)
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid cpu list %q: range %s is reversed", list, part)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func (self *TemperatureList) Get() error {
+	sensors, err := hwmonSensors("temp")
 	if err != nil {
 		return err
 	}
-	fds, err := ioutil.ReadDir(procFileName(pid, "fd"))
+
+	self.List = []Temperature{}
+	for _, sensor := range sensors {
+		// disconnected sensors fail with EIO or ENODATA
+		millis, err := readInt(sensor.prefix + "_input")
+		if err != nil {
+			continue
+		}
+
+		temp := Temperature{
+			SensorName: sensor.chip,
+			Label:      sensor.label,
+			Celsius:    float64(millis) / 1000,
+		}
+		if max, err := readInt(sensor.prefix + "_max"); err == nil {
+			temp.HighThreshold = float64(max) / 1000
+		}
+		if crit, err := readInt(sensor.prefix + "_crit"); err == nil {
+			temp.CriticalThreshold = float64(crit) / 1000
+		}
+		self.List = append(self.List, temp)
+	}
+
+	return nil
+}
+
+func (self *FanList) Get() error {
+	sensors, err := hwmonSensors("fan")
 	if err != nil {
 		return err
 	}
-	self.Open = uint64(len(fds))
+
+	self.List = []Fan{}
+	for _, sensor := range sensors {
+		rpm, err := readInt(sensor.prefix + "_input")
+		if err != nil {
+			continue
+		}
+		self.List = append(self.List, Fan{Name: sensor.chip, Label: sensor.label, RPM: rpm})
+	}
+
+	return nil
+}
+
+// A sensor of a hwmon chip
+type hwmonSensor struct {
+	chip   string // Name of the chip, like coretemp
+	label  string // Label of the sensor, or its prefix like temp1
+	prefix string // Path of the sensor files without the _input suffix
+}
+
+// hwmonSensors lists the sensors of a kind, like "temp" or "fan", that
+// have an input file, in the order of the chips and the sensor numbers
+func hwmonSensors(kind string) ([]hwmonSensor, error) {
+	chips, err := filepath.Glob(filepath.Join(Sysd, "class/hwmon/hwmon[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(chips)
+
+	var sensors []hwmonSensor
+	for _, chip := range chips {
+		name, _ := ioutil.ReadFile(filepath.Join(chip, "name"))
+
+		inputs, err := filepath.Glob(filepath.Join(chip, kind+"[0-9]*_input"))
+		if err != nil {
+			return nil, err
+		}
+		// temp2_input before temp10_input
+		sort.Slice(inputs, func(i, j int) bool {
+			return hwmonIndex(inputs[i], kind) < hwmonIndex(inputs[j], kind)
+		})
+
+		for _, input := range inputs {
+			sensor := hwmonSensor{
+				chip:   strings.TrimSpace(string(name)),
+				prefix: strings.TrimSuffix(input, "_input"),
+			}
+			sensor.label = filepath.Base(sensor.prefix)
+			if label, err := ioutil.ReadFile(sensor.prefix + "_label"); err == nil {
+				sensor.label = strings.TrimSpace(string(label))
+			}
+			sensors = append(sensors, sensor)
+		}
+	}
+
+	return sensors, nil
+}
+
+// hwmonIndex returns the number of a hwmon file like temp12_input
+func hwmonIndex(file, kind string) int {
+	name := strings.TrimPrefix(filepath.Base(file), kind)
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		name = name[:i]
+	}
+	n, _ := strconv.Atoi(name)
+	return n
+}
+
+func (self *BatteryList) Get() error {
+	dirs, err := filepath.Glob(filepath.Join(Sysd, "class/power_supply/BAT*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(dirs)
+
+	self.List = []Battery{}
+	for _, dir := range dirs {
+		self.List = append(self.List, readBattery(dir))
+	}
 	return nil
 }
 
-func parseCpuStat(self *Cpu, line string) error {
-	fields := strings.Fields(line)
+// Values of the power_supply status attribute
+var batteryStates = map[string]BatteryState{
+	"Charging":     BatteryCharging,
+	"Discharging":  BatteryDischarging,
+	"Not charging": BatteryNotCharging,
+	"Full":         BatteryFull,
+}
+
+// readBattery reads a power_supply directory, batteries report either
+// their charge in µAh with the current in µA, or their energy in µWh
+// with the power in µW
+func readBattery(dir string) Battery {
+	readValue := func(name string) (float64, bool) {
+		n, err := readInt(filepath.Join(dir, name))
+		return float64(n), err == nil
+	}
+
+	battery := Battery{Name: filepath.Base(dir), State: BatteryUnknown}
+	if status, err := ioutil.ReadFile(filepath.Join(dir, "status")); err == nil {
+		if state, ok := batteryStates[strings.TrimSpace(string(status))]; ok {
+			battery.State = state
+		}
+	}
+	if cycles, ok := readValue("cycle_count"); ok {
+		battery.Cycles = int(cycles)
+	}
+
+	now, okNow := readValue("charge_now")
+	full, okFull := readValue("charge_full")
+	rate, okRate := readValue("current_now")
+	if !okNow {
+		now, okNow = readValue("energy_now")
+		full, okFull = readValue("energy_full")
+		rate, okRate = readValue("power_now")
+	}
+
+	if capacity, ok := readValue("capacity"); ok {
+		battery.Percent = capacity
+	} else if okNow && okFull && full > 0 {
+		battery.Percent = now / full * 100
+	}
+
+	// some drivers report a negative current while discharging
+	if rate < 0 {
+		rate = -rate
+	}
+	if okNow && okRate && rate > 0 {
+		var hours float64
+		switch battery.State {
+		case BatteryDischarging:
+			hours = now / rate
+		case BatteryCharging:
+			if okFull && full > now {
+				hours = (full - now) / rate
+			}
+		}
+		battery.TimeRemaining = time.Duration(hours * float64(time.Hour))
+	}
+
+	return battery
+}
+
+// Read a sysfs file holding a single integer
+func readInt(file string) (int, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
+}
+
+// Read the "cpu MHz" of core from /proc/cpuinfo, which has no min and max
+func (self *CpuFreq) getCpuinfo(core int) error {
+	var found, inCore bool
 
-	self.User, _ = strtoull(fields[1])
-	self.Nice, _ = strtoull(fields[2])
-	self.Sys, _ = strtoull(fields[3])
-	self.Idle, _ = strtoull(fields[4])
-	self.Wait, _ = strtoull(fields[5])
-	self.Irq, _ = strtoull(fields[6])
-	self.SoftIrq, _ = strtoull(fields[7])
-	self.Stolen, _ = strtoull(fields[8])
+	err := readFile(Procd+"/cpuinfo", func(line string) bool {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			return true
+		}
+		key := strings.TrimSpace(fields[0])
+		value := strings.TrimSpace(fields[1])
+
+		switch key {
+		case "processor":
+			n, err := strconv.Atoi(value)
+			inCore = err == nil && n == core
+		case "cpu MHz":
+			if inCore {
+				mhz, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					self.Current = uint64(mhz + 0.5)
+					found = true
+				}
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no frequency found for cpu %d", core)
+	}
+
+	self.Min = 0
+	self.Max = 0
+	return nil
+}
+
+// Read a cpufreq sysfs file, which holds a frequency in kHz
+func readKHz(path string) (uint64, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strtoull(strings.TrimSpace(string(contents)))
+}
+
+func (self *DiskIoList) Get() error {
+	list := make(map[string]DiskIo)
+
+	err := readFile(Procd+"/diskstats", func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 14 {
+			return true
+		}
+
+		name := fields[2]
+		if !self.IncludePartitions && !isWholeDisk(name) {
+			return true
+		}
+
+		disk := DiskIo{}
+		disk.ReadOps, _ = strtoull(fields[3])
+		sectorsRead, _ := strtoull(fields[5])
+		disk.ReadTime, _ = strtoull(fields[6])
+		disk.WriteOps, _ = strtoull(fields[7])
+		sectorsWritten, _ := strtoull(fields[9])
+		disk.WriteTime, _ = strtoull(fields[10])
+		disk.IoTime, _ = strtoull(fields[12])
+
+		// diskstats sectors are always 512 bytes, whatever the device
+		disk.ReadBytes = sectorsRead * 512
+		disk.WriteBytes = sectorsWritten * 512
+
+		list[name] = disk
+		return true
+	})
+
+	self.List = list
+
+	return err
+}
+
+// Only whole disks have a /sys/block entry, partitions are below
+// the entry of their disk. Slashes in names are "!" in sysfs.
+func isWholeDisk(name string) bool {
+	_, err := os.Stat(filepath.Join(Sysd, "block", strings.Replace(name, "/", "!", -1)))
+	return err == nil
+}
+
+func (self *NetIfaceStatList) Get() error {
+	capacity := len(self.List)
+	if capacity == 0 {
+		capacity = 4
+	}
+	list := make([]NetIfaceStat, 0, capacity)
+
+	err := readFile(Procd+"/net/dev", func(line string) bool {
+		// names may contain colons, the counters do not
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return true // header
+		}
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 16 {
+			return true
+		}
+
+		iface := NetIfaceStat{Name: strings.TrimSpace(line[:i])}
+		iface.Loopback = isLoopback(iface.Name)
+		iface.RxBytes, _ = strtoull(fields[0])
+		iface.RxPackets, _ = strtoull(fields[1])
+		iface.RxErrors, _ = strtoull(fields[2])
+		iface.RxDropped, _ = strtoull(fields[3])
+		iface.TxBytes, _ = strtoull(fields[8])
+		iface.TxPackets, _ = strtoull(fields[9])
+		iface.TxErrors, _ = strtoull(fields[10])
+		iface.TxDropped, _ = strtoull(fields[11])
+
+		list = append(list, iface)
+		return true
+	})
+
+	self.List = list
+
+	return err
+}
+
+func (self *NetProtoStats) Get() error {
+	err := readNetSnmp(Procd+"/net/snmp", map[string]map[string]*uint64{
+		"Ip": {
+			"InReceives":    &self.IP.InReceives,
+			"InHdrErrors":   &self.IP.InHdrErrors,
+			"InAddrErrors":  &self.IP.InAddrErrors,
+			"InDiscards":    &self.IP.InDiscards,
+			"InDelivers":    &self.IP.InDelivers,
+			"ForwDatagrams": &self.IP.ForwDatagrams,
+			"OutRequests":   &self.IP.OutRequests,
+			"OutDiscards":   &self.IP.OutDiscards,
+			"OutNoRoutes":   &self.IP.OutNoRoutes,
+			"ReasmFails":    &self.IP.ReasmFails,
+			"FragFails":     &self.IP.FragFails,
+		},
+		"Tcp": {
+			"ActiveOpens":  &self.TCP.ActiveOpens,
+			"PassiveOpens": &self.TCP.PassiveOpens,
+			"AttemptFails": &self.TCP.AttemptFails,
+			"EstabResets":  &self.TCP.EstabResets,
+			"CurrEstab":    &self.TCP.CurrEstab,
+			"InSegs":       &self.TCP.InSegs,
+			"OutSegs":      &self.TCP.OutSegs,
+			"RetransSegs":  &self.TCP.RetransSegs,
+			"InErrs":       &self.TCP.InErrs,
+			"OutRsts":      &self.TCP.OutRsts,
+		},
+		"Udp": {
+			"InDatagrams":  &self.UDP.InDatagrams,
+			"NoPorts":      &self.UDP.NoPorts,
+			"InErrors":     &self.UDP.InErrors,
+			"OutDatagrams": &self.UDP.OutDatagrams,
+			"RcvbufErrors": &self.UDP.RcvbufErrors,
+			"SndbufErrors": &self.UDP.SndbufErrors,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readNetSnmp(Procd+"/net/netstat", map[string]map[string]*uint64{
+		"TcpExt": {
+			"ListenOverflows": &self.TCP.ListenOverflows,
+			"ListenDrops":     &self.TCP.ListenDrops,
+			"TCPTimeouts":     &self.TCP.Timeouts,
+		},
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readNetSnmp reads the counters of /proc/net/snmp or /proc/net/netstat,
+// where each protocol has a line of names followed by a line of values,
+// both starting with the protocol like "Tcp:", into the fields of their
+// protocol and name. Negative values, like the Tcp MaxConn of -1, and
+// unknown names are skipped.
+func readNetSnmp(file string, fields map[string]map[string]*uint64) error {
+	var names []string
+	return readFile(file, func(line string) bool {
+		values := strings.Fields(line)
+		if len(values) == 0 {
+			return true
+		}
+		if names == nil || names[0] != values[0] {
+			names = values
+			return true
+		}
+
+		if protocol, ok := fields[strings.TrimSuffix(values[0], ":")]; ok {
+			for i := 1; i < len(values) && i < len(names); i++ {
+				if ptr, ok := protocol[names[i]]; ok {
+					*ptr, _ = strtoull(values[i])
+				}
+			}
+		}
+		names = nil
+		return true
+	})
+}
+
+// Check IFF_LOOPBACK in the sysfs flags of the interface
+func isLoopback(name string) bool {
+	contents, err := ioutil.ReadFile(filepath.Join(Sysd, "class/net", name, "flags"))
+	if err != nil {
+		return false
+	}
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 0, 32)
+	return err == nil && flags&syscall.IFF_LOOPBACK != 0
+}
+
+// /proc/net tables of the supported protocols
+var netConnTables = []struct {
+	name  string
+	flags NetConnFlags
+}{
+	{"tcp", NetConnTCP | NetConnIPv4},
+	{"tcp6", NetConnTCP | NetConnIPv6},
+	{"udp", NetConnUDP | NetConnIPv4},
+	{"udp6", NetConnUDP | NetConnIPv6},
+}
+
+func (self *NetConnectionList) Get(flags NetConnFlags) error {
+	if flags&(NetConnTCP|NetConnUDP) == 0 {
+		flags |= NetConnTCP | NetConnUDP
+	}
+	if flags&(NetConnIPv4|NetConnIPv6) == 0 {
+		flags |= NetConnIPv4 | NetConnIPv6
+	}
+
+	var list []NetConnection
+	for _, table := range netConnTables {
+		if flags&table.flags&(NetConnTCP|NetConnUDP) == 0 ||
+			flags&table.flags&(NetConnIPv4|NetConnIPv6) == 0 {
+			continue
+		}
+
+		conns, err := readNetConnections(table.name)
+		if os.IsNotExist(err) {
+			continue // e.g. IPv6 disabled
+		}
+		if err != nil {
+			return err
+		}
+		list = append(list, conns...)
+	}
+
+	if flags&NetConnPid != 0 {
+		owners, err := socketOwners()
+		if err != nil {
+			return err
+		}
+		for i := range list {
+			list[i].Pid = owners[list[i].Inode]
+		}
+	}
+
+	self.List = list
+
+	return nil
+}
+
+// Get lists the sockets of pid found in the /proc/net tables, the
+// error satisfies os.IsPermission when the fds of pid are not readable.
+func (self *ProcNetConnections) Get(pid int) error {
+	inodes, err := socketInodes(pid)
+	if err != nil {
+		return err
+	}
+
+	self.List = []NetConnection{}
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	open := make(map[uint64]bool, len(inodes))
+	for _, inode := range inodes {
+		open[inode] = true
+	}
+
+	all := NetConnectionList{}
+	if err := all.Get(NetConnAll); err != nil {
+		return err
+	}
+	for _, conn := range all.List {
+		if open[conn.Inode] {
+			conn.Pid = pid
+			self.List = append(self.List, conn)
+		}
+	}
+
+	return nil
+}
+
+// Parse a /proc/net/{tcp,tcp6,udp,udp6} table
+func readNetConnections(protocol string) ([]NetConnection, error) {
+	var conns []NetConnection
+
+	err := readFile(filepath.Join(Procd, "net", protocol), func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[0] == "sl" {
+			return true
+		}
+
+		conn := NetConnection{Protocol: protocol}
+		var err error
+		if conn.LocalAddr, conn.LocalPort, err = parseNetAddr(fields[1]); err != nil {
+			return true
+		}
+		if conn.RemoteAddr, conn.RemotePort, err = parseNetAddr(fields[2]); err != nil {
+			return true
+		}
+		if state, err := strconv.ParseUint(fields[3], 16, 8); err == nil {
+			conn.State = linux.TCPState(state).String()
+		}
+		conn.Inode, _ = strtoull(fields[9])
+
+		conns = append(conns, conn)
+		return true
+	})
+
+	return conns, err
+}
+
+// Decode an "address:port" of the /proc/net tables, the address is hex
+// encoded as 32 bit words in host byte order and the port is big endian.
+// An IPv6 address is four such words: on little endian hosts ::1 is
+// 00000000000000000000000001000000.
+func parseNetAddr(s string) (net.IP, uint16, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, 0, fmt.Errorf("invalid socket address %q", s)
+	}
+
+	words, err := hex.DecodeString(s[:i])
+	if err != nil || (len(words) != net.IPv4len && len(words) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid socket address %q", s)
+	}
+	port, err := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid socket port %q", s)
+	}
+
+	ip := make(net.IP, len(words))
+	for w := 0; w < len(words); w += 4 {
+		sys.GetEndian().PutUint32(ip[w:], binary.BigEndian.Uint32(words[w:]))
+	}
+
+	return ip, uint16(port), nil
+}
+
+// Map the inode of every socket to the pid of a process having it open.
+// Processes whose fds are not readable are skipped.
+func socketOwners() (map[uint64]int, error) {
+	pids := ProcList{}
+	if err := pids.Get(); err != nil {
+		return nil, err
+	}
+
+	owners := make(map[uint64]int)
+	for _, pid := range pids.List {
+		inodes, err := socketInodes(pid)
+		if err != nil {
+			continue
+		}
+		for _, inode := range inodes {
+			owners[inode] = pid
+		}
+	}
+
+	return owners, nil
+}
+
+// List the inodes of the sockets open by pid
+func socketInodes(pid int) ([]uint64, error) {
+	dir := procFileName(pid, "fd")
+	fds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var inodes []uint64
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strtoull(strings.TrimSuffix(link[len("socket:["):], "]"))
+		if err == nil {
+			inodes = append(inodes, inode)
+		}
+	}
+
+	return inodes, nil
+}
+
+func (self *ProcFDUsage) Get(pid int) error {
+	err := readFile(procFileName(pid, "limits"), func(line string) bool {
+		if strings.HasPrefix(line, "Max open files") {
+			fields := strings.Fields(line)
+			if len(fields) == 6 {
+				self.SoftLimit, _ = strconv.ParseUint(fields[3], 10, 64)
+				self.HardLimit, _ = strconv.ParseUint(fields[4], 10, 64)
+			}
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return procFileError(pid, procFileName(pid, "limits"), err)
+	}
+	fds, err := ioutil.ReadDir(procFileName(pid, "fd"))
+	if err != nil {
+		return procFileError(pid, procFileName(pid, "fd"), err)
+	}
+	self.Open = uint64(len(fds))
+	return nil
+}
+
+func (self *ProcFDs) Get(pid int) error {
+	dir := procFileName(pid, "fd")
+	fds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return procFileError(pid, dir, err)
+	}
+
+	self.List = make([]ProcFD, 0, len(fds))
+	for _, fd := range fds {
+		n, err := strconv.Atoi(fd.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, fd.Name()))
+		if os.IsNotExist(err) {
+			// the fd was closed since the directory was read
+			continue
+		}
+		if err != nil {
+			return procFileError(pid, filepath.Join(dir, fd.Name()), err)
+		}
+		self.List = append(self.List, ProcFD{Fd: n, Target: target})
+	}
+
+	sort.Slice(self.List, func(i, j int) bool { return self.List[i].Fd < self.List[j].Fd })
+	return nil
+}
+
+func (self *ProcThreads) Get(pid int) error {
+	tasks, err := ioutil.ReadDir(procFileName(pid, "task"))
+	if err != nil {
+		return procFileError(pid, procFileName(pid, "task"), err)
+	}
+
+	self.List = make([]ThreadInfo, 0, len(tasks))
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(procFileName(pid, "task"), task.Name(), "stat")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			// the task directory of the thread is like a pid directory
+			err = procFileErrorIn(procFileName(pid, "task"), tid, path, err)
+			if !IsProcessNotFound(err) {
+				return err
+			}
+			if _, serr := os.Stat(filepath.Join(Procd, strconv.Itoa(pid))); os.IsNotExist(serr) {
+				return ErrProcessNotFound
+			}
+			// the thread exited since the task directory was read
+			continue
+		}
+
+		thread, err := parseThreadStat(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse stat of thread %d of pid %d: %v", tid, pid, err)
+		}
+		thread.Tid = tid
+		self.List = append(self.List, thread)
+	}
+
+	return nil
+}
+
+// parseThreadStat reads the name, state and CPU times of a stat file,
+// the name can contain spaces and parentheses
+func parseThreadStat(data []byte) (ThreadInfo, error) {
+	stat, err := parseProcStat(data, 13)
+	if err != nil {
+		return ThreadInfo{}, err
+	}
+	fields := stat.fields
+
+	thread := ThreadInfo{Name: stat.comm}
+	thread.State = ParseRunState(fields[0][0])
+
+	user, _ := strtoull(fields[11])
+	sys, _ := strtoull(fields[12])
+	// convert to millis
+	thread.UserTime = user * 1000 / system.ticks
+	thread.SysTime = sys * 1000 / system.ticks
+
+	return thread, nil
+}
+
+func (self *ProcLimits) Get(pid int) error {
+	self.Limits = make(map[string]ProcLimit)
+
+	header := true
+	err := readFile(procFileName(pid, "limits"), func(line string) bool {
+		if header {
+			header = false
+			return true
+		}
+
+		// the names have several words and no digits, followed by
+		// the soft and hard limits and the units, if any
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			soft, err := parseLimit(fields[i])
+			if err != nil {
+				continue
+			}
+			hard, err := parseLimit(fields[i+1])
+			if err != nil {
+				break
+			}
+			self.Limits[strings.Join(fields[:i], " ")] = ProcLimit{
+				Soft:  soft,
+				Hard:  hard,
+				Units: strings.Join(fields[i+2:], " "),
+			}
+			break
+		}
+		return true
+	})
+	if err != nil {
+		return procFileError(pid, procFileName(pid, "limits"), err)
+	}
+	return nil
+}
+
+func parseLimit(val string) (uint64, error) {
+	if val == "unlimited" {
+		return LimitUnlimited, nil
+	}
+	return strtoull(val)
+}
+
+func (self *ProcIo) Get(pid int) error {
+	path := procFileName(pid, "io")
+	fields := map[string]*uint64{
+		"rchar":                 &self.RChar,
+		"wchar":                 &self.WChar,
+		"syscr":                 &self.Syscr,
+		"syscw":                 &self.Syscw,
+		"read_bytes":            &self.ReadBytes,
+		"write_bytes":           &self.WriteBytes,
+		"cancelled_write_bytes": &self.CancelledWriteBytes,
+	}
+
+	err := readFile(path, func(line string) bool {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return true
+		}
+		if ptr, ok := fields[parts[0]]; ok {
+			*ptr, _ = strtoull(strings.TrimSpace(parts[1]))
+		}
+		return true
+	})
+	if err != nil {
+		return procFileError(pid, path, err)
+	}
+	return nil
+}
+
+func (self *ProcMaps) Get(pid int) error {
+	path := procFileName(pid, "maps")
+
+	// the same files and perms repeat on many lines
+	names := make(map[string]string)
+	intern := func(b []byte) string {
+		if s, ok := names[string(b)]; ok {
+			return s
+		}
+		s := string(b)
+		names[s] = s
+		return s
+	}
+
+	list := make([]ProcMap, 0, len(self.List))
+	var parseErr error
+	err := scanFile(path, func(line []byte) bool {
+		// e.g. 7f2c4a1e5000-7f2c4a20b000 r-xp 00000000 08:01 1835036   /usr/lib/libc.so.6
+		var m ProcMap
+		addrs, rest := nextField(line)
+		perms, rest := nextField(rest)
+		offset, rest := nextField(rest)
+		dev, rest := nextField(rest)
+		inode, rest := nextField(rest)
+
+		i := bytes.IndexByte(addrs, '-')
+		ok := i > 0
+		if ok {
+			m.Start, ok = parseHex(addrs[:i])
+		}
+		if ok {
+			m.End, ok = parseHex(addrs[i+1:])
+		}
+		if ok {
+			m.Offset, ok = parseHex(offset)
+		}
+		if ok {
+			m.Inode, ok = parseUint(inode)
+		}
+		if !ok || len(perms) == 0 || len(dev) == 0 {
+			parseErr = fmt.Errorf("failed to parse maps for pid %d from '%s'", pid, line)
+			return false
+		}
+
+		m.Perms = intern(perms)
+		m.Dev = intern(dev)
+		m.Path = intern(bytes.TrimLeft(rest, " \t"))
+		list = append(list, m)
+		return true
+	})
+	if err != nil {
+		return procFileError(pid, path, err)
+	}
+	if parseErr != nil {
+		return parseErr
+	}
+	self.List = list
+
+	return self.getRollup(pid)
+}
+
+// getRollup reads the resident sizes of smaps_rollup, which is missing
+// before Linux 4.14
+func (self *ProcMaps) getRollup(pid int) error {
+	self.Rss, self.Pss, self.AnonRss, self.FileRss, self.Swap = 0, 0, 0, 0, 0
+
+	path := procFileName(pid, "smaps_rollup")
+	err := scanFile(path, func(line []byte) bool {
+		key, value, ok := splitKeyValue(line, ':')
+		if !ok {
+			return true // the header line, the range of the rolled up maps
+		}
+		var field *uint64
+		switch string(key) {
+		case "Rss":
+			field = &self.Rss
+		case "Pss":
+			field = &self.Pss
+		case "Anonymous":
+			field = &self.AnonRss
+		case "Swap":
+			field = &self.Swap
+		default:
+			return true
+		}
+		number, rest := nextField(value)
+		*field, _ = parseUint(number)
+		if unit, _ := nextField(rest); string(unit) == "kB" {
+			*field *= 1024
+		}
+		return true
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return procFileError(pid, path, err)
+	}
+	if self.Rss > self.AnonRss {
+		self.FileRss = self.Rss - self.AnonRss
+	}
+	return nil
+}
+
+// parseHex is like parseUint for hexadecimal fields, like the addresses
+// of the maps.
+func parseHex(field []byte) (uint64, bool) {
+	if len(field) == 0 || len(field) > 16 {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range field {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		n = n<<4 | uint64(c)
+	}
+	return n, true
+}
+
+func (self *ProcDiskIo) Get(pid int) error {
+	if err := self.Io.Get(pid); err != nil {
+		return err
+	}
+
+	fds := ProcFDs{}
+	if err := fds.Get(pid); err != nil {
+		return err
+	}
+
+	devices := map[string]bool{}
+	for _, fd := range fds.List {
+		// the fd links resolve to the open file, even when it was deleted
+		var st syscall.Stat_t
+		if err := syscall.Stat(procFileName(pid, "fd/"+strconv.Itoa(fd.Fd)), &st); err != nil {
+			continue
+		}
+
+		dev := uint64(st.Dev)
+		if st.Mode&syscall.S_IFMT == syscall.S_IFBLK {
+			// the device itself is open
+			dev = uint64(st.Rdev)
+		}
+		// sockets, pipes and the files of pseudo file
+		// systems have no block device
+		if name, ok := blockDeviceName(dev); ok {
+			devices[name] = true
+		}
+	}
+
+	self.Devices = make([]string, 0, len(devices))
+	for name := range devices {
+		self.Devices = append(self.Devices, name)
+	}
+	sort.Strings(self.Devices)
+	return nil
+}
+
+// deviceName returns the path of the node of the block device major:minor,
+// like /dev/sda1 for 8:1, from /sys/dev/block. The error satisfies
+// os.IsNotExist when there is no such block device.
+func deviceName(major, minor int) (string, error) {
+	link := filepath.Join(Sysd, "dev/block", fmt.Sprintf("%d:%d", major, minor))
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+
+	// DEVNAME is the path of the node in /dev, which is not always the
+	// name of the device, e.g. cciss/c0d0 for cciss!c0d0
+	name := filepath.Base(target)
+	readFile(filepath.Join(link, "uevent"), func(line string) bool {
+		if strings.HasPrefix(line, "DEVNAME=") {
+			name = line[len("DEVNAME="):]
+			return false
+		}
+		return true
+	})
+	return "/dev/" + name, nil
+}
+
+// blockDeviceName returns the name of the block device dev from the
+// /sys/dev/block/<major>:<minor> link to its sysfs directory
+func blockDeviceName(dev uint64) (string, bool) {
+	link := filepath.Join(Sysd, "dev/block", fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev)))
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Base(target), true
+}
+
+func (self *ProcSched) Get(pid int) error {
+	stat, err := readProcStat(pid, 39)
+	if err != nil {
+		return err
+	}
+
+	interests := strings.Join([]string{
+		stat.fields[37], // rt_priority
+		stat.fields[38], // policy
+	}, " ")
+
+	_, err = fmt.Sscan(interests, &self.RtPriority, &self.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to parse stat fields for pid %d from '%v': %v", pid, interests, err)
+	}
+	return nil
+}
+
+func (self *ProcCaps) Get(pid int) error {
+	status, err := getProcStatus(pid)
+	if err != nil {
+		return err
+	}
+
+	sets := map[string]*CapSet{
+		"CapInh": &self.Inheritable,
+		"CapPrm": &self.Permitted,
+		"CapEff": &self.Effective,
+		"CapBnd": &self.Bounding,
+		"CapAmb": &self.Ambient,
+	}
+	for key, set := range sets {
+		*set = 0
+		val, ok := status[key]
+		if !ok {
+			continue
+		}
+		bits, err := strconv.ParseUint(val, 16, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s for pid %d: %v", key, pid, err)
+		}
+		*set = CapSet(bits)
+	}
+	return nil
+}
+
+func (self *ProcStatus) Get(pid int) error {
+	return self.get(Procd, pid)
+}
+
+func (self *ProcStatus) get(procd string, pid int) error {
+	status, err := getProcStatusIn(procd, pid)
+	if err != nil {
+		return err
+	}
+
+	sizes := map[string]*uint64{
+		"VmPeak": &self.VmPeak,
+		"VmSize": &self.VmSize,
+		"VmLck":  &self.VmLck,
+		"VmHWM":  &self.VmHWM,
+		"VmRSS":  &self.VmRSS,
+		"VmData": &self.VmData,
+		"VmStk":  &self.VmStk,
+		"VmExe":  &self.VmExe,
+		"VmLib":  &self.VmLib,
+		"VmPTE":  &self.VmPTE,
+		"VmSwap": &self.VmSwap,
+	}
+	for key, ptr := range sizes {
+		*ptr = parseStatusSize(status[key])
+	}
+
+	self.Threads, _ = strconv.Atoi(status["Threads"])
+	self.VoluntaryCtxtSwitches, _ = strtoull(status["voluntary_ctxt_switches"])
+	self.NonvoluntaryCtxtSwitches, _ = strtoull(status["nonvoluntary_ctxt_switches"])
+
+	masks := map[string]*uint64{
+		"SigPnd": &self.SigPnd,
+		"ShdPnd": &self.ShdPnd,
+		"SigBlk": &self.SigBlk,
+		"SigIgn": &self.SigIgn,
+		"SigCgt": &self.SigCgt,
+	}
+	for key, ptr := range masks {
+		*ptr, _ = strconv.ParseUint(status[key], 16, 64)
+	}
+
+	return nil
+}
+
+// Pid returns the pid of the process in its own namespace, the last value
+// of the NSpid line of its status
+func (p *NsProc) Pid() (int, error) {
+	status, err := getProcStatus(p.HostPid)
+	if err != nil {
+		return 0, err
+	}
+
+	nspids := strings.Fields(status["NSpid"])
+	if len(nspids) == 0 {
+		return 0, fmt.Errorf("no NSpid in the status of pid %d, Linux 4.1 or later is required", p.HostPid)
+	}
+	return strconv.Atoi(nspids[len(nspids)-1])
+}
+
+// procd is the proc mounted in the root of the process
+func (p *NsProc) procd() string {
+	return procFileName(p.HostPid, "root/proc")
+}
+
+func (p *NsProc) GetProcState() (ProcState, error) {
+	s := ProcState{}
+	pid, err := p.Pid()
+	if err != nil {
+		return s, err
+	}
+	err = s.get(p.procd(), pid)
+	return s, err
+}
+
+func (p *NsProc) GetProcMem() (ProcMem, error) {
+	m := ProcMem{}
+	pid, err := p.Pid()
+	if err != nil {
+		return m, err
+	}
+	err = m.get(p.procd(), pid)
+	return m, err
+}
+
+func (p *NsProc) GetProcTime() (ProcTime, error) {
+	t := ProcTime{}
+	pid, err := p.Pid()
+	if err != nil {
+		return t, err
+	}
+	err = t.get(p.procd(), pid)
+	return t, err
+}
+
+func (p *NsProc) GetProcArgs() ([]string, error) {
+	a := ProcArgs{}
+	pid, err := p.Pid()
+	if err != nil {
+		return nil, err
+	}
+	err = a.get(p.procd(), pid)
+	return a.List, err
+}
+
+func (p *NsProc) GetProcStatus() (ProcStatus, error) {
+	s := ProcStatus{}
+	pid, err := p.Pid()
+	if err != nil {
+		return s, err
+	}
+	err = s.get(p.procd(), pid)
+	return s, err
+}
+
+func parseCpuStat(self *Cpu, line []byte) error {
+	// columns of the cpu lines in the order of proc(5), older
+	// kernels do not have the steal, guest and guest_nice ones
+	columns := [...]*uint64{
+		&self.User, &self.Nice, &self.Sys, &self.Idle, &self.Wait,
+		&self.Irq, &self.SoftIrq, &self.Stolen, &self.Guest, &self.GuestNice,
+	}
+	_, line = nextField(line) // the cpu name
+	for _, column := range columns {
+		var field []byte
+		field, line = nextField(line)
+		*column, _ = parseUint(field)
+	}
+
+	return nil
+}
+
+// Buffers of Cpu.Sample, the first line of /proc/stat fits in one
+var statBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 4096)
+		return &buf
+	},
+}
+
+// Path of /proc/stat for the current Procd
+var statPath struct {
+	sync.Mutex
+	procd, path string
+}
+
+func getStatPath() string {
+	statPath.Lock()
+	defer statPath.Unlock()
+	if statPath.procd != Procd || statPath.path == "" {
+		statPath.procd = Procd
+		statPath.path = Procd + "/stat"
+	}
+	return statPath.path
+}
+
+// Sample is like Get, but only reads the start of /proc/stat into a pooled
+// buffer and parses it in place, so that sampling many times per second
+// allocates little.
+func (self *Cpu) Sample() error {
+	bufp := statBuffers.Get().(*[]byte)
+	defer statBuffers.Put(bufp)
+	buf := *bufp
+
+	f, err := os.Open(getStatPath())
+	if err != nil {
+		return err
+	}
+	n, err := io.ReadFull(f, buf)
+	f.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// the first line is the sum of the cpus
+	line := buf[:n]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if !bytes.HasPrefix(line, []byte("cpu ")) {
+		return self.Get()
+	}
+
+	columns := [...]*uint64{
+		&self.User, &self.Nice, &self.Sys, &self.Idle, &self.Wait,
+		&self.Irq, &self.SoftIrq, &self.Stolen, &self.Guest, &self.GuestNice,
+	}
+	line = line[len("cpu "):]
+	for _, column := range columns {
+		for len(line) > 0 && line[0] == ' ' {
+			line = line[1:]
+		}
+		var v uint64
+		for len(line) > 0 && line[0] >= '0' && line[0] <= '9' {
+			v = v*10 + uint64(line[0]-'0')
+			line = line[1:]
+		}
+		*column = v
+	}
 
 	return nil
 }
@@ -116,14 +1782,17 @@ func (self *Mem) Get() error {
 
 	self.Total, _ = table["MemTotal"]
 	self.Free, _ = table["MemFree"]
-	buffers, _ := table["Buffers"]
-	cached, _ := table["Cached"]
+	self.Buffers, _ = table["Buffers"]
+	self.Cached, _ = table["Cached"]
+	self.SReclaimable, _ = table["SReclaimable"]
 
 	if available, ok := table["MemAvailable"]; ok {
 		// MemAvailable is in /proc/meminfo (kernel 3.14+)
+		self.Available = available
 		self.ActualFree = available
 	} else {
-		self.ActualFree = self.Free + buffers + cached
+		self.Available = 0
+		self.ActualFree = self.Free + self.Buffers + self.Cached
 	}
 
 	self.Used = self.Total - self.Free
@@ -5,16 +5,16 @@
 package gosigar
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -23,6 +23,17 @@ var system struct {
 	btime uint64
 }
 
+// ClockTicks returns how many clock ticks there are in a second, the unit
+// of the times in the proc files, like sysconf(_SC_CLK_TCK). On Linux it
+// is read once from the AT_CLKTCK entry of the auxiliary vector without
+// cgo and falls back to 100, the value of most architectures.
+func ClockTicks() int64 {
+	return int64(system.ticks)
+}
+
+// Procd is the procfs mount point the readers use. It can be pointed at
+// another proc, such as /proc/<pid>/root/proc for a container, or at a
+// fixture directory in tests.
 var Procd string
 
 func getLinuxBootTime() {
@@ -36,66 +47,6 @@ func getLinuxBootTime() {
 	})
 }
 
-func (self *LoadAverage) Get() error {
-	line, err := ioutil.ReadFile(Procd + "/loadavg")
-	if err != nil {
-		return nil
-	}
-
-	fields := strings.Fields(string(line))
-
-	self.One, _ = strconv.ParseFloat(fields[0], 64)
-	self.Five, _ = strconv.ParseFloat(fields[1], 64)
-	self.Fifteen, _ = strconv.ParseFloat(fields[2], 64)
-
-	return nil
-}
-
-func (self *Swap) Get() error {
-
-	table, err := parseMeminfo()
-	if err != nil {
-		return err
-	}
-	self.Total, _ = table["SwapTotal"]
-	self.Free, _ = table["SwapFree"]
-
-	self.Used = self.Total - self.Free
-	return nil
-}
-
-func (self *Cpu) Get() error {
-	return readFile(Procd+"/stat", func(line string) bool {
-		if len(line) > 4 && line[0:4] == "cpu " {
-			parseCpuStat(self, line)
-			return false
-		}
-		return true
-
-	})
-}
-
-func (self *CpuList) Get() error {
-	capacity := len(self.List)
-	if capacity == 0 {
-		capacity = 4
-	}
-	list := make([]Cpu, 0, capacity)
-
-	err := readFile(Procd+"/stat", func(line string) bool {
-		if len(line) > 3 && line[0:3] == "cpu" && line[3] != ' ' {
-			cpu := Cpu{}
-			parseCpuStat(&cpu, line)
-			list = append(list, cpu)
-		}
-		return true
-	})
-
-	self.List = list
-
-	return err
-}
-
 func (self *FileSystemList) Get() error {
 	capacity := len(self.List)
 	if capacity == 0 {
@@ -122,6 +73,20 @@ func (self *FileSystemList) Get() error {
 	return err
 }
 
+// nodevFileSystems returns the file system types of /proc/filesystems
+// that do not need a block device
+func nodevFileSystems() ([]string, error) {
+	var types []string
+	err := readFile(Procd+"/filesystems", func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "nodev" {
+			types = append(types, fields[1])
+		}
+		return true
+	})
+	return types, err
+}
+
 func (self *ProcList) Get() error {
 	dir, err := os.Open(Procd)
 	if err != nil {
@@ -154,54 +119,91 @@ func (self *ProcList) Get() error {
 	return nil
 }
 
-func (self *ProcState) Get(pid int) error {
-	data, err := readProcFile(pid, "stat")
-	if err != nil {
-		return err
+// matchProc reports whether pid matches f, the stat file is read for the
+// state and the name, the status file only for the uid.
+func matchProc(pid int, f ProcFilter) (bool, error) {
+	if len(f.States) > 0 || f.Name != nil {
+		stat, err := readProcStat(pid, 1)
+		if err != nil {
+			return false, err
+		}
+		if !f.matchState(ParseRunState(stat.fields[0][0])) {
+			return false, nil
+		}
+		if f.Name != nil && !f.Name(stat.comm) {
+			return false, nil
+		}
 	}
 
-	// Extract the comm value with is surrounded by parentheses.
-	lIdx := bytes.Index(data, []byte("("))
-	rIdx := bytes.LastIndex(data, []byte(")"))
-	if lIdx < 0 || rIdx < 0 || lIdx >= rIdx || rIdx+2 >= len(data) {
-		return fmt.Errorf("failed to extract comm for pid %d from '%v'", pid, string(data))
+	if len(f.Uids) > 0 {
+		status, err := getProcStatus(pid)
+		if err != nil {
+			return false, err
+		}
+		uids, err := getUIDs(status)
+		if err != nil {
+			return false, err
+		}
+		uid, err := strconv.Atoi(uids[0])
+		if err != nil {
+			return false, fmt.Errorf("failed to parse uid for pid %d: %v", pid, err)
+		}
+		if !f.matchUid(uid) {
+			return false, nil
+		}
 	}
-	self.Name = string(data[lIdx+1 : rIdx])
+	return true, nil
+}
 
-	// Extract the rest of the fields that we are interested in.
-	fields := bytes.Fields(data[rIdx+2:])
-	if len(fields) <= 36 {
-		return fmt.Errorf("expected more stat fields for pid %d from '%v'", pid, string(data))
+func (self *ProcState) Get(pid int) error {
+	return self.get(Procd, pid)
+}
+
+// get reads the state of pid from the procfs mounted at procd
+func (self *ProcState) get(procd string, pid int) error {
+	stat, err := readProcStatIn(procd, pid, 37)
+	if err != nil {
+		return err
 	}
+	self.Name = stat.comm
 
-	interests := bytes.Join([][]byte{
+	// Extract the rest of the fields that we are interested in.
+	fields := stat.fields
+	interests := strings.Join([]string{
 		fields[0],  // state
 		fields[1],  // ppid
 		fields[2],  // pgrp
 		fields[4],  // tty_nr
 		fields[15], // priority
 		fields[16], // nice
+		fields[17], // num_threads
+		fields[19], // starttime
 		fields[36], // processor (last processor executed on)
-	}, []byte(" "))
+	}, " ")
 
 	var state string
-	_, err = fmt.Fscan(bytes.NewBuffer(interests),
+	_, err = fmt.Fscan(strings.NewReader(interests),
 		&state,
 		&self.Ppid,
 		&self.Pgid,
 		&self.Tty,
 		&self.Priority,
 		&self.Nice,
+		&self.NumThreads,
+		&self.StartTime,
 		&self.Processor,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to parse stat fields for pid %d from '%v': %v", pid, string(data), err)
+		return fmt.Errorf("failed to parse stat fields for pid %d from '%v': %v", pid, interests, err)
 	}
-	self.State = RunState(state[0])
+	self.State = ParseRunState(state[0])
 
 	// Read /proc/[pid]/status to get the uid, then lookup uid to get username.
-	status, err := getProcStatus(pid)
+	status, err := getProcStatusIn(procd, pid)
 	if err != nil {
+		if IsProcessNotFound(err) || IsNotPermitted(err) {
+			return err
+		}
 		return fmt.Errorf("failed to read process status for pid %d: %v", pid, err)
 	}
 	uids, err := getUIDs(status)
@@ -218,8 +220,73 @@ func (self *ProcState) Get(pid int) error {
 	return nil
 }
 
+func (self *ProcCred) Get(pid int) error {
+	status, err := getProcStatus(pid)
+	if err != nil {
+		return err
+	}
+
+	uids, err := getIDs(status, "Uid")
+	if err != nil {
+		return err
+	}
+	gids, err := getIDs(status, "Gid")
+	if err != nil {
+		return err
+	}
+
+	fields := []struct {
+		id    string
+		field *int
+	}{
+		{uids[0], &self.Uid}, {uids[1], &self.Euid}, {uids[2], &self.Suid},
+		{gids[0], &self.Gid}, {gids[1], &self.Egid}, {gids[2], &self.Sgid},
+	}
+	for _, f := range fields {
+		if *f.field, err = strconv.Atoi(f.id); err != nil {
+			return fmt.Errorf("failed to parse ids for pid %d: %v", pid, err)
+		}
+	}
+
+	groups := strings.Fields(status["Groups"])
+	self.Groups = make([]int, len(groups))
+	for i, group := range groups {
+		if self.Groups[i], err = strconv.Atoi(group); err != nil {
+			return fmt.Errorf("failed to parse groups for pid %d: %v", pid, err)
+		}
+	}
+
+	if !self.ResolveNames {
+		return nil
+	}
+
+	self.Username = uids[0]
+	if u, err := user.LookupId(uids[0]); err == nil {
+		self.Username = u.Username
+	}
+	self.Groupname = lookupGroupName(gids[0])
+	self.GroupNames = make([]string, len(groups))
+	for i, group := range groups {
+		self.GroupNames[i] = lookupGroupName(group)
+	}
+
+	return nil
+}
+
+// lookupGroupName returns the name of a group, or its id when it is unknown
+func lookupGroupName(gid string) string {
+	if g, err := user.LookupGroupId(gid); err == nil {
+		return g.Name
+	}
+	return gid
+}
+
 func (self *ProcMem) Get(pid int) error {
-	contents, err := readProcFile(pid, "statm")
+	return self.get(Procd, pid)
+}
+
+func (self *ProcMem) get(procd string, pid int) error {
+	contents, err := readProcFileIn(procd, pid, "statm")
 	if err != nil {
 		return err
 	}
@@ -235,37 +302,49 @@ func (self *ProcMem) Get(pid int) error {
 	share, _ := strtoull(fields[2])
 	self.Share = share << 12
 
-	contents, err = readProcFile(pid, "stat")
+	status, err := getProcStatusIn(procd, pid)
 	if err != nil {
 		return err
 	}
 
-	fields = strings.Fields(string(contents))
+	// VmSwap is missing before 2.6.34
+	self.Swap = parseStatusSize(status["VmSwap"])
+	self.Data = parseStatusSize(status["VmData"])
+	self.Stack = parseStatusSize(status["VmStk"])
+	self.Text = parseStatusSize(status["VmExe"])
 
-	self.MinorFaults, _ = strtoull(fields[10])
-	self.MajorFaults, _ = strtoull(fields[12])
+	stat, err := readProcStatIn(procd, pid, 10)
+	if err != nil {
+		return err
+	}
+
+	self.MinorFaults, _ = strtoull(stat.fields[7])
+	self.MajorFaults, _ = strtoull(stat.fields[9])
 	self.PageFaults = self.MinorFaults + self.MajorFaults
 
 	return nil
 }
 
 func (self *ProcTime) Get(pid int) error {
-	contents, err := readProcFile(pid, "stat")
+	return self.get(Procd, pid)
+}
+
+func (self *ProcTime) get(procd string, pid int) error {
+	stat, err := readProcStatIn(procd, pid, 20)
 	if err != nil {
 		return err
 	}
+	fields := stat.fields
 
-	fields := strings.Fields(string(contents))
-
-	user, _ := strtoull(fields[13])
-	sys, _ := strtoull(fields[14])
+	user, _ := strtoull(fields[11])
+	sys, _ := strtoull(fields[12])
 	// convert to millis
-	self.User = user * (1000 / system.ticks)
-	self.Sys = sys * (1000 / system.ticks)
+	self.User = user * 1000 / system.ticks
+	self.Sys = sys * 1000 / system.ticks
 	self.Total = self.User + self.Sys
 
 	// convert to millis
-	self.StartTime, _ = strtoull(fields[21])
+	self.StartTime, _ = strtoull(fields[19])
 	self.StartTime /= system.ticks
 	self.StartTime += system.btime
 	self.StartTime *= 1000
@@ -274,25 +353,33 @@ func (self *ProcTime) Get(pid int) error {
 }
 
 func (self *ProcArgs) Get(pid int) error {
-	contents, err := readProcFile(pid, "cmdline")
+	return self.get(Procd, pid)
+}
+
+func (self *ProcArgs) get(procd string, pid int) error {
+	contents, err := readProcFileIn(procd, pid, "cmdline")
 	if err != nil {
 		return err
 	}
 
-	bbuf := bytes.NewBuffer(contents)
-
-	var args []string
+	// kernel threads have an empty command line
+	self.List = []string{}
+	if len(contents) == 0 {
+		return nil
+	}
 
-	for {
-		arg, err := bbuf.ReadBytes(0)
-		if err == io.EOF {
-			break
+	if bytes.IndexByte(contents, 0) < 0 {
+		// processes rewriting their argv, like postgres, can leave
+		// a single string without NULs, e.g. "postgres: checkpointer"
+		if comm, err := readProcFileIn(procd, pid, "comm"); err == nil && len(comm) > 0 {
+			self.List = append(self.List, strings.TrimSuffix(string(comm), "\n"))
+			return nil
 		}
-		args = append(args, string(chop(arg)))
+		self.List = append(self.List, string(contents))
+		return nil
 	}
 
-	self.List = args
-
+	self.List = strings.Split(string(bytes.TrimSuffix(contents, []byte{0})), "\x00")
 	return nil
 }
 
@@ -308,6 +395,7 @@ func (self *ProcEnv) Get(pid int) error {
 
 	pairs := bytes.Split(contents, []byte{0})
 	for _, kv := range pairs {
+		// values can contain "=", like in LESSOPEN=|lesspipe %s
 		parts := bytes.SplitN(kv, []byte{'='}, 2)
 		if len(parts) != 2 {
 			continue
@@ -331,39 +419,48 @@ func (self *ProcExe) Get(pid int) error {
 		"root": &self.Root,
 	}
 
+	errs := map[string]error{}
 	for name, field := range fields {
 		val, err := os.Readlink(procFileName(pid, name))
 
 		if err != nil {
-			return err
+			errs[name] = err
+			continue
 		}
 
 		*field = val
 	}
 
-	return nil
+	switch len(errs) {
+	case 0:
+		return nil
+	case len(fields):
+		// nothing could be read, e.g. the process is gone
+		return procFileError(pid, procFileName(pid, "exe"), errs["exe"])
+	default:
+		return ErrPartial{Errors: errs}
+	}
 }
 
 func parseMeminfo() (map[string]uint64, error) {
-	table := map[string]uint64{}
-
-	err := readFile(Procd+"/meminfo", func(line string) bool {
-		fields := strings.Split(line, ":")
+	table := make(map[string]uint64, 64)
 
-		if len(fields) != 2 {
+	err := scanFile(Procd+"/meminfo", func(line []byte) bool {
+		key, value, ok := splitKeyValue(line, ':')
+		if !ok || bytes.IndexByte(value, ':') >= 0 {
 			return true // skip on errors
 		}
 
-		valueUnit := strings.Fields(fields[1])
-		value, err := strtoull(valueUnit[0])
-		if err != nil {
+		number, rest := nextField(value)
+		size, ok := parseUint(number)
+		if !ok {
 			return true // skip on errors
 		}
 
-		if len(valueUnit) > 1 && valueUnit[1] == "kB" {
-			value *= 1024
+		if unit, _ := nextField(rest); string(unit) == "kB" {
+			size *= 1024
 		}
-		table[fields[0]] = value
+		table[string(key)] = size
 
 		return true
 	})
@@ -371,36 +468,125 @@ func parseMeminfo() (map[string]uint64, error) {
 }
 
 func readFile(file string, handler func(string) bool) error {
-	contents, err := ioutil.ReadFile(file)
+	return scanFile(file, func(line []byte) bool {
+		return handler(string(line))
+	})
+}
+
+// Buffers of scanFile, larger ones are left to the garbage collector
+var fileBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+const maxPooledFileBuffer = 1 << 20
+
+// scanFile reads file into a pooled buffer and calls handler with each of
+// its lines, without the line ending, until it returns false. The lines
+// are only valid until handler returns.
+func scanFile(file string, handler func(line []byte) bool) error {
+	f, err := os.Open(file)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	reader := bufio.NewReader(bytes.NewBuffer(contents))
+	buf := fileBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledFileBuffer {
+			fileBuffers.Put(buf)
+		}
+	}()
+	buf.Reset()
+	if _, err := buf.ReadFrom(f); err != nil {
+		return err
+	}
 
-	for {
-		line, _, err := reader.ReadLine()
-		if err == io.EOF {
-			break
+	data := buf.Bytes()
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
 		}
-		if !handler(string(line)) {
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+		if !handler(line) {
 			break
 		}
 	}
-
 	return nil
 }
 
+// nextField splits the first field separated by blanks off line
+func nextField(line []byte) (field, rest []byte) {
+	i := 0
+	for i < len(line) && isBlank(line[i]) {
+		i++
+	}
+	j := i
+	for j < len(line) && !isBlank(line[j]) {
+		j++
+	}
+	return line[i:j], line[j:]
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// splitKeyValue splits a line like "MemTotal:   500184 kB" on the first
+// sep, the value is trimmed of spaces.
+func splitKeyValue(line []byte, sep byte) (key, value []byte, ok bool) {
+	i := bytes.IndexByte(line, sep)
+	if i < 0 {
+		return nil, nil, false
+	}
+	return line[:i], bytes.TrimSpace(line[i+1:]), true
+}
+
+// parseUint is like strtoull for a field, without converting it to a
+// string.
+func parseUint(field []byte) (uint64, bool) {
+	if len(field) == 0 {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range field {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (math.MaxUint64-d)/10 {
+			return 0, false
+		}
+		n = n*10 + d
+	}
+	return n, true
+}
+
 func strtoull(val string) (uint64, error) {
 	return strconv.ParseUint(val, 10, 64)
 }
 
 func procFileName(pid int, name string) string {
-	return Procd + "/" + strconv.Itoa(pid) + "/" + name
+	return procFileNameIn(Procd, pid, name)
+}
+
+func procFileNameIn(procd string, pid int, name string) string {
+	return procd + "/" + strconv.Itoa(pid) + "/" + name
+}
+
+func readProcFile(pid int, name string) ([]byte, error) {
+	return readProcFileIn(Procd, pid, name)
 }
 
-func readProcFile(pid int, name string) (content []byte, err error) {
-	path := procFileName(pid, name)
+// readProcFileIn reads a file of pid from the procfs mounted at procd
+func readProcFileIn(procd string, pid int, name string) (content []byte, err error) {
+	path := procFileNameIn(procd, pid, name)
 
 	// Panics have been reported when reading proc files, let's recover and
 	// report the path if this happens
@@ -414,44 +600,137 @@ func readProcFile(pid int, name string) (content []byte, err error) {
 	contents, err := ioutil.ReadFile(path)
 
 	if err != nil {
-		if perr, ok := err.(*os.PathError); ok {
-			if perr.Err == syscall.ENOENT {
-				return nil, syscall.ESRCH
-			}
+		return nil, procFileErrorIn(procd, pid, path, err)
+	}
+
+	return contents, nil
+}
+
+// procFileError maps the errors of reading the file path of pid to
+// ErrProcessNotFound when the process is gone and to ErrNotPermitted when
+// access to it is denied. A missing file of a process that still exists,
+// like io without task I/O accounting, is returned as is.
+func procFileError(pid int, path string, err error) error {
+	return procFileErrorIn(Procd, pid, path, err)
+}
+
+func procFileErrorIn(procd string, pid int, path string, err error) error {
+	perr, ok := err.(*os.PathError)
+	if !ok {
+		return err
+	}
+	switch perr.Err {
+	case syscall.ESRCH:
+		return ErrProcessNotFound
+	case syscall.ENOENT:
+		_, statErr := os.Stat(filepath.Join(procd, strconv.Itoa(pid)))
+		if os.IsNotExist(statErr) {
+			return ErrProcessNotFound
 		}
+	case syscall.EACCES, syscall.EPERM:
+		return ErrNotPermitted{Path: path}
+	}
+	return err
+}
+
+// procStat holds a stat file of a process or thread
+type procStat struct {
+	comm   string
+	fields []string // after the comm, fields[0] is the state
+}
+
+// readProcStat reads /proc/<pid>/stat, which must have at least n fields
+// after the comm.
+func readProcStat(pid int, n int) (procStat, error) {
+	return readProcStatIn(Procd, pid, n)
+}
+
+func readProcStatIn(procd string, pid int, n int) (procStat, error) {
+	data, err := readProcFileIn(procd, pid, "stat")
+	if err != nil {
+		return procStat{}, err
 	}
+	stat, err := parseProcStat(data, n)
+	if err != nil {
+		return procStat{}, fmt.Errorf("failed to parse stat for pid %d: %v", pid, err)
+	}
+	return stat, nil
+}
 
-	return contents, err
+// parseProcStat splits a stat file on the comm, which is surrounded by
+// parentheses and can itself contain spaces and parentheses, like
+// "(my ) proc)": it ends at the last ')'.
+func parseProcStat(data []byte, n int) (procStat, error) {
+	lIdx := bytes.IndexByte(data, '(')
+	rIdx := bytes.LastIndexByte(data, ')')
+	if lIdx < 0 || rIdx < 0 || lIdx >= rIdx {
+		return procStat{}, fmt.Errorf("no comm in '%s'", data)
+	}
+
+	fields := strings.Fields(string(data[rIdx+1:]))
+	if len(fields) < n {
+		return procStat{}, fmt.Errorf("expected more fields in '%s'", data)
+	}
+	return procStat{comm: string(data[lIdx+1 : rIdx]), fields: fields}, nil
 }
 
 // getProcStatus reads /proc/[pid]/status which contains process status
 // information in human readable form.
 func getProcStatus(pid int) (map[string]string, error) {
+	return getProcStatusIn(Procd, pid)
+}
+
+func getProcStatusIn(procd string, pid int) (map[string]string, error) {
 	status := make(map[string]string, 42)
-	path := filepath.Join(Procd, strconv.Itoa(pid), "status")
-	err := readFile(path, func(line string) bool {
-		fields := strings.SplitN(line, ":", 2)
-		if len(fields) == 2 {
-			status[fields[0]] = strings.TrimSpace(fields[1])
+	path := filepath.Join(procd, strconv.Itoa(pid), "status")
+	err := scanFile(path, func(line []byte) bool {
+		if key, value, ok := splitKeyValue(line, ':'); ok {
+			status[string(key)] = string(value)
 		}
 
 		return true
 	})
-	return status, err
+	if err != nil {
+		return nil, procFileErrorIn(procd, pid, path, err)
+	}
+	return status, nil
+}
+
+// parseStatusSize converts a "5004 kB" value of /proc/<pid>/status to
+// bytes, it returns 0 for missing or malformed values.
+func parseStatusSize(val string) uint64 {
+	fields := strings.Fields(val)
+	if len(fields) == 0 {
+		return 0
+	}
+	size, err := strtoull(fields[0])
+	if err != nil {
+		return 0
+	}
+	if len(fields) > 1 && strings.EqualFold(fields[1], "kB") {
+		size *= 1024
+	}
+	return size
 }
 
 // getUIDs reads the "Uid" value from status and splits it into four values --
 // real, effective, saved set, and  file system UIDs.
 func getUIDs(status map[string]string) ([]string, error) {
-	uidLine, ok := status["Uid"]
+	return getIDs(status, "Uid")
+}
+
+// getIDs reads the "Uid" or "Gid" value from status and splits it into its
+// real, effective, saved set and file system ids.
+func getIDs(status map[string]string, key string) ([]string, error) {
+	idLine, ok := status[key]
 	if !ok {
-		return nil, fmt.Errorf("Uid not found in proc status")
+		return nil, fmt.Errorf("%s not found in proc status", key)
 	}
 
-	uidStrs := strings.Fields(uidLine)
-	if len(uidStrs) != 4 {
-		return nil, fmt.Errorf("Uid line ('%s') did not contain four values", uidLine)
+	idStrs := strings.Fields(idLine)
+	if len(idStrs) != 4 {
+		return nil, fmt.Errorf("%s line ('%s') did not contain four values", key, idLine)
 	}
 
-	return uidStrs, nil
+	return idStrs, nil
 }
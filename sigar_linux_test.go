@@ -4,17 +4,23 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	sigar "github.com/elastic/gosigar"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 )
 
 var procd string
+var sysd string
 
 func setUp(t testing.TB) {
 	var err error
@@ -23,6 +29,12 @@ func setUp(t testing.TB) {
 		t.Fatal(err)
 	}
 	sigar.Procd = procd
+
+	sysd, err = ioutil.TempDir("", "sigarTestsSys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigar.Sysd = sysd
 }
 
 func tearDown(t testing.TB) {
@@ -31,6 +43,12 @@ func tearDown(t testing.TB) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	sigar.Sysd = "/sys"
+	err = os.RemoveAll(sysd)
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestLinuxProcState(t *testing.T) {
@@ -43,6 +61,9 @@ func TestLinuxProcState(t *testing.T) {
 		"(sd-pam)",
 		"]",
 		"(",
+		"a) (b",
+		") (",
+		"my ) proc",
 	}
 
 	for _, n := range procNames {
@@ -70,15 +91,17 @@ func TestLinuxProcState(t *testing.T) {
 			state := sigar.ProcState{}
 			if assert.NoError(t, state.Get(pid)) {
 				expected := sigar.ProcState{
-					Name:      n,
-					Username:  strconv.Itoa(uid),
-					State:     'S',
-					Ppid:      1,
-					Pgid:      2,
-					Tty:       4,
-					Priority:  15,
-					Nice:      16,
-					Processor: 36,
+					Name:       n,
+					Username:   strconv.Itoa(uid),
+					State:      'S',
+					Ppid:       1,
+					Pgid:       2,
+					Tty:        4,
+					Priority:   15,
+					Nice:       16,
+					Processor:  36,
+					NumThreads: 17,
+					StartTime:  19,
 				}
 				assert.Equal(t, expected, state)
 			}
@@ -86,244 +109,1815 @@ func TestLinuxProcState(t *testing.T) {
 	}
 }
 
-func TestLinuxCPU(t *testing.T) {
+func TestLinuxLoadAverage(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
 
 	tests := []struct {
-		stat string
-		user uint64
+		loadavg string
+		want    sigar.LoadAverage
 	}{
-		{"cpu 25 1 2 3 4 5 6 7", 25},
-		// Ignore empty lines
-		{"cpu ", 0},
+		{"0.20 0.18 0.12 1/80 11206\n", sigar.LoadAverage{One: 0.20, Five: 0.18, Fifteen: 0.12, Runnable: 1, Total: 80, LastPid: 11206}},
+		{"1.50 1.25 1.00 12/345\n", sigar.LoadAverage{One: 1.50, Five: 1.25, Fifteen: 1.00, Runnable: 12, Total: 345}},
+		{"1.50 1.25 1.00 bogus 42\n", sigar.LoadAverage{One: 1.50, Five: 1.25, Fifteen: 1.00, LastPid: 42}},
+		{"1.50 1.25 1.00\n", sigar.LoadAverage{One: 1.50, Five: 1.25, Fifteen: 1.00}},
 	}
-
-	statFile := procd + "/stat"
 	for _, test := range tests {
-		func() {
-			statContents := []byte(test.stat)
-			err := ioutil.WriteFile(statFile, statContents, 0644)
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer os.RemoveAll(statFile)
+		if err := ioutil.WriteFile(procd+"/loadavg", []byte(test.loadavg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		avg := sigar.LoadAverage{}
+		if assert.NoError(t, avg.Get(), "loadavg %q", test.loadavg) {
+			assert.Equal(t, test.want, avg, "loadavg %q", test.loadavg)
+		}
+	}
 
-			cpu := sigar.Cpu{}
-			if assert.NoError(t, cpu.Get()) {
-				assert.Equal(t, uint64(test.user), cpu.User, "cpu.User")
-			}
-		}()
+	if err := ioutil.WriteFile(procd+"/loadavg", []byte("0.20\n"), 0644); err != nil {
+		t.Fatal(err)
 	}
+	avg := sigar.LoadAverage{}
+	assert.Error(t, avg.Get())
+
+	if err := os.Remove(procd + "/loadavg"); err != nil {
+		t.Fatal(err)
+	}
+	err := avg.Get()
+	assert.True(t, os.IsNotExist(err), "err=%v", err)
 }
 
-func TestLinuxCollectCpuStats(t *testing.T) {
+func TestLinuxProcFileLines(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
 
-	statFile := procd + "/stat"
-	statContents := []byte("cpu 25 1 2 3 4 5 6 7")
-	err := ioutil.WriteFile(statFile, statContents, 0644)
-	if err != nil {
-		t.Fatal(err)
+	// CRLF endings, blank and malformed lines, an interrupt line longer
+	// than bufio's default buffer and no final newline
+	meminfo := "MemTotal:         500184 kB\r\n" +
+		"\n" +
+		"MemFree:bad kB\n" +
+		"Bad: 1: 2 kB\n" +
+		"MemFree:\t31360 kB\n" +
+		"HugePages_Total:       2\n" +
+		"SwapTotal:        1048572 kB\n" +
+		"SwapFree:         1048036 kB"
+	stat := "cpu  10 20 30 40 50 60 70 80 90 100\n" +
+		"cpu0 1 2 3 4 5 6 7 8 9 10\n" +
+		"cpu1 1 2 3 4\n" +
+		"intr 123 " + strings.Repeat("0 ", 5000) + "\n" +
+		"cpu2\t9 8 7 6 5 4 3 2 1 0"
+	files := map[string]string{
+		"meminfo": meminfo,
+		"stat":    stat,
+		"loadavg": "0.20 0.18 0.12 1/80 11206",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(procd, name), []byte(contents), 0444); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	concreteSigar := &sigar.ConcreteSigar{}
-	cpuUsages, stop := concreteSigar.CollectCpuStats(500 * time.Millisecond)
+	mem := sigar.Mem{}
+	if assert.NoError(t, mem.Get()) {
+		assert.Equal(t, uint64(500184*1024), mem.Total)
+		assert.Equal(t, uint64(31360*1024), mem.Free)
+	}
+	swap := sigar.Swap{}
+	if assert.NoError(t, swap.Get()) {
+		assert.Equal(t, uint64(1048572*1024), swap.Total)
+		assert.Equal(t, uint64((1048572-1048036)*1024), swap.Used)
+	}
 
-	assert.Equal(t, sigar.Cpu{
-		User:    uint64(25),
-		Nice:    uint64(1),
-		Sys:     uint64(2),
-		Idle:    uint64(3),
-		Wait:    uint64(4),
-		Irq:     uint64(5),
-		SoftIrq: uint64(6),
-		Stolen:  uint64(7),
-	}, <-cpuUsages)
+	cpu := sigar.Cpu{}
+	if assert.NoError(t, cpu.Get()) {
+		assert.Equal(t, sigar.Cpu{User: 10, Nice: 20, Sys: 30, Idle: 40, Wait: 50,
+			Irq: 60, SoftIrq: 70, Stolen: 80, Guest: 90, GuestNice: 100}, cpu)
+	}
+	cpus := sigar.CpuList{}
+	if assert.NoError(t, cpus.Get()) {
+		assert.Equal(t, []sigar.Cpu{
+			{User: 1, Nice: 2, Sys: 3, Idle: 4, Wait: 5, Irq: 6, SoftIrq: 7, Stolen: 8, Guest: 9, GuestNice: 10},
+			{User: 1, Nice: 2, Sys: 3, Idle: 4},
+			{User: 9, Nice: 8, Sys: 7, Idle: 6, Wait: 5, Irq: 4, SoftIrq: 3, Stolen: 2, Guest: 1},
+		}, cpus.List)
+	}
 
-	statContents = []byte("cpu 30 3 7 10 25 55 36 65")
-	err = ioutil.WriteFile(statFile, statContents, 0644)
-	if err != nil {
+	avg := sigar.LoadAverage{}
+	if assert.NoError(t, avg.Get()) {
+		assert.Equal(t, sigar.LoadAverage{One: 0.20, Five: 0.18, Fifteen: 0.12,
+			Runnable: 1, Total: 80, LastPid: 11206}, avg)
+	}
+	if err := ioutil.WriteFile(filepath.Join(procd, "loadavg"), nil, 0644); err != nil {
 		t.Fatal(err)
 	}
+	assert.Error(t, avg.Get())
 
-	assert.Equal(t, sigar.Cpu{
-		User:    uint64(5),
-		Nice:    uint64(2),
-		Sys:     uint64(5),
-		Idle:    uint64(7),
-		Wait:    uint64(21),
-		Irq:     uint64(50),
-		SoftIrq: uint64(30),
-		Stolen:  uint64(58),
-	}, <-cpuUsages)
-
-	stop <- struct{}{}
+	pid := rand.Int()
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	status := "Name:\tcat\nVmRSS:\t     476 kB\r\nThreads:\t3\nSigCgt:\t0000000000004a02"
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	procStatus := sigar.ProcStatus{}
+	if assert.NoError(t, procStatus.Get(pid)) {
+		assert.Equal(t, uint64(476*1024), procStatus.VmRSS)
+		assert.Equal(t, 3, procStatus.Threads)
+		assert.Equal(t, uint64(0x4a02), procStatus.SigCgt)
+	}
 }
 
-func TestLinuxMemAndSwap(t *testing.T) {
+func TestLinuxProcStatComm(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
 
-	meminfoContents := `
-MemTotal:         374256 kB
-MemFree:          274460 kB
-Buffers:            9764 kB
-Cached:            38648 kB
-SwapCached:            0 kB
-Active:            33772 kB
-Inactive:          31184 kB
-Active(anon):      16572 kB
-Inactive(anon):      552 kB
-Active(file):      17200 kB
-Inactive(file):    30632 kB
-Unevictable:           0 kB
-Mlocked:               0 kB
-SwapTotal:        786428 kB
-SwapFree:         786428 kB
-Dirty:                 0 kB
-Writeback:             0 kB
-AnonPages:         16564 kB
-Mapped:             6612 kB
-Shmem:               584 kB
-Slab:              19092 kB
-SReclaimable:       9128 kB
-SUnreclaim:         9964 kB
-KernelStack:         672 kB
-PageTables:         1864 kB
-NFS_Unstable:          0 kB
-Bounce:                0 kB
-WritebackTmp:          0 kB
-CommitLimit:      973556 kB
-Committed_AS:      55880 kB
-VmallocTotal:   34359738367 kB
-VmallocUsed:       21428 kB
-VmallocChunk:   34359713596 kB
-HardwareCorrupted:     0 kB
-AnonHugePages:         0 kB
-HugePages_Total:       0
-HugePages_Free:        0
-HugePages_Rsvd:        0
-HugePages_Surp:        0
-Hugepagesize:       2048 kB
-DirectMap4k:       59328 kB
-DirectMap2M:      333824 kB
-`
+	for _, n := range []string{"cron", "(sd-pam)", "my ) proc", "a (1 2 3) b"} {
+		pid := rand.Intn(32768)
+		pidDir := filepath.Join(procd, strconv.Itoa(pid))
+		if err := os.Mkdir(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePidStats(pid, n, filepath.Join(pidDir, "stat")); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "statm"), []byte("3 2 1 0 0 0 0\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePidStatus(n, pid, 0, filepath.Join(pidDir, "status")); err != nil {
+			t.Fatal(err)
+		}
 
-	meminfoFile := procd + "/meminfo"
-	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
-	if err != nil {
-		t.Fatal(err)
-	}
+		// the fields after the state are numbered from 1 by writePidStats
+		procTime := sigar.ProcTime{}
+		if assert.NoError(t, procTime.Get(pid), n) {
+			assert.Equal(t, uint64(110), procTime.User, n)
+			assert.Equal(t, uint64(120), procTime.Sys, n)
+		}
+		procMem := sigar.ProcMem{}
+		if assert.NoError(t, procMem.Get(pid), n) {
+			assert.Equal(t, uint64(7), procMem.MinorFaults, n)
+			assert.Equal(t, uint64(9), procMem.MajorFaults, n)
+			assert.Equal(t, uint64(2<<12), procMem.Resident, n)
+		}
 
-	mem := sigar.Mem{}
-	if assert.NoError(t, mem.Get()) {
-		assert.Equal(t, uint64(374256*1024), mem.Total)
-		assert.Equal(t, uint64(274460*1024), mem.Free)
-		assert.Equal(t, uint64(mem.Total-mem.Free), mem.Used)
-		assert.Equal(t, uint64((274460+9764+38648)*1024), mem.ActualFree)
-		assert.Equal(t, uint64(mem.Total-mem.ActualFree), mem.ActualUsed)
+		os.RemoveAll(pidDir)
 	}
 
-	swap := sigar.Swap{}
-	if assert.NoError(t, swap.Get()) {
-		assert.Equal(t, uint64(786428*1024), swap.Total)
-		assert.Equal(t, uint64(786428*1024), swap.Free)
+	// the comm is not terminated
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "stat"), []byte("42 (cron S 1 2 3"), 0644); err != nil {
+		t.Fatal(err)
 	}
+	procTime := sigar.ProcTime{}
+	assert.Error(t, procTime.Get(pid))
 }
 
-func TestLinuxMemAndSwapKernel_3_14(t *testing.T) {
+func TestLinuxProcMem(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
 
-	meminfoContents := `
-MemTotal:         500184 kB
-MemFree:           31360 kB
-MemAvailable:     414168 kB
-Buffers:           28740 kB
-Cached:           325408 kB
-SwapCached:          264 kB
-Active:           195476 kB
-Inactive:         198612 kB
-Active(anon):      14920 kB
-Inactive(anon):    27268 kB
-Active(file):     180556 kB
-Inactive(file):   171344 kB
-Unevictable:           0 kB
-Mlocked:               0 kB
-SwapTotal:        524284 kB
-SwapFree:         520352 kB
-Dirty:                 0 kB
-Writeback:             0 kB
-AnonPages:         39772 kB
-Mapped:            24132 kB
-Shmem:              2236 kB
-Slab:              57988 kB
-SReclaimable:      43524 kB
-SUnreclaim:        14464 kB
-KernelStack:        2464 kB
-PageTables:         3096 kB
-NFS_Unstable:          0 kB
-Bounce:                0 kB
-WritebackTmp:          0 kB
-CommitLimit:      774376 kB
-Committed_AS:     490916 kB
-VmallocTotal:   34359738367 kB
-VmallocUsed:           0 kB
-VmallocChunk:          0 kB
-HardwareCorrupted:     0 kB
-AnonHugePages:         0 kB
-CmaTotal:              0 kB
-CmaFree:               0 kB
-HugePages_Total:       0
-HugePages_Free:        0
-HugePages_Rsvd:        0
-HugePages_Surp:        0
-Hugepagesize:       2048 kB
-DirectMap4k:       63424 kB
-DirectMap2M:      460800 kB
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidStats(pid, "sshd", filepath.Join(pidDir, "stat")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "statm"), []byte("1251 119 96 17 0 61 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := `Name:	sshd
+VmSize:	    5004 kB
+VmRSS:	     476 kB
+VmData:	     156 kB
+VmStk:	      88 kB
+VmExe:	      68 kB
+VmLib:	    1412 kB
+VmSwap:	      12 kB
+Threads:	1
 `
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
 
-	meminfoFile := procd + "/meminfo"
-	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
-	if err != nil {
+	procMem := sigar.ProcMem{}
+	if assert.NoError(t, procMem.Get(pid)) {
+		assert.Equal(t, uint64(1251*4096), procMem.Size)
+		assert.Equal(t, uint64(119*4096), procMem.Resident)
+		assert.Equal(t, uint64(96*4096), procMem.Share)
+		assert.Equal(t, uint64(12*1024), procMem.Swap)
+		assert.Equal(t, uint64(156*1024), procMem.Data)
+		assert.Equal(t, uint64(88*1024), procMem.Stack)
+		assert.Equal(t, uint64(68*1024), procMem.Text)
+	}
+
+	// kernels before 2.6.34 have no VmSwap
+	status = strings.Replace(status, "VmSwap:	      12 kB\n", "", 1)
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(status), 0644); err != nil {
 		t.Fatal(err)
 	}
+	procMem = sigar.ProcMem{}
+	if assert.NoError(t, procMem.Get(pid)) {
+		assert.Equal(t, uint64(0), procMem.Swap)
+		assert.Equal(t, uint64(156*1024), procMem.Data)
+	}
+}
 
-	mem := sigar.Mem{}
-	if assert.NoError(t, mem.Get()) {
-		assert.Equal(t, uint64(500184*1024), mem.Total)
-		assert.Equal(t, uint64(31360*1024), mem.Free)
-		assert.Equal(t, uint64(414168*1024), mem.ActualFree)
-		assert.Equal(t, uint64(mem.Total-mem.Free), mem.Used)
-		assert.Equal(t, uint64(mem.Total-mem.ActualFree), mem.ActualUsed)
+func TestLinuxGetProcStateBatch(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	var pids []int
+	for pid := 100; pid < 150; pid++ {
+		pidDir := filepath.Join(procd, strconv.Itoa(pid))
+		if err := os.Mkdir(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		name := "proc" + strconv.Itoa(pid)
+		if err := writePidStats(pid, name, filepath.Join(pidDir, "stat")); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePidStatus(name, pid, 0, filepath.Join(pidDir, "status")); err != nil {
+			t.Fatal(err)
+		}
+		pids = append(pids, pid)
 	}
+	// exited before being read
+	pids = append(pids, 200, 201)
 
-	swap := sigar.Swap{}
-	if assert.NoError(t, swap.Get()) {
-		assert.Equal(t, uint64(524284*1024), swap.Total)
-		assert.Equal(t, uint64(520352*1024), swap.Free)
+	defer func(workers int) { sigar.ProcStateBatchWorkers = workers }(sigar.ProcStateBatchWorkers)
+	for _, workers := range []int{0, 1, 4, 100} {
+		sigar.ProcStateBatchWorkers = workers
+
+		states, errs := sigar.GetProcStateBatch(pids)
+		assert.Len(t, states, 50, "workers=%d", workers)
+		for pid := 100; pid < 150; pid++ {
+			assert.Equal(t, "proc"+strconv.Itoa(pid), states[pid].Name, "workers=%d", workers)
+		}
+		if assert.Len(t, errs, 2, "workers=%d", workers) {
+			for _, err := range errs {
+				assert.True(t, sigar.IsProcessNotFound(err), "workers=%d err=%v", workers, err)
+			}
+		}
 	}
+
+	states, errs := sigar.GetProcStateBatch(nil)
+	assert.Empty(t, states)
+	assert.Empty(t, errs)
 }
 
-func TestLinuxMemAndSwapMissingMemTotal(t *testing.T) {
+func TestLinuxProcInNamespace(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
 
-	meminfoContents := `
-MemFree:           31360 kB
-MemAvailable:     414168 kB
-Buffers:           28740 kB
-Cached:           325408 kB
-SwapCached:          264 kB
-Active:           195476 kB
-Inactive:         198612 kB
-Active(anon):      14920 kB
-Inactive(anon):    27268 kB
-Active(file):     180556 kB
-Inactive(file):   171344 kB
-Unevictable:           0 kB
+	// pid 1 of a container, 4200 in the caller's namespace
+	hostPid := 4200
+	hostDir := filepath.Join(procd, strconv.Itoa(hostPid))
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	hostStatus := "Name:\tnginx\nPid:\t4200\nNSpid:\t4200\t1\n"
+	if err := ioutil.WriteFile(filepath.Join(hostDir, "status"), []byte(hostStatus), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nsDir := filepath.Join(hostDir, "root", "proc", "1")
+	if err := os.MkdirAll(nsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidStats(1, "nginx", filepath.Join(nsDir, "stat")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidStatus("nginx", 1, 0, filepath.Join(nsDir, "status")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(nsDir, "statm"), []byte("3 2 1 0 0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(nsDir, "cmdline"), []byte("nginx\x00-g\x00daemon off;\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := sigar.ProcInNamespace(hostPid)
+	if pid, err := p.Pid(); assert.NoError(t, err) {
+		assert.Equal(t, 1, pid)
+	}
+	if state, err := p.GetProcState(); assert.NoError(t, err) {
+		assert.Equal(t, "nginx", state.Name)
+		assert.Equal(t, 1, state.Ppid)
+	}
+	if mem, err := p.GetProcMem(); assert.NoError(t, err) {
+		assert.Equal(t, uint64(2<<12), mem.Resident)
+	}
+	if procTime, err := p.GetProcTime(); assert.NoError(t, err) {
+		assert.Equal(t, uint64(110), procTime.User)
+	}
+	if args, err := p.GetProcArgs(); assert.NoError(t, err) {
+		assert.Equal(t, []string{"nginx", "-g", "daemon off;"}, args)
+	}
+	if status, err := p.GetProcStatus(); assert.NoError(t, err) {
+		assert.Equal(t, uint64(476*1024), status.VmRSS)
+	}
+
+	// kernels before 4.1 have no NSpid
+	if err := ioutil.WriteFile(filepath.Join(hostDir, "status"), []byte("Name:\tnginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.GetProcState()
+	assert.Error(t, err)
+
+	_, err = sigar.ProcInNamespace(hostPid + 1).GetProcState()
+	assert.True(t, sigar.IsProcessNotFound(err), "err=%v", err)
+}
+
+func TestLinuxProcTree(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	// pid to ppid, 300 was a child of 30 which exited
+	ppids := map[int]int{
+		1:   0,
+		10:  1,
+		11:  1,
+		20:  10,
+		21:  10,
+		22:  10,
+		300: 30,
+	}
+	for pid, ppid := range ppids {
+		pidDir := filepath.Join(procd, strconv.Itoa(pid))
+		if err := os.Mkdir(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if pid == 22 {
+			// not readable, unlike an exited process it is an error
+			if err := os.Mkdir(filepath.Join(pidDir, "stat"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		stat := fmt.Sprintf("%d (proc %d) S %d", pid, pid, ppid)
+		for i := 2; i < 40; i++ {
+			stat += " " + strconv.Itoa(i)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "stat"), []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePidStatus("proc", pid, 0, filepath.Join(pidDir, "status")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := sigar.ProcTree{}
+	err := tree.Get()
+	if assert.True(t, sigar.IsPartial(err), "err=%v", err) {
+		assert.Contains(t, err.(sigar.ErrPartial).Errors, "22")
+		assert.Len(t, err.(sigar.ErrPartial).Errors, 1)
+	}
+	assert.Equal(t, map[int][]int{
+		0:  {1},
+		1:  {10, 11},
+		10: {20, 21},
+		30: {300},
+	}, tree.Children)
+
+	assert.Equal(t, []int{10, 11, 20, 21}, tree.Descendants(1))
+	assert.Equal(t, []int{20, 21}, tree.Descendants(10))
+	assert.Empty(t, tree.Descendants(21))
+	// the orphan is still found below its last parent
+	assert.Equal(t, []int{300}, tree.Descendants(30))
+}
+
+func TestLinuxProcListFiltered(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	procs := []struct {
+		pid   int
+		name  string
+		state string
+		uid   int
+	}{
+		{1, "init", "S", 0},
+		{40, "make", "S", 1000},
+		{41, "cc1", "Z", 1000},
+		{42, "sshd", "R", 0},
+		{43, "sshd", "Z", 0},
+		{44, "my (sshd)", "Z", 1000},
+		{45, "", "", 0}, // exited while the list is filtered
+	}
+	for _, proc := range procs {
+		pidDir := filepath.Join(procd, strconv.Itoa(proc.pid))
+		if err := os.Mkdir(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if proc.state == "" {
+			continue
+		}
+		stat := fmt.Sprintf("%d (%s) %s", proc.pid, proc.name, proc.state)
+		for i := 1; i < 40; i++ {
+			stat += " " + strconv.Itoa(i)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "stat"), []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePidStatus(proc.name, proc.pid, proc.uid, filepath.Join(pidDir, "status")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter sigar.ProcFilter
+		pids   []int
+	}{
+		// nothing is read without criteria, like GetProcList
+		{sigar.ProcFilter{}, []int{1, 40, 41, 42, 43, 44, 45}},
+		{sigar.ProcFilter{States: []sigar.RunState{sigar.RunStateZombie}}, []int{41, 43, 44}},
+		{sigar.ProcFilter{States: []sigar.RunState{sigar.RunStateZombie}, Uids: []int{1000}}, []int{41, 44}},
+		{sigar.ProcFilter{Uids: []int{0}}, []int{1, 42, 43}},
+		{sigar.ProcFilter{
+			States: []sigar.RunState{sigar.RunStateRun, sigar.RunStateZombie},
+			Name:   func(name string) bool { return strings.Contains(name, "sshd") },
+		}, []int{42, 43, 44}},
+		{sigar.ProcFilter{Uids: []int{1001}}, []int{}},
+	}
+	s := &sigar.ConcreteSigar{}
+	for _, test := range tests {
+		pids, err := s.GetProcListFiltered(test.filter)
+		if assert.NoError(t, err) {
+			sort.Ints(pids)
+			assert.Equal(t, test.pids, pids)
+		}
+	}
+}
+
+func TestLinuxUptime(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	err := ioutil.WriteFile(filepath.Join(procd, "uptime"), []byte("350735.47 1402941.88\n"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uptime := sigar.Uptime{}
+	if assert.NoError(t, uptime.Get()) {
+		// the length is read from sysinfo
+		assert.True(t, uptime.Length > 0, "Length (%f) must be positive", uptime.Length)
+		assert.Equal(t, 1402941.88, uptime.Idle)
+		assert.InDelta(t, 350735.47, uptime.IdlePerCpu(4), 0.001)
+		assert.Equal(t, uptime.Idle, uptime.IdlePerCpu(0))
+	}
+
+	// no idle time without the file
+	os.Remove(filepath.Join(procd, "uptime"))
+	if assert.NoError(t, uptime.Get()) {
+		assert.Equal(t, 0.0, uptime.Idle)
+	}
+}
+
+func TestLinuxCPU(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	tests := []struct {
+		stat string
+		user uint64
+	}{
+		{"cpu 25 1 2 3 4 5 6 7", 25},
+		// Ignore empty lines
+		{"cpu ", 0},
+	}
+
+	statFile := procd + "/stat"
+	for _, test := range tests {
+		func() {
+			statContents := []byte(test.stat)
+			err := ioutil.WriteFile(statFile, statContents, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(statFile)
+
+			cpu := sigar.Cpu{}
+			if assert.NoError(t, cpu.Get()) {
+				assert.Equal(t, uint64(test.user), cpu.User, "cpu.User")
+			}
+		}()
+	}
+}
+
+func TestLinuxCPUAllColumns(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	stat := "cpu  1 2 3 4 5 6 7 8 9 10\ncpu0 1 2 3 4 5 6 7 8 9 10\n"
+	if err := ioutil.WriteFile(procd+"/stat", []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sigar.Cpu{
+		User:      1,
+		Nice:      2,
+		Sys:       3,
+		Idle:      4,
+		Wait:      5,
+		Irq:       6,
+		SoftIrq:   7,
+		Stolen:    8,
+		Guest:     9,
+		GuestNice: 10,
+	}
+
+	cpu := sigar.Cpu{}
+	if assert.NoError(t, cpu.Get()) {
+		assert.Equal(t, expected, cpu)
+		// guest time is part of user and nice time
+		assert.Equal(t, uint64(36), cpu.Total())
+	}
+
+	cpuList := sigar.CpuList{}
+	if assert.NoError(t, cpuList.Get()) {
+		assert.Equal(t, []sigar.Cpu{expected}, cpuList.List)
+	}
+}
+
+func TestLinuxCpuSample(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	stats := []string{
+		"cpu  1 2 3 4 5 6 7 8 9 10\ncpu0 1 2 3 4 5 6 7 8 9 10\n",
+		// older kernels without steal and guest
+		"cpu  25 1 2 3 4 5 6\ncpu0 25 1 2 3 4 5 6\n",
+		"cpu 18446744073709551615 0 0 0\n",
+		"cpu ",
+		// not a sum of the cpus, read by Get
+		"intr 1 2 3\ncpu  1 2 3 4\n",
+	}
+	for _, stat := range stats {
+		if err := ioutil.WriteFile(procd+"/stat", []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := sigar.Cpu{}
+		if !assert.NoError(t, expected.Get()) {
+			continue
+		}
+		// the values of the previous sample are overwritten
+		cpu := sigar.Cpu{User: 100, Stolen: 100, GuestNice: 100}
+		if assert.NoError(t, cpu.Sample(), "stat %q", stat) {
+			assert.Equal(t, expected, cpu, "stat %q", stat)
+		}
+	}
+}
+
+func BenchmarkCpuGet(b *testing.B) {
+	cpu := sigar.Cpu{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := cpu.Get(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCpuSample(b *testing.B) {
+	cpu := sigar.Cpu{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := cpu.Sample(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemGet(b *testing.B) {
+	mem := sigar.Mem{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := mem.Get(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadAverageGet(b *testing.B) {
+	avg := sigar.LoadAverage{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := avg.Get(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProcStatusGet(b *testing.B) {
+	status := sigar.ProcStatus{}
+	pid := os.Getpid()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := status.Get(pid); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLinuxDiskIoList(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	diskstats := `   8       0 sda 4000 10 16000 300 2000 20 8000 700 0 900 1000
+   8       1 sda1 3000 5 12000 200 1000 10 4000 500 0 600 700
+ 253       0 dm-0 100 0 800 10 50 0 400 20 1 25 30 0 0 0 0
+`
+	if err := ioutil.WriteFile(procd+"/diskstats", []byte(diskstats), 0444); err != nil {
+		t.Fatal(err)
+	}
+	for _, disk := range []string{"sda", "dm-0"} {
+		if err := os.MkdirAll(filepath.Join(sysd, "block", disk), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sda := sigar.DiskIo{
+		ReadOps:    4000,
+		WriteOps:   2000,
+		ReadBytes:  16000 * 512,
+		WriteBytes: 8000 * 512,
+		IoTime:     900,
+		ReadTime:   300,
+		WriteTime:  700,
+	}
+
+	disks := sigar.DiskIoList{}
+	if assert.NoError(t, disks.Get()) {
+		assert.Len(t, disks.List, 2)
+		assert.Equal(t, sda, disks.List["sda"])
+		assert.Equal(t, uint64(400*512), disks.List["dm-0"].WriteBytes)
+	}
+
+	disks = sigar.DiskIoList{IncludePartitions: true}
+	if assert.NoError(t, disks.Get()) {
+		assert.Len(t, disks.List, 3)
+		assert.Equal(t, uint64(3000), disks.List["sda1"].ReadOps)
+	}
+}
+
+func TestLinuxNetProtoStats(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	snmp := `Ip: Forwarding DefaultTTL InReceives InHdrErrors InAddrErrors ForwDatagrams InUnknownProtos InDiscards InDelivers OutRequests OutDiscards OutNoRoutes ReasmTimeout ReasmReqds ReasmOKs ReasmFails FragOKs FragFails FragCreates
+Ip: 1 64 2195837 0 3 0 0 0 2195799 1901136 12 5 0 0 0 0 0 0 0
+Icmp: InMsgs InErrors InCsumErrors OutMsgs
+Icmp: 45 0 0 45
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors
+Tcp: 1 200 120000 -1 31652 1962 2210 1520 18 2120075 2227626 3470 7 4956 0
+Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti
+Udp: 72330 40 2 73645 1 0 0 1210
+`
+	netstat := `TcpExt: SyncookiesSent SyncookiesRecv ListenOverflows ListenDrops TCPTimeouts
+TcpExt: 0 0 17 19 1024
+IpExt: InNoRoutes InTruncatedPkts
+IpExt: 0 0
+`
+	if err := os.MkdirAll(filepath.Join(procd, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(procd, "net/snmp"), []byte(snmp), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(procd, "net/netstat"), []byte(netstat), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sigar.NetProtoStats{
+		IP: sigar.NetIPStats{
+			InReceives:   2195837,
+			InAddrErrors: 3,
+			InDelivers:   2195799,
+			OutRequests:  1901136,
+			OutDiscards:  12,
+			OutNoRoutes:  5,
+		},
+		TCP: sigar.NetTCPStats{
+			ActiveOpens:     31652,
+			PassiveOpens:    1962,
+			AttemptFails:    2210,
+			EstabResets:     1520,
+			CurrEstab:       18,
+			InSegs:          2120075,
+			OutSegs:         2227626,
+			RetransSegs:     3470,
+			InErrs:          7,
+			OutRsts:         4956,
+			ListenOverflows: 17,
+			ListenDrops:     19,
+			Timeouts:        1024,
+		},
+		UDP: sigar.NetUDPStats{
+			InDatagrams:  72330,
+			NoPorts:      40,
+			InErrors:     2,
+			OutDatagrams: 73645,
+			RcvbufErrors: 1,
+		},
+	}
+
+	stats := sigar.NetProtoStats{}
+	if assert.NoError(t, stats.Get()) {
+		assert.Equal(t, expected, stats)
+	}
+
+	// the TcpExt counters are left zero without /proc/net/netstat
+	os.Remove(filepath.Join(procd, "net/netstat"))
+	expected.TCP.ListenOverflows, expected.TCP.ListenDrops, expected.TCP.Timeouts = 0, 0, 0
+	stats = sigar.NetProtoStats{}
+	if assert.NoError(t, stats.Get()) {
+		assert.Equal(t, expected, stats)
+	}
+}
+
+func TestLinuxNetIfaceStats(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	netdev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 35339686    3087    0    0    0     0          0         0 35339686    3087    0    0    0     0       0          0
+  eth0:1096882532 1057445    1    2    0     0          0       120 91117514  742383    3    4    0     0       0          0
+eth0:1: 100 2 0 0 0 0 0 0 200 3 0 0 0 0 0 0
+`
+	if err := os.MkdirAll(filepath.Join(procd, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(procd, "net/dev"), []byte(netdev), 0444); err != nil {
+		t.Fatal(err)
+	}
+	for name, flags := range map[string]string{"lo": "0x9\n", "eth0": "0x1003\n"} {
+		dir := filepath.Join(sysd, "class/net", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "flags"), []byte(flags), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ifaces := sigar.NetIfaceStatList{}
+	if assert.NoError(t, ifaces.Get()) && assert.Len(t, ifaces.List, 3) {
+		assert.Equal(t, sigar.NetIfaceStat{
+			Name:      "lo",
+			Loopback:  true,
+			RxBytes:   35339686,
+			TxBytes:   35339686,
+			RxPackets: 3087,
+			TxPackets: 3087,
+		}, ifaces.List[0])
+		assert.Equal(t, sigar.NetIfaceStat{
+			Name:      "eth0",
+			RxBytes:   1096882532,
+			TxBytes:   91117514,
+			RxPackets: 1057445,
+			TxPackets: 742383,
+			RxErrors:  1,
+			TxErrors:  3,
+			RxDropped: 2,
+			TxDropped: 4,
+		}, ifaces.List[1])
+		assert.Equal(t, "eth0:1", ifaces.List[2].Name)
+		assert.Equal(t, uint64(200), ifaces.List[2].TxBytes)
+	}
+}
+
+func TestLinuxNetConnections(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	tables := map[string]string{
+		"tcp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23456 1 0000000000000000 100 0 0 10 0
+   1: 0F02000A:C350 2C1A3AD8:01BB 01 00000000:00000000 02:000A7F1E 00000000  1000        0 34567 2 0000000000000000 20 4 30 10 -1
+`,
+		"tcp6": `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 45678 1 0000000000000000 100 0 0 10 0
+`,
+		"udp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000:0044 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 56789 2 0000000000000000 0
+`,
+	}
+	if err := os.MkdirAll(filepath.Join(procd, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, table := range tables {
+		if err := ioutil.WriteFile(filepath.Join(procd, "net", name), []byte(table), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pid 42 owns the established connection
+	fdDir := filepath.Join(procd, "42", "fd")
+	if err := os.MkdirAll(fdDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Symlink("/dev/null", filepath.Join(fdDir, "0"))
+	os.Symlink("socket:[34567]", filepath.Join(fdDir, "3"))
+
+	conns := sigar.NetConnectionList{}
+	if assert.NoError(t, conns.Get(sigar.NetConnTCP|sigar.NetConnIPv4)) && assert.Len(t, conns.List, 2) {
+		assert.Equal(t, sigar.NetConnection{
+			Protocol:   "tcp",
+			LocalAddr:  net.IPv4(127, 0, 0, 1).To4(),
+			LocalPort:  3306,
+			RemoteAddr: net.IPv4(0, 0, 0, 0).To4(),
+			State:      "LISTEN",
+			Inode:      23456,
+		}, conns.List[0])
+		assert.Equal(t, "10.0.2.15", conns.List[1].LocalAddr.String())
+		assert.Equal(t, uint16(50000), conns.List[1].LocalPort)
+		assert.Equal(t, "216.58.26.44", conns.List[1].RemoteAddr.String())
+		assert.Equal(t, uint16(443), conns.List[1].RemotePort)
+		assert.Equal(t, "ESTAB", conns.List[1].State)
+		assert.Equal(t, 0, conns.List[1].Pid)
+	}
+
+	procConns := sigar.ProcNetConnections{}
+	if assert.NoError(t, procConns.Get(42)) && assert.Len(t, procConns.List, 1) {
+		assert.Equal(t, uint64(34567), procConns.List[0].Inode)
+		assert.Equal(t, 42, procConns.List[0].Pid)
+	}
+
+	// a process without sockets
+	os.Remove(filepath.Join(fdDir, "3"))
+	if assert.NoError(t, procConns.Get(42)) {
+		assert.NotNil(t, procConns.List)
+		assert.Empty(t, procConns.List)
+	}
+	os.Symlink("socket:[34567]", filepath.Join(fdDir, "3"))
+
+	err := procConns.Get(43)
+	assert.True(t, os.IsNotExist(err), "unknown pid, got %v", err)
+
+	// all protocols, udp6 is missing like with IPv6 disabled
+	if assert.NoError(t, conns.Get(sigar.NetConnPid)) && assert.Len(t, conns.List, 4) {
+		assert.Equal(t, 42, conns.List[1].Pid)
+		assert.Equal(t, "tcp6", conns.List[2].Protocol)
+		assert.Equal(t, "::1", conns.List[2].LocalAddr.String())
+		assert.Equal(t, uint16(22), conns.List[2].LocalPort)
+		assert.Equal(t, "udp", conns.List[3].Protocol)
+		assert.Equal(t, uint16(68), conns.List[3].LocalPort)
+		assert.Equal(t, "UNCONN", conns.List[3].State)
+	}
+}
+
+func TestLinuxNetConnectionsIPv6(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	tables := map[string]string{
+		"tcp6": `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 000080FE00000000FF27000A2C1B8EFE:0016 000080FE00000000FF27000A2D1B8EFE:D431 01 00000000:00000000 02:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0000000000000000FFFF00000F02000A:C350 0000000000000000FFFF00002C1A3AD8:01BB 01 00000000:00000000 02:00000000 00000000  1000        0 1003 1 0000000000000000 20 4 30 10 -1
+`,
+		"udp6": `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: B80D0120000000000000000001000000:0222 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 1004 2 0000000000000000 0
+`,
+	}
+	if err := os.MkdirAll(filepath.Join(procd, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, table := range tables {
+		if err := ioutil.WriteFile(filepath.Join(procd, "net", name), []byte(table), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns := sigar.NetConnectionList{}
+	if !assert.NoError(t, conns.Get(sigar.NetConnTCP|sigar.NetConnUDP|sigar.NetConnIPv6)) || !assert.Len(t, conns.List, 4) {
+		return
+	}
+
+	// loopback
+	assert.Equal(t, net.IPv6loopback, conns.List[0].LocalAddr)
+	assert.Equal(t, uint16(8080), conns.List[0].LocalPort)
+	assert.Equal(t, net.IPv6unspecified, conns.List[0].RemoteAddr)
+	assert.Equal(t, "LISTEN", conns.List[0].State)
+
+	// link-local
+	assert.Equal(t, net.ParseIP("fe80::a00:27ff:fe8e:1b2c"), conns.List[1].LocalAddr)
+	assert.True(t, conns.List[1].LocalAddr.IsLinkLocalUnicast())
+	assert.Equal(t, uint16(22), conns.List[1].LocalPort)
+	assert.Equal(t, "fe80::a00:27ff:fe8e:1b2d", conns.List[1].RemoteAddr.String())
+	assert.Equal(t, uint16(54321), conns.List[1].RemotePort)
+	assert.Equal(t, "ESTAB", conns.List[1].State)
+
+	// IPv4-mapped
+	assert.Equal(t, "10.0.2.15", conns.List[2].LocalAddr.String())
+	assert.Equal(t, "216.58.26.44", conns.List[2].RemoteAddr.String())
+	assert.Equal(t, uint16(443), conns.List[2].RemotePort)
+
+	assert.Equal(t, "udp6", conns.List[3].Protocol)
+	assert.Equal(t, "2001:db8::1", conns.List[3].LocalAddr.String())
+	assert.Equal(t, uint16(546), conns.List[3].LocalPort)
+	assert.Equal(t, uint64(1004), conns.List[3].Inode)
+}
+
+func TestLinuxCpuFreq(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	dir := filepath.Join(sysd, "devices/system/cpu/cpu1/cpufreq")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"scaling_cur_freq": "1797652\n",
+		"cpuinfo_min_freq": "800000\n",
+		"cpuinfo_max_freq": "3400000\n",
+	}
+	for name, value := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freq := sigar.CpuFreq{}
+	if assert.NoError(t, freq.Get(1)) {
+		assert.Equal(t, sigar.CpuFreq{Current: 1797, Min: 800, Max: 3400}, freq)
+	}
+}
+
+func TestLinuxCpuFreqCpuinfo(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	cpuinfo := `processor	: 0
+vendor_id	: GenuineIntel
+cpu MHz		: 2394.454
+
+processor	: 1
+vendor_id	: GenuineIntel
+cpu MHz		: 2400.998
+`
+	if err := ioutil.WriteFile(filepath.Join(procd, "cpuinfo"), []byte(cpuinfo), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	freq := sigar.CpuFreq{}
+	if assert.NoError(t, freq.Get(1)) {
+		assert.Equal(t, sigar.CpuFreq{Current: 2401}, freq)
+	}
+
+	assert.Error(t, freq.Get(2))
+}
+
+func TestLinuxCpuTopology(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	// 2 packages of 2 cores with 2 threads, on one NUMA node each
+	dir := filepath.Join(sysd, "devices/system/cpu")
+	for cpu := 0; cpu < 8; cpu++ {
+		cpuDir := filepath.Join(dir, fmt.Sprintf("cpu%d", cpu))
+		if err := os.MkdirAll(filepath.Join(cpuDir, "topology"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]int{
+			"topology/physical_package_id": cpu / 4,
+			"topology/core_id":             cpu % 2,
+		}
+		for name, value := range files {
+			if err := ioutil.WriteFile(filepath.Join(cpuDir, name), []byte(fmt.Sprintf("%d\n", value)), 0444); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Mkdir(filepath.Join(cpuDir, fmt.Sprintf("node%d", cpu/4)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an offline CPU and the other entries of the directory
+	for _, name := range []string{"cpu8", "cpufreq", "cpuidle"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	topology := sigar.CpuTopology{}
+	if assert.NoError(t, topology.Get()) {
+		if assert.Len(t, topology.Cpus, 8) {
+			assert.Equal(t, sigar.LogicalCpu{Cpu: 5, Package: 1, Core: 1, Node: 1}, topology.Cpus[5])
+		}
+		assert.Equal(t, 2, topology.Packages())
+		assert.Equal(t, 4, topology.PhysicalCores())
+		assert.Equal(t, 2, topology.ThreadsPerCore())
+	}
+}
+
+func TestLinuxNumaNodes(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	nodes := map[int]string{
+		0: "0-3,8-11\n",
+		1: "4-7,12,13\n",
+	}
+	for n, cpulist := range nodes {
+		dir := filepath.Join(sysd, "devices/system/node", fmt.Sprintf("node%d", n))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		meminfo := fmt.Sprintf(`Node %d MemTotal:       16305372 kB
+Node %d MemFree:         9052952 kB
+Node %d MemUsed:         7252420 kB
+Node %d Active:          3562236 kB
+`, n, n, n, n)
+		if err := ioutil.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0444); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpulist), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := sigar.NumaNodeList{}
+	if assert.NoError(t, list.Get()) {
+		assert.Equal(t, []sigar.NumaNode{
+			{Node: 0, TotalBytes: 16305372 * 1024, FreeBytes: 9052952 * 1024, Cpus: []int{0, 1, 2, 3, 8, 9, 10, 11}},
+			{Node: 1, TotalBytes: 16305372 * 1024, FreeBytes: 9052952 * 1024, Cpus: []int{4, 5, 6, 7, 12, 13}},
+		}, list.List)
+	}
+}
+
+func TestLinuxNumaNodesWithoutNuma(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfo := `MemTotal:        8054032 kB
+MemFree:         1227528 kB
+`
+	if err := ioutil.WriteFile(filepath.Join(procd, "meminfo"), []byte(meminfo), 0444); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(sysd, "devices/system/cpu")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "online"), []byte("0-3\n"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	list := sigar.NumaNodeList{}
+	if assert.NoError(t, list.Get()) {
+		assert.Equal(t, []sigar.NumaNode{
+			{Node: 0, TotalBytes: 8054032 * 1024, FreeBytes: 1227528 * 1024, Cpus: []int{0, 1, 2, 3}},
+		}, list.List)
+	}
+}
+
+func TestLinuxNumCpu(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	dir := filepath.Join(sysd, "devices/system/cpu")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		online, possible string
+		nOnline, nAll    int
+		ok               bool
+	}{
+		{"0\n", "0\n", 1, 1, true},
+		{"0-3\n", "0-7\n", 4, 8, true},
+		{"0-3,6,8-9\n", "0-15\n", 7, 16, true},
+		{"0,2,4\n", "0-4\n", 3, 5, true},
+		{"\n", "0-1\n", 0, 2, true},
+		{"0-a\n", "0-1\n", 0, 0, false},
+		{"3-1\n", "0-3\n", 0, 0, false},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(filepath.Join(dir, "online"), []byte(test.online), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "possible"), []byte(test.possible), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		online, possible, err := sigar.NumCpu()
+		if !test.ok {
+			assert.Error(t, err, test.online)
+			continue
+		}
+		if assert.NoError(t, err, test.online) {
+			assert.Equal(t, test.nOnline, online, test.online)
+			assert.Equal(t, test.nAll, possible, test.possible)
+		}
+	}
+
+	os.Remove(filepath.Join(dir, "possible"))
+	_, _, err := sigar.NumCpu()
+	assert.Error(t, err)
+}
+
+func TestLinuxHwmonSensors(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	chips := map[string]map[string]string{
+		"hwmon0": {
+			"name":        "acpitz\n",
+			"temp1_input": "27800\n",
+			"temp1_crit":  "119000\n",
+		},
+		"hwmon1": {
+			"name":         "coretemp\n",
+			"temp1_input":  "45000\n",
+			"temp1_label":  "Package id 0\n",
+			"temp1_max":    "84000\n",
+			"temp1_crit":   "100000\n",
+			"temp2_input":  "-1500\n",
+			"temp2_label":  "Core 0\n",
+			"temp10_input": "43000\n",
+			"temp10_label": "Core 8\n",
+			// a sensor without input
+			"temp3_label": "Core 1\n",
+		},
+		"hwmon2": {
+			"name":       "nct6775\n",
+			"fan1_input": "1450\n",
+			"fan1_label": "CPU fan\n",
+			"fan2_input": "0\n",
+		},
+	}
+	for chip, files := range chips {
+		dir := filepath.Join(sysd, "class/hwmon", chip)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0444); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	list := sigar.TemperatureList{}
+	if assert.NoError(t, list.Get()) {
+		assert.Equal(t, []sigar.Temperature{
+			{SensorName: "acpitz", Label: "temp1", Celsius: 27.8, CriticalThreshold: 119},
+			{SensorName: "coretemp", Label: "Package id 0", Celsius: 45, HighThreshold: 84, CriticalThreshold: 100},
+			{SensorName: "coretemp", Label: "Core 0", Celsius: -1.5},
+			{SensorName: "coretemp", Label: "Core 8", Celsius: 43},
+		}, list.List)
+	}
+
+	fans := sigar.FanList{}
+	if assert.NoError(t, fans.Get()) {
+		assert.Equal(t, []sigar.Fan{
+			{Name: "nct6775", Label: "CPU fan", RPM: 1450},
+			{Name: "nct6775", Label: "fan2", RPM: 0},
+		}, fans.List)
+	}
+
+	// no hwmon chip is not an error
+	os.RemoveAll(filepath.Join(sysd, "class/hwmon"))
+	if assert.NoError(t, fans.Get()) {
+		assert.NotNil(t, fans.List)
+		assert.Empty(t, fans.List)
+	}
+	if assert.NoError(t, list.Get()) {
+		assert.NotNil(t, list.List)
+		assert.Empty(t, list.List)
+	}
+}
+
+func TestLinuxBatteries(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	supplies := map[string]map[string]string{
+		// charge in µAh, discharging for 2h30
+		"BAT0": {
+			"status":      "Discharging\n",
+			"capacity":    "50\n",
+			"charge_now":  "2500000\n",
+			"charge_full": "5000000\n",
+			"current_now": "1000000\n",
+			"cycle_count": "312\n",
+		},
+		// energy in µWh, 1h to full and no capacity
+		"BAT1": {
+			"status":      "Charging\n",
+			"energy_now":  "30000000\n",
+			"energy_full": "40000000\n",
+			"power_now":   "10000000\n",
+		},
+		"AC": {
+			"online": "1\n",
+		},
+	}
+	for supply, files := range supplies {
+		dir := filepath.Join(sysd, "class/power_supply", supply)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0444); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	list := sigar.BatteryList{}
+	if assert.NoError(t, list.Get()) {
+		assert.Equal(t, []sigar.Battery{
+			{Name: "BAT0", Percent: 50, State: sigar.BatteryDischarging, TimeRemaining: 150 * time.Minute, Cycles: 312},
+			{Name: "BAT1", Percent: 75, State: sigar.BatteryCharging, TimeRemaining: time.Hour},
+		}, list.List)
+	}
+
+	// no battery is not an error
+	os.RemoveAll(filepath.Join(sysd, "class/power_supply"))
+	if assert.NoError(t, list.Get()) {
+		assert.Empty(t, list.List)
+		assert.NotNil(t, list.List)
+	}
+}
+
+func TestLinuxCollectCpuStats(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	statFile := procd + "/stat"
+	statContents := []byte("cpu 25 1 2 3 4 5 6 7")
+	err := ioutil.WriteFile(statFile, statContents, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	concreteSigar := &sigar.ConcreteSigar{}
+	cpuUsages, stop := concreteSigar.CollectCpuStats(500 * time.Millisecond)
+
+	assert.Equal(t, sigar.Cpu{
+		User:    uint64(25),
+		Nice:    uint64(1),
+		Sys:     uint64(2),
+		Idle:    uint64(3),
+		Wait:    uint64(4),
+		Irq:     uint64(5),
+		SoftIrq: uint64(6),
+		Stolen:  uint64(7),
+	}, <-cpuUsages)
+
+	statContents = []byte("cpu 30 3 7 10 25 55 36 65")
+	err = ioutil.WriteFile(statFile, statContents, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, sigar.Cpu{
+		User:    uint64(5),
+		Nice:    uint64(2),
+		Sys:     uint64(5),
+		Idle:    uint64(7),
+		Wait:    uint64(21),
+		Irq:     uint64(50),
+		SoftIrq: uint64(30),
+		Stolen:  uint64(58),
+	}, <-cpuUsages)
+
+	stop <- struct{}{}
+}
+
+func TestLinuxMemAndSwap(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+MemTotal:         374256 kB
+MemFree:          274460 kB
+Buffers:            9764 kB
+Cached:            38648 kB
+SwapCached:            0 kB
+Active:            33772 kB
+Inactive:          31184 kB
+Active(anon):      16572 kB
+Inactive(anon):      552 kB
+Active(file):      17200 kB
+Inactive(file):    30632 kB
+Unevictable:           0 kB
+Mlocked:               0 kB
+SwapTotal:        786428 kB
+SwapFree:         786428 kB
+Dirty:                 0 kB
+Writeback:             0 kB
+AnonPages:         16564 kB
+Mapped:             6612 kB
+Shmem:               584 kB
+Slab:              19092 kB
+SReclaimable:       9128 kB
+SUnreclaim:         9964 kB
+KernelStack:         672 kB
+PageTables:         1864 kB
+NFS_Unstable:          0 kB
+Bounce:                0 kB
+WritebackTmp:          0 kB
+CommitLimit:      973556 kB
+Committed_AS:      55880 kB
+VmallocTotal:   34359738367 kB
+VmallocUsed:       21428 kB
+VmallocChunk:   34359713596 kB
+HardwareCorrupted:     0 kB
+AnonHugePages:         0 kB
+HugePages_Total:       0
+HugePages_Free:        0
+HugePages_Rsvd:        0
+HugePages_Surp:        0
+Hugepagesize:       2048 kB
+DirectMap4k:       59328 kB
+DirectMap2M:      333824 kB
+`
+
+	meminfoFile := procd + "/meminfo"
+	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := sigar.Mem{}
+	if assert.NoError(t, mem.Get()) {
+		assert.Equal(t, uint64(374256*1024), mem.Total)
+		assert.Equal(t, uint64(274460*1024), mem.Free)
+		assert.Equal(t, uint64(mem.Total-mem.Free), mem.Used)
+		assert.Equal(t, uint64((274460+9764+38648)*1024), mem.ActualFree)
+		assert.Equal(t, uint64(mem.Total-mem.ActualFree), mem.ActualUsed)
+		assert.Equal(t, uint64(9764*1024), mem.Buffers)
+		assert.Equal(t, uint64(38648*1024), mem.Cached)
+		assert.Equal(t, uint64(9128*1024), mem.SReclaimable)
+		assert.Equal(t, uint64(0), mem.Available)
+	}
+
+	swap := sigar.Swap{}
+	if assert.NoError(t, swap.Get()) {
+		assert.Equal(t, uint64(786428*1024), swap.Total)
+		assert.Equal(t, uint64(786428*1024), swap.Free)
+		assert.Equal(t, uint64(0), swap.PageIn)
+		assert.Equal(t, uint64(0), swap.PageOut)
+	}
+}
+
+func TestLinuxSwapPageInOut(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+SwapTotal:        524284 kB
+SwapFree:         520352 kB
+`
+	vmstatContents := `nr_free_pages 7838
+nr_zone_inactive_anon 6817
+pgpgin 4710637
+pgpgout 2560172
+pswpin 1342
+pswpout 9876
+pgalloc_dma 0
+`
+	err := ioutil.WriteFile(procd+"/meminfo", []byte(meminfoContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(procd+"/vmstat", []byte(vmstatContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swap := sigar.Swap{}
+	if assert.NoError(t, swap.Get()) {
+		assert.Equal(t, uint64(524284*1024), swap.Total)
+		assert.Equal(t, uint64(1342), swap.PageIn)
+		assert.Equal(t, uint64(9876), swap.PageOut)
+	}
+}
+
+func TestLinuxProcSched(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Int()
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a SCHED_FIFO thread with rt_priority 50, the priority (field 18) is -51
+	stat := fmt.Sprintf("%d (irq/9-acpi) S 2 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 -51 0 1 0 "+
+		"42 0 0 18446744073709551615 0 0 0 0 0 0 0 2147483647 0 0 0 0 17 0 50 1 0 0 0", pid)
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sched := sigar.ProcSched{}
+	if assert.NoError(t, sched.Get(pid)) {
+		assert.Equal(t, sigar.SchedFIFO, sched.Policy)
+		assert.Equal(t, "SCHED_FIFO", sched.Policy.String())
+		assert.Equal(t, 50, sched.RtPriority)
+	}
+
+	assert.Error(t, sched.Get(pid+1))
+}
+
+func TestLinuxProcCaps(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Int()
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the default capabilities of a docker container
+	status := `Name:	nginx
+Umask:	0022
+State:	S (sleeping)
+Uid:	0	0	0	0
+Gid:	0	0	0	0
+CapInh:	0000000000000000
+CapPrm:	00000000a80425fb
+CapEff:	00000000a80425fb
+CapBnd:	00000000a80425fb
+CapAmb:	0000000000000000
+NoNewPrivs:	0
+`
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caps := sigar.ProcCaps{}
+	if assert.NoError(t, caps.Get(pid)) {
+		assert.Equal(t, []string{
+			"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_FOWNER", "CAP_FSETID",
+			"CAP_KILL", "CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP",
+			"CAP_NET_BIND_SERVICE", "CAP_NET_RAW", "CAP_SYS_CHROOT",
+			"CAP_MKNOD", "CAP_AUDIT_WRITE", "CAP_SETFCAP",
+		}, caps.Effective.Names())
+		assert.Equal(t, caps.Effective, caps.Permitted)
+		assert.Equal(t, caps.Effective, caps.Bounding)
+		assert.Empty(t, caps.Inheritable.Names())
+		assert.Empty(t, caps.Ambient.Names())
+
+		assert.True(t, caps.Has("CAP_NET_BIND_SERVICE"))
+		assert.False(t, caps.Has("CAP_NET_ADMIN"))
+		assert.False(t, caps.Has("CAP_SYS_ADMIN"))
+	}
+
+	// no CapAmb before Linux 4.3
+	status = strings.Replace(status, "CapAmb:	0000000000000000\n", "", 1)
+	status = strings.Replace(status, "CapEff:	00000000a80425fb", "CapEff:	0000003fffffffff", 1)
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if assert.NoError(t, caps.Get(pid)) {
+		assert.True(t, caps.Has("CAP_SYS_ADMIN"))
+		assert.Len(t, caps.Effective.Names(), 38)
+		assert.Empty(t, caps.Ambient.Names())
+	}
+}
+
+func TestLinuxProcMaps(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Int()
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	maps := `55d4c8a3e000-55d4c8a40000 r--p 00000000 08:01 1835010                    /usr/bin/cat
+55d4c8a40000-55d4c8a45000 r-xp 00002000 08:01 1835010                    /usr/bin/cat
+55d4c9c6f000-55d4c9c90000 rw-p 00000000 00:00 0                          [heap]
+7f2c4a000000-7f2c4a021000 rw-p 00000000 00:00 0 
+7f2c4a1e5000-7f2c4a20b000 r-xp 00028000 08:01 1835036                    /usr/lib/x86_64-linux-gnu/libc.so.6
+7f2c4a300000-7f2c4a400000 rw-s 00000000 00:05 32769                      /memfd:my file (deleted)
+7ffc1b6a2000-7ffc1b6c3000 rw-p 00000000 00:00 0                          [stack]
+ffffffffff600000-ffffffffff601000 --xp 00000000 00:00 0                  [vsyscall]
+`
+	rollup := `55d4c8a3e000-ffffffffff601000 ---p 00000000 00:00 0                  [rollup]
+Rss:                2340 kB
+Pss:                 812 kB
+Pss_Anon:            104 kB
+Pss_File:            708 kB
+Pss_Shmem:             0 kB
+Shared_Clean:       1816 kB
+Private_Dirty:       104 kB
+Anonymous:           104 kB
+Swap:                 16 kB
+`
+	for name, contents := range map[string]string{"maps": maps, "smaps_rollup": rollup} {
+		if err := ioutil.WriteFile(filepath.Join(pidDir, name), []byte(contents), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	procMaps := sigar.ProcMaps{}
+	if !assert.NoError(t, procMaps.Get(pid)) {
+		return
+	}
+	if assert.Len(t, procMaps.List, 8) {
+		assert.Equal(t, sigar.ProcMap{
+			Start: 0x55d4c8a40000, End: 0x55d4c8a45000, Perms: "r-xp", Offset: 0x2000,
+			Dev: "08:01", Inode: 1835010, Path: "/usr/bin/cat",
+		}, procMaps.List[1])
+		assert.Equal(t, "[heap]", procMaps.List[2].Path)
+		assert.True(t, procMaps.List[2].Anonymous())
+		assert.Equal(t, uint64(0x21000), procMaps.List[2].Size())
+		assert.Equal(t, "", procMaps.List[3].Path)
+		assert.True(t, procMaps.List[3].Anonymous())
+		assert.Equal(t, "/memfd:my file (deleted)", procMaps.List[5].Path)
+		assert.Equal(t, "rw-s", procMaps.List[5].Perms)
+		assert.False(t, procMaps.List[5].Anonymous())
+		assert.Equal(t, uint64(0xffffffffff601000), procMaps.List[7].End)
+	}
+	assert.Equal(t, uint64(2340*1024), procMaps.Rss)
+	assert.Equal(t, uint64(812*1024), procMaps.Pss)
+	assert.Equal(t, uint64(104*1024), procMaps.AnonRss)
+	assert.Equal(t, uint64((2340-104)*1024), procMaps.FileRss)
+	assert.Equal(t, uint64(16*1024), procMaps.Swap)
+
+	// no smaps_rollup before Linux 4.14
+	os.Remove(filepath.Join(pidDir, "smaps_rollup"))
+	if assert.NoError(t, procMaps.Get(pid)) {
+		assert.Len(t, procMaps.List, 8)
+		assert.Zero(t, procMaps.Rss)
+		assert.Zero(t, procMaps.FileRss)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "maps"), []byte("55d4c8a3e000 r--p\n"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, procMaps.Get(pid))
+}
+
+func TestProcMapsSelf(t *testing.T) {
+	procMaps := sigar.ProcMaps{}
+	if assert.NoError(t, procMaps.Get(os.Getpid())) {
+		assert.NotEmpty(t, procMaps.List)
+		for _, m := range procMaps.List {
+			assert.True(t, m.End > m.Start, "region %+v", m)
+		}
+	}
+}
+
+func BenchmarkProcMapsGet(b *testing.B) {
+	procMaps := sigar.ProcMaps{}
+	pid := os.Getpid()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := procMaps.Get(pid); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLinuxPressure(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	// PSI is missing before Linux 4.20
+	_, _, _, err := sigar.GetPressure()
+	assert.IsType(t, sigar.ErrNotImplemented{}, err)
+
+	if err := os.MkdirAll(filepath.Join(procd, "pressure"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		// no full line for the CPU before Linux 5.13
+		"cpu": "some avg10=1.53 avg60=0.87 avg300=0.31 total=171563716\n",
+		"memory": "some avg10=0.00 avg60=0.12 avg300=0.05 total=2251948\n" +
+			"full avg10=0.00 avg60=0.06 avg300=0.02 total=1309744\n",
+		"io": "some avg10=12.40 avg60=8.01 avg300=3.55 total=942211369\n" +
+			"full avg10=10.11 avg60=6.94 avg300=3.02 total=801246093\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(procd, "pressure", name), []byte(contents), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cpu, mem, io, err := sigar.GetPressure()
+	if assert.NoError(t, err) {
+		assert.Equal(t, sigar.PressureStall{Some10: 1.53, Some60: 0.87, Some300: 0.31, SomeTotal: 171563716}, cpu)
+		assert.Equal(t, sigar.PressureStall{
+			Some60: 0.12, Some300: 0.05, SomeTotal: 2251948,
+			Full60: 0.06, Full300: 0.02, FullTotal: 1309744,
+		}, mem)
+		assert.Equal(t, sigar.PressureStall{
+			Some10: 12.40, Some60: 8.01, Some300: 3.55, SomeTotal: 942211369,
+			Full10: 10.11, Full60: 6.94, Full300: 3.02, FullTotal: 801246093,
+		}, io)
+	}
+}
+
+func TestDeviceNumber(t *testing.T) {
+	major, minor, err := sigar.DeviceNumber("/dev/null")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, major)
+		assert.Equal(t, 3, minor)
+	}
+
+	_, _, err = sigar.DeviceNumber("/proc/self/stat")
+	assert.Error(t, err)
+
+	_, _, err = sigar.DeviceNumber("/dev/no-such-device")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLinuxDeviceName(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	devices := filepath.Join(sysd, "devices/pci0000:00/0000:00:1f.2/block")
+	for _, dir := range []string{
+		filepath.Join(sysd, "dev/block"),
+		filepath.Join(devices, "sda/sda1"),
+		filepath.Join(devices, "cciss!c0d0"),
+		// no uevent, the name of the link target is used
+		filepath.Join(devices, "sdb"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile(filepath.Join(devices, "sda/sda1/uevent"),
+		[]byte("MAJOR=8\nMINOR=1\nDEVNAME=sda1\nDEVTYPE=partition\n"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(devices, "cciss!c0d0/uevent"),
+		[]byte("MAJOR=104\nMINOR=0\nDEVNAME=cciss/c0d0\nDEVTYPE=disk\n"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for dev, target := range map[string]string{
+		"8:1":   "../../devices/pci0000:00/0000:00:1f.2/block/sda/sda1",
+		"104:0": "../../devices/pci0000:00/0000:00:1f.2/block/cciss!c0d0",
+		"8:16":  "../../devices/pci0000:00/0000:00:1f.2/block/sdb",
+	} {
+		if err := os.Symlink(target, filepath.Join(sysd, "dev/block", dev)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		major, minor int
+		name         string
+	}{
+		{8, 1, "/dev/sda1"},
+		{104, 0, "/dev/cciss/c0d0"},
+		{8, 16, "/dev/sdb"},
+	} {
+		name, err := sigar.DeviceName(test.major, test.minor)
+		if assert.NoError(t, err) {
+			assert.Equal(t, test.name, name)
+		}
+	}
+
+	_, err = sigar.DeviceName(8, 2)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLinuxSwapDevices(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	swapsContents := `Filename				Type		Size		Used		Priority
+/dev/sda2                               partition	8388604		1024		-2
+/var/swap\040file                        file		2097148		0		10
+`
+	err := ioutil.WriteFile(procd+"/swaps", []byte(swapsContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swaps := sigar.SwapDeviceList{}
+	if assert.NoError(t, swaps.Get()) {
+		assert.Equal(t, []sigar.SwapDevice{
+			{Name: "/dev/sda2", Type: "partition", Size: 8388604 * 1024, Used: 1024 * 1024, Priority: -2},
+			{Name: "/var/swap file", Type: "file", Size: 2097148 * 1024, Priority: 10},
+		}, swaps.List)
+	}
+
+	// no swap support in the kernel is not an error
+	os.Remove(procd + "/swaps")
+	if assert.NoError(t, swaps.Get()) {
+		assert.Empty(t, swaps.List)
+	}
+}
+
+func TestLinuxMemAndSwapKernel_3_14(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+MemTotal:         500184 kB
+MemFree:           31360 kB
+MemAvailable:     414168 kB
+Buffers:           28740 kB
+Cached:           325408 kB
+SwapCached:          264 kB
+Active:           195476 kB
+Inactive:         198612 kB
+Active(anon):      14920 kB
+Inactive(anon):    27268 kB
+Active(file):     180556 kB
+Inactive(file):   171344 kB
+Unevictable:           0 kB
+Mlocked:               0 kB
+SwapTotal:        524284 kB
+SwapFree:         520352 kB
+Dirty:                 0 kB
+Writeback:             0 kB
+AnonPages:         39772 kB
+Mapped:            24132 kB
+Shmem:              2236 kB
+Slab:              57988 kB
+SReclaimable:      43524 kB
+SUnreclaim:        14464 kB
+KernelStack:        2464 kB
+PageTables:         3096 kB
+NFS_Unstable:          0 kB
+Bounce:                0 kB
+WritebackTmp:          0 kB
+CommitLimit:      774376 kB
+Committed_AS:     490916 kB
+VmallocTotal:   34359738367 kB
+VmallocUsed:           0 kB
+VmallocChunk:          0 kB
+HardwareCorrupted:     0 kB
+AnonHugePages:         0 kB
+CmaTotal:              0 kB
+CmaFree:               0 kB
+HugePages_Total:       0
+HugePages_Free:        0
+HugePages_Rsvd:        0
+HugePages_Surp:        0
+Hugepagesize:       2048 kB
+DirectMap4k:       63424 kB
+DirectMap2M:      460800 kB
+`
+
+	meminfoFile := procd + "/meminfo"
+	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := sigar.Mem{}
+	if assert.NoError(t, mem.Get()) {
+		assert.Equal(t, uint64(500184*1024), mem.Total)
+		assert.Equal(t, uint64(31360*1024), mem.Free)
+		assert.Equal(t, uint64(414168*1024), mem.ActualFree)
+		assert.Equal(t, uint64(mem.Total-mem.Free), mem.Used)
+		assert.Equal(t, uint64(mem.Total-mem.ActualFree), mem.ActualUsed)
+		assert.Equal(t, uint64(28740*1024), mem.Buffers)
+		assert.Equal(t, uint64(325408*1024), mem.Cached)
+		assert.Equal(t, uint64(43524*1024), mem.SReclaimable)
+		assert.Equal(t, uint64(414168*1024), mem.Available)
+	}
+
+	swap := sigar.Swap{}
+	if assert.NoError(t, swap.Get()) {
+		assert.Equal(t, uint64(524284*1024), swap.Total)
+		assert.Equal(t, uint64(520352*1024), swap.Free)
+	}
+}
+
+func TestLinuxMemAndSwapMissingMemTotal(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+MemFree:           31360 kB
+MemAvailable:     414168 kB
+Buffers:           28740 kB
+Cached:           325408 kB
+SwapCached:          264 kB
+Active:           195476 kB
+Inactive:         198612 kB
+Active(anon):      14920 kB
+Inactive(anon):    27268 kB
+Active(file):     180556 kB
+Inactive(file):   171344 kB
+Unevictable:           0 kB
 Mlocked:               0 kB
 SwapTotal:        524284 kB
 SwapFree:         520352 kB
@@ -502,21 +2096,112 @@ Hugepagesize:       2048 kB
 DirectMap4k:       59328 kB
 DirectMap2M:      333824 kB
 `
-
-	meminfoFile := procd + "/meminfo"
-	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
+
+	meminfoFile := procd + "/meminfo"
+	err := ioutil.WriteFile(meminfoFile, []byte(meminfoContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hugePages := sigar.HugeTLBPages{}
+	if assert.NoError(t, hugePages.Get()) {
+		assert.Equal(t, uint64(16), hugePages.Total)
+		assert.Equal(t, uint64(14), hugePages.Free)
+		assert.Equal(t, uint64(2), hugePages.Reserved)
+		assert.Equal(t, uint64(0), hugePages.Surplus)
+		assert.Equal(t, uint64(2048*1024), hugePages.DefaultSize)
+		assert.Equal(t, uint64(4*2048*1024), hugePages.TotalAllocatedSize)
+		assert.Empty(t, hugePages.Sizes)
+	}
+
+	// without the pools of each size, GetHugePages returns the default one
+	pools, err := sigar.GetHugePages()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sigar.HugePages{
+			{Total: 16, Free: 14, Reserved: 2, Surplus: 0, SizeBytes: 2048 * 1024},
+		}, pools)
+	}
+}
+
+func TestLinuxHugeTLBPagesSizes(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+MemTotal:         374256 kB
+MemFree:          274460 kB
+HugePages_Total:      16
+HugePages_Free:       14
+HugePages_Rsvd:        2
+HugePages_Surp:        0
+Hugepagesize:       2048 kB
+`
+	err := ioutil.WriteFile(procd+"/meminfo", []byte(meminfoContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pools := map[string][4]int{
+		"hugepages-2048kB":    {16, 14, 2, 0},
+		"hugepages-1048576kB": {4, 1, 0, 1},
+	}
+	for name, counters := range pools {
+		dir := filepath.Join(sysd, "kernel/mm/hugepages", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i, file := range []string{"nr_hugepages", "free_hugepages", "resv_hugepages", "surplus_hugepages"} {
+			value := []byte(strconv.Itoa(counters[i]) + "\n")
+			if err := ioutil.WriteFile(filepath.Join(dir, file), value, 0444); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	hugePages := sigar.HugeTLBPages{}
+	if assert.NoError(t, hugePages.Get()) {
+		assert.Equal(t, uint64(16), hugePages.Total)
+		assert.Equal(t, []sigar.HugePages{
+			{Total: 16, Free: 14, Reserved: 2, Surplus: 0, SizeBytes: 2048 * 1024},
+			{Total: 4, Free: 1, Reserved: 0, Surplus: 1, SizeBytes: 1024 * 1024 * 1024},
+		}, hugePages.Sizes)
+		assert.Equal(t, uint64(4*2048*1024+3*1024*1024*1024), hugePages.TotalAllocatedSize)
+	}
+
+	list, err := sigar.GetHugePages()
+	if assert.NoError(t, err) {
+		assert.Equal(t, hugePages.Sizes, list)
+	}
+}
+
+func TestLinuxHugeTLBPagesDisabled(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	meminfoContents := `
+MemTotal:         374256 kB
+MemFree:          274460 kB
+HugePages_Total:       0
+HugePages_Free:        0
+HugePages_Rsvd:        0
+HugePages_Surp:        0
+Hugepagesize:       2048 kB
+`
+	err := ioutil.WriteFile(procd+"/meminfo", []byte(meminfoContents), 0444)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	hugePages := sigar.HugeTLBPages{}
 	if assert.NoError(t, hugePages.Get()) {
-		assert.Equal(t, uint64(16), hugePages.Total)
-		assert.Equal(t, uint64(14), hugePages.Free)
-		assert.Equal(t, uint64(2), hugePages.Reserved)
-		assert.Equal(t, uint64(0), hugePages.Surplus)
-		assert.Equal(t, uint64(2048*1024), hugePages.DefaultSize)
-		assert.Equal(t, uint64(4*2048*1024), hugePages.TotalAllocatedSize)
+		assert.Equal(t, uint64(0), hugePages.Total)
+		assert.Equal(t, uint64(0), hugePages.TotalAllocatedSize)
+		assert.Empty(t, hugePages.Sizes)
+	}
+
+	pools, err := sigar.GetHugePages()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sigar.HugePages{{SizeBytes: 2048 * 1024}}, pools)
 	}
 }
 
@@ -546,6 +2231,282 @@ func TestFDUsage(t *testing.T) {
 	}
 }
 
+func TestLinuxFileSystemListProcd(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	initDir := filepath.Join(procd, "1")
+	if err := os.Mkdir(initDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mounts := `overlay / overlay rw,relatime,lowerdir=/l,upperdir=/u,workdir=/w 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+`
+	if err := ioutil.WriteFile(filepath.Join(initDir, "mounts"), []byte(mounts), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	fsList := sigar.FileSystemList{}
+	if assert.NoError(t, fsList.Get()) && assert.Len(t, fsList.List, 2) {
+		assert.Equal(t, "/", fsList.List[0].DirName)
+		assert.Equal(t, "overlay", fsList.List[0].SysTypeName)
+		assert.Equal(t, "/proc", fsList.List[1].DirName)
+	}
+}
+
+func TestLinuxFileSystemUsageByDevice(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	// the device and a symlink to it, like in /dev/disk/by-uuid
+	devDir := filepath.Join(procd, "dev")
+	if err := os.MkdirAll(filepath.Join(devDir, "by-uuid"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dev := filepath.Join(devDir, "sdb1")
+	if err := ioutil.WriteFile(dev, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	uuid := filepath.Join(devDir, "by-uuid", "0a1b")
+	if err := os.Symlink(dev, uuid); err != nil {
+		t.Fatal(err)
+	}
+
+	// dev is mounted at procd and bind mounted at sysd
+	initDir := filepath.Join(procd, "1")
+	if err := os.Mkdir(initDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mounts := fmt.Sprintf(`/dev/sda1 / ext4 rw,relatime 0 0
+%s %s ext4 rw,relatime 0 0
+%s %s ext4 rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid,nodev 0 0
+`, dev, procd, dev, sysd)
+	if err := ioutil.WriteFile(filepath.Join(initDir, "mounts"), []byte(mounts), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	fsList := sigar.FileSystemList{}
+	if assert.NoError(t, fsList.Get()) {
+		for _, name := range []string{dev, uuid} {
+			if fs, ok := fsList.ForDevice(name); assert.True(t, ok, name) {
+				assert.Equal(t, procd, fs.DirName, name)
+			}
+		}
+		if fs, ok := fsList.ForDevice("tmpfs"); assert.True(t, ok) {
+			assert.Equal(t, "/run", fs.DirName)
+		}
+		_, ok := fsList.ForDevice(filepath.Join(devDir, "sdc1"))
+		assert.False(t, ok)
+	}
+
+	s := &sigar.ConcreteSigar{}
+	expected, err := s.GetFileSystemUsage(procd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := s.GetFileSystemUsageByDevice(uuid); assert.NoError(t, err) {
+		assert.Equal(t, expected.Total, usage.Total)
+	}
+	_, err = s.GetFileSystemUsageByDevice(filepath.Join(devDir, "sdc1"))
+	assert.Error(t, err)
+}
+
+func TestLinuxProcArgs(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "comm"), []byte("postgres\n"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmdline string
+		args    []string
+	}{
+		{"/usr/sbin/sshd\x00-D\x00\x00-f\x00", []string{"/usr/sbin/sshd", "-D", "", "-f"}},
+		{"sleep\x00100", []string{"sleep", "100"}},
+		{"postgres: checkpointer   ", []string{"postgres"}},
+		// kernel threads
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "cmdline"), []byte(test.cmdline), 0444); err != nil {
+			t.Fatal(err)
+		}
+		args := sigar.ProcArgs{}
+		if assert.NoError(t, args.Get(pid), "cmdline %q", test.cmdline) {
+			assert.Equal(t, test.args, args.List, "cmdline %q", test.cmdline)
+		}
+	}
+}
+
+func TestLinuxProcEnv(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	environ := "HOME=/root\x00LESSOPEN=| /usr/bin/lesspipe %s\x00OPTS=a=1,b=2\x00EMPTY=\x00"
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "environ"), []byte(environ), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	env := sigar.ProcEnv{}
+	if assert.NoError(t, env.Get(pid)) {
+		assert.Equal(t, map[string]string{
+			"HOME":     "/root",
+			"LESSOPEN": "| /usr/bin/lesspipe %s",
+			"OPTS":     "a=1,b=2",
+			"EMPTY":    "",
+		}, env.Vars)
+
+		value, ok := env.Lookup("OPTS")
+		assert.True(t, ok)
+		assert.Equal(t, "a=1,b=2", value)
+		value, ok = env.Lookup("EMPTY")
+		assert.True(t, ok)
+		assert.Equal(t, "", value)
+		_, ok = env.Lookup("PATH")
+		assert.False(t, ok)
+	}
+
+	assert.Equal(t, syscall.ESRCH, env.Get(pid+1))
+}
+
+func TestLinuxProcThreads(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	taskDir := filepath.Join(procd, strconv.Itoa(pid), "task")
+	stats := map[int]string{
+		pid:     "%d (java) S 1 %d %d 0 -1 4194560 9752 0 0 0 12 3 0 0 20 0 3 0 1825 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		pid + 1: "%d (C2 Compiler) R 1 %d %d 0 -1 4194560 9752 0 0 0 250 40 0 0 20 0 3 0 1830 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		// the thread exits while the tasks are listed
+		pid + 2: "",
+	}
+	if err := os.MkdirAll(taskDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tid, stat := range stats {
+		dir := filepath.Join(taskDir, strconv.Itoa(tid))
+		if stat == "" {
+			// listed, but gone when its stat is read
+			if err := os.Symlink(filepath.Join(taskDir, "exited"), dir); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		contents := fmt.Sprintf(stat, tid, pid, pid)
+		if err := ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(contents), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	threads := sigar.ProcThreads{}
+	if assert.NoError(t, threads.Get(pid)) {
+		assert.Equal(t, []sigar.ThreadInfo{
+			{Tid: pid, Name: "java", State: sigar.RunStateSleep, UserTime: 120, SysTime: 30},
+			{Tid: pid + 1, Name: "C2 Compiler", State: sigar.RunStateRun, UserTime: 2500, SysTime: 400},
+		}, threads.List)
+	}
+
+	assert.Equal(t, sigar.ErrProcessNotFound, threads.Get(pid+3))
+
+	// a thread without a stat file is not an exited one
+	if err := os.Mkdir(filepath.Join(taskDir, strconv.Itoa(pid+4)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := threads.Get(pid)
+	assert.True(t, os.IsNotExist(err), "err=%v", err)
+}
+
+func TestLinuxProcCred(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidStatus("cron", pid, 0, filepath.Join(pidDir, "status")); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := sigar.ProcCred{}
+	if assert.NoError(t, cred.Get(pid)) {
+		assert.Equal(t, sigar.ProcCred{
+			Uid: 0, Euid: 0, Suid: 0,
+			Gid: 100, Egid: 100, Sgid: 100,
+			Groups: []int{100, 14, 16},
+		}, cred)
+	}
+
+	cred = sigar.ProcCred{ResolveNames: true}
+	if assert.NoError(t, cred.Get(pid)) {
+		assert.Equal(t, "root", cred.Username)
+		assert.NotEmpty(t, cred.Groupname)
+		assert.Len(t, cred.GroupNames, 3)
+	}
+
+	assert.Error(t, cred.Get(pid+1))
+}
+
+func TestLinuxProcExePartial(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// cwd is missing, like when reading it is denied
+	if err := os.Symlink("/usr/sbin/cron", filepath.Join(pidDir, "exe")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/", filepath.Join(pidDir, "root")); err != nil {
+		t.Fatal(err)
+	}
+
+	exe := sigar.ProcExe{}
+	err := exe.Get(pid)
+	if assert.True(t, sigar.IsPartial(err), "err=%v", err) {
+		partial := err.(sigar.ErrPartial)
+		assert.Len(t, partial.Errors, 1)
+		assert.Contains(t, partial.Errors, "cwd")
+	}
+	assert.Equal(t, "/usr/sbin/cron", exe.Name)
+	assert.Equal(t, "", exe.Cwd)
+	assert.Equal(t, "/", exe.Root)
+
+	concreteSigar := &sigar.ConcreteSigar{}
+	root, err := concreteSigar.GetProcRoot(pid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/", root)
+	}
+	_, err = concreteSigar.GetProcCwd(pid)
+	assert.True(t, os.IsNotExist(err), "err=%v", err)
+
+	// Nothing can be read from a process that is gone.
+	err = exe.Get(pid + 1)
+	assert.Error(t, err)
+	assert.False(t, sigar.IsPartial(err))
+}
+
 func TestProcFDUsage(t *testing.T) {
 	setUp(t)
 	defer tearDown(t)
@@ -603,6 +2564,320 @@ Max realtime timeout      unlimited            unlimited            us
 	}
 }
 
+func TestProcLimits(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := fmt.Sprintf("%s/%d", procd, pid)
+	err := os.Mkdir(pidDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limitsContents := `Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max stack size            8388608              unlimited            bytes
+Max processes             29875                29875                processes
+Max open files            1024                 4096                 files
+Max nice priority         0                    0
+`
+	err = ioutil.WriteFile(pidDir+"/limits", []byte(limitsContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := sigar.ProcLimits{}
+	if assert.NoError(t, limits.Get(pid)) {
+		assert.Equal(t, map[string]sigar.ProcLimit{
+			"Max cpu time":      {Soft: sigar.LimitUnlimited, Hard: sigar.LimitUnlimited, Units: "seconds"},
+			"Max stack size":    {Soft: 8388608, Hard: sigar.LimitUnlimited, Units: "bytes"},
+			"Max processes":     {Soft: 29875, Hard: 29875, Units: "processes"},
+			"Max open files":    {Soft: 1024, Hard: 4096, Units: "files"},
+			"Max nice priority": {Soft: 0, Hard: 0},
+		}, limits.Limits)
+
+		soft, hard := limits.OpenFiles()
+		assert.Equal(t, uint64(1024), soft)
+		assert.Equal(t, uint64(4096), hard)
+	}
+
+	err = limits.Get(pid + 1)
+	assert.Equal(t, syscall.ESRCH, err)
+}
+
+func TestProcIo(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := fmt.Sprintf("%s/%d", procd, pid)
+	err := os.Mkdir(pidDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioContents := `rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 4096
+write_bytes: 323932160
+cancelled_write_bytes: 1024
+`
+	err = ioutil.WriteFile(pidDir+"/io", []byte(ioContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	procIo := sigar.ProcIo{}
+	if assert.NoError(t, procIo.Get(pid)) {
+		assert.Equal(t, sigar.ProcIo{
+			RChar:               323934931,
+			WChar:               323929600,
+			Syscr:               632687,
+			Syscw:               632675,
+			ReadBytes:           4096,
+			WriteBytes:          323932160,
+			CancelledWriteBytes: 1024,
+		}, procIo)
+	}
+
+	err = procIo.Get(pid + 1)
+	assert.Equal(t, syscall.ESRCH, err)
+}
+
+func TestProcDiskIo(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(pidDir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioContents := "rchar: 100\nwchar: 200\nread_bytes: 4096\nwrite_bytes: 8192\n"
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "io"), []byte(ioContents), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	// two files on the file system of the fixtures, a character
+	// device on devtmpfs and a file that is gone
+	data := filepath.Join(procd, "data")
+	if err := ioutil.WriteFile(data, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for fd, target := range map[string]string{
+		"0": "/dev/null",
+		"3": data,
+		"4": procd,
+		"5": filepath.Join(procd, "deleted"),
+	} {
+		if err := os.Symlink(target, filepath.Join(pidDir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(data, &st); err != nil {
+		t.Fatal(err)
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	if err := os.MkdirAll(filepath.Join(sysd, "dev/block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda/sda3",
+		filepath.Join(sysd, "dev/block", dev)); err != nil {
+		t.Fatal(err)
+	}
+
+	diskIo := sigar.ProcDiskIo{}
+	if assert.NoError(t, diskIo.Get(pid)) {
+		assert.Equal(t, sigar.ProcIo{RChar: 100, WChar: 200, ReadBytes: 4096, WriteBytes: 8192}, diskIo.Io)
+		assert.Equal(t, []string{"sda3"}, diskIo.Devices)
+	}
+
+	// without the sysfs entry no device is known
+	os.Remove(filepath.Join(sysd, "dev/block", dev))
+	if assert.NoError(t, diskIo.Get(pid)) {
+		assert.Empty(t, diskIo.Devices)
+	}
+}
+
+func TestProcStatus(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	pidDir := fmt.Sprintf("%s/%d", procd, pid)
+	err := os.Mkdir(pidDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// status of a 2.6.32 kernel, without VmSwap
+	statusContents := `Name:	sshd
+State:	S (sleeping)
+Tgid:	1024
+Pid:	1024
+PPid:	1
+TracerPid:	0
+Uid:	0	0	0	0
+Gid:	0	0	0	0
+FDSize:	64
+Groups:
+VmPeak:	   66220 kB
+VmSize:	   66216 kB
+VmLck:	       0 kB
+VmHWM:	    1224 kB
+VmRSS:	    1220 kB
+VmData:	     580 kB
+VmStk:	      88 kB
+VmExe:	     536 kB
+VmLib:	    6336 kB
+VmPTE:	     152 kB
+Threads:	3
+SigQ:	0/30692
+SigPnd:	0000000000000000
+ShdPnd:	0000000000000100
+SigBlk:	0000000000010000
+SigIgn:	0000000000001000
+SigCgt:	0000000180014005
+CapInh:	0000000000000000
+CapPrm:	ffffffffffffffff
+CapEff:	ffffffffffffffff
+voluntary_ctxt_switches:	38
+nonvoluntary_ctxt_switches:	2
+`
+	err = ioutil.WriteFile(pidDir+"/status", []byte(statusContents), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := sigar.ProcStatus{}
+	if assert.NoError(t, status.Get(pid)) {
+		assert.Equal(t, sigar.ProcStatus{
+			VmPeak:                   66220 * 1024,
+			VmSize:                   66216 * 1024,
+			VmHWM:                    1224 * 1024,
+			VmRSS:                    1220 * 1024,
+			VmData:                   580 * 1024,
+			VmStk:                    88 * 1024,
+			VmExe:                    536 * 1024,
+			VmLib:                    6336 * 1024,
+			VmPTE:                    152 * 1024,
+			Threads:                  3,
+			VoluntaryCtxtSwitches:    38,
+			NonvoluntaryCtxtSwitches: 2,
+			ShdPnd:                   0x100,
+			SigBlk:                   0x10000,
+			SigIgn:                   0x1000,
+			SigCgt:                   0x180014005,
+		}, status)
+	}
+
+	err = status.Get(pid + 1)
+	assert.Equal(t, syscall.ESRCH, err)
+}
+
+func TestIsNotPermitted(t *testing.T) {
+	assert.True(t, sigar.IsNotPermitted(sigar.ErrNotPermitted{Path: "/proc/1/io"}))
+	assert.True(t, sigar.IsNotPermitted(&sigar.ErrNotPermitted{}))
+	assert.False(t, sigar.IsNotPermitted(syscall.EACCES))
+}
+
+func TestIsProcessNotFound(t *testing.T) {
+	assert.True(t, sigar.IsProcessNotFound(syscall.ESRCH))
+	assert.True(t, sigar.IsProcessNotFound(&os.PathError{Op: "open", Path: "/proc/1/stat", Err: syscall.ESRCH}))
+	assert.False(t, sigar.IsProcessNotFound(syscall.ENOENT))
+	assert.False(t, sigar.IsProcessNotFound(sigar.ErrNotPermitted{Path: "/proc/1/io"}))
+}
+
+func TestLinuxProcessNotFound(t *testing.T) {
+	setUp(t)
+	defer tearDown(t)
+
+	pid := rand.Intn(32768)
+	getters := map[string]interface {
+		Get(int) error
+	}{
+		"ProcState":   &sigar.ProcState{},
+		"ProcMem":     &sigar.ProcMem{},
+		"ProcTime":    &sigar.ProcTime{},
+		"ProcArgs":    &sigar.ProcArgs{},
+		"ProcEnv":     &sigar.ProcEnv{},
+		"ProcExe":     &sigar.ProcExe{},
+		"ProcCred":    &sigar.ProcCred{},
+		"ProcStatus":  &sigar.ProcStatus{},
+		"ProcIo":      &sigar.ProcIo{},
+		"ProcDiskIo":  &sigar.ProcDiskIo{},
+		"ProcCaps":    &sigar.ProcCaps{},
+		"ProcMaps":    &sigar.ProcMaps{},
+		"ProcLimits":  &sigar.ProcLimits{},
+		"ProcFDUsage": &sigar.ProcFDUsage{},
+		"ProcThreads": &sigar.ProcThreads{},
+	}
+	for name, g := range getters {
+		err := g.Get(pid)
+		assert.True(t, sigar.IsProcessNotFound(err), "%s: err=%v", name, err)
+	}
+
+	io := sigar.ProcIo{}
+	assert.Equal(t, sigar.ErrProcessNotFound, io.Get(pid))
+
+	// A file missing from a live process, like io without task I/O
+	// accounting, is not reported as a missing process.
+	pidDir := filepath.Join(procd, strconv.Itoa(pid))
+	if err := os.Mkdir(pidDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := io.Get(pid)
+	assert.True(t, os.IsNotExist(err), "err=%v", err)
+	assert.False(t, sigar.IsProcessNotFound(err), "err=%v", err)
+
+	// Neither is the status file missing from a live process.
+	statPath := filepath.Join(pidDir, "stat")
+	if err := writePidStats(pid, "sleep", statPath); err != nil {
+		t.Fatal(err)
+	}
+	state := sigar.ProcState{}
+	err = state.Get(pid)
+	assert.Error(t, err)
+	assert.False(t, sigar.IsProcessNotFound(err), "err=%v", err)
+
+	// The process exits between reading its stat and its status: stat is
+	// a fifo, and the pid directory is removed before it is closed.
+	stat, err := ioutil.ReadFile(statPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(statPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(statPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		f, err := os.OpenFile(statPath, os.O_WRONLY, 0)
+		if err != nil {
+			exited <- err
+			return
+		}
+		defer f.Close()
+		if _, err := f.Write(stat); err != nil {
+			exited <- err
+			return
+		}
+		exited <- os.RemoveAll(pidDir)
+	}()
+	err = state.Get(pid)
+	if werr := <-exited; werr != nil {
+		t.Fatal(werr)
+	}
+	assert.True(t, sigar.IsProcessNotFound(err), "err=%v", err)
+}
+
 func writeFDs(pid int, count int) error {
 	fdDir := fmt.Sprintf("%s/%d/fd", procd, pid)
 	err := os.Mkdir(fdDir, 0755)
@@ -672,6 +2947,6 @@ Seccomp:        0
 voluntary_ctxt_switches:        0
 nonvoluntary_ctxt_switches:     1`
 
-	statusContents := []byte(fmt.Sprintf(status, name, pid, uid))
+	statusContents := []byte(fmt.Sprintf(status, name, pid, uid, uid, uid, uid))
 	return ioutil.WriteFile(pidStatusFile, statusContents, 0644)
 }
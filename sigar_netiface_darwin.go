@@ -0,0 +1,91 @@
+package gosigar
+
+/*
+#include <stdlib.h>
+#include <sys/types.h>
+#include <sys/socket.h>
+#include <sys/sysctl.h>
+#include <net/if.h>
+#include <net/route.h>
+*/
+import "C"
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func (self *NetIfaceStatList) Get() error {
+	buf, err := ifList2()
+	if err != nil {
+		return err
+	}
+
+	self.List = make([]NetIfaceStat, 0, 4)
+
+	// the RTM_IFINFO2 message of each interface carries its 64-bit
+	// if_data64 counters, the 32-bit if_data ones wrap at 4 GiB
+	hdrLen := int(unsafe.Sizeof(C.struct_if_msghdr{}))
+	for off := 0; off+hdrLen <= len(buf); {
+		hdr := (*C.struct_if_msghdr)(unsafe.Pointer(&buf[off]))
+		msgLen := int(hdr.ifm_msglen)
+		if msgLen == 0 || off+msgLen > len(buf) {
+			break
+		}
+		if hdr.ifm_type == C.RTM_IFINFO2 {
+			msg := (*C.struct_if_msghdr2)(unsafe.Pointer(hdr))
+			if stat, ok := ifaceStat(msg); ok {
+				self.List = append(self.List, stat)
+			}
+		}
+		off += msgLen
+	}
+
+	return nil
+}
+
+func ifaceStat(msg *C.struct_if_msghdr2) (NetIfaceStat, bool) {
+	var name [C.IF_NAMESIZE]C.char
+	if C.if_indextoname(C.uint(msg.ifm_index), &name[0]) == nil {
+		// the interface went away
+		return NetIfaceStat{}, false
+	}
+	data := &msg.ifm_data
+
+	return NetIfaceStat{
+		Name:      C.GoString(&name[0]),
+		Loopback:  msg.ifm_flags&syscall.IFF_LOOPBACK != 0,
+		RxBytes:   uint64(data.ifi_ibytes),
+		TxBytes:   uint64(data.ifi_obytes),
+		RxPackets: uint64(data.ifi_ipackets),
+		TxPackets: uint64(data.ifi_opackets),
+		RxErrors:  uint64(data.ifi_ierrors),
+		TxErrors:  uint64(data.ifi_oerrors),
+		RxDropped: uint64(data.ifi_iqdrops),
+		TxDropped: uint64(msg.ifm_snd_drops),
+	}, true
+}
+
+// read the routing messages of sysctl NET_RT_IFLIST2
+func ifList2() ([]byte, error) {
+	mib := []C.int{C.CTL_NET, C.PF_ROUTE, 0, 0, C.NET_RT_IFLIST2, 0}
+	for {
+		var n uintptr
+		if err := sysctl(mib, nil, &n, nil, 0); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n)
+		err := sysctl(mib, &buf[0], &n, nil, 0)
+		if err == syscall.ENOMEM {
+			// an interface was added between the two calls
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
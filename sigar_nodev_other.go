@@ -0,0 +1,8 @@
+// +build !freebsd,!linux
+
+package gosigar
+
+// Without /proc/filesystems only the DefaultPseudoFileSystems are known
+func nodevFileSystems() ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,31 @@
+// +build !linux
+
+package gosigar
+
+import "runtime"
+
+// Pid namespaces only exist on Linux
+
+func (p *NsProc) Pid() (int, error) {
+	return 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *NsProc) GetProcState() (ProcState, error) {
+	return ProcState{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *NsProc) GetProcMem() (ProcMem, error) {
+	return ProcMem{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *NsProc) GetProcTime() (ProcTime, error) {
+	return ProcTime{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *NsProc) GetProcArgs() ([]string, error) {
+	return nil, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *NsProc) GetProcStatus() (ProcStatus, error) {
+	return ProcStatus{}, ErrNotImplemented{runtime.GOOS}
+}
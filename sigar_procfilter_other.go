@@ -0,0 +1,31 @@
+// +build !freebsd,!linux
+
+package gosigar
+
+// matchProc reports whether pid matches f, the owner is only read when
+// the state and the name match.
+func matchProc(pid int, f ProcFilter) (bool, error) {
+	if len(f.States) > 0 || f.Name != nil {
+		state := ProcState{}
+		if err := state.Get(pid); err != nil {
+			return false, err
+		}
+		if !f.matchState(state.State) {
+			return false, nil
+		}
+		if f.Name != nil && !f.Name(state.Name) {
+			return false, nil
+		}
+	}
+
+	if len(f.Uids) > 0 {
+		cred := ProcCred{}
+		if err := cred.Get(pid); err != nil {
+			return false, err
+		}
+		if !f.matchUid(cred.Uid) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package gosigar
+
+// Sample is the same as Get, only Linux has a path allocating less
+func (self *Cpu) Sample() error {
+	return self.Get()
+}
@@ -22,10 +22,118 @@ func (s *Swap) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (u *Uptime) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (s *HugeTLBPages) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (p *ProcMaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcCaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcDiskIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (n *NetProtoStats) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcSched) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (s *SwapDeviceList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func numCpu() (int, int, error) {
+	return 0, 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func getPressure() (PressureStall, PressureStall, PressureStall, error) {
+	return PressureStall{}, PressureStall{}, PressureStall{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceName(major, minor int) (string, error) {
+	return "", ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceNumber(path string) (major, minor int, err error) {
+	return 0, 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcFDs) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcThreads) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (f *FanList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (b *BatteryList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (t *TemperatureList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (n *NumaNodeList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (c *CpuTopology) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcLimits) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcStatus) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcCred) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (p *ProcNetConnections) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (n *NetConnectionList) Get(NetConnFlags) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (n *NetIfaceStatList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (d *DiskIoList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (c *CpuFreq) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (f *FDUsage) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
@@ -34,6 +142,10 @@ func (p *ProcTime) Get(int) error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *FileSystemList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (self *FileSystemUsage) Get(path string) error {
 	return ErrNotImplemented{runtime.GOOS}
 }
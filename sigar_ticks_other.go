@@ -0,0 +1,9 @@
+// +build !freebsd,!linux
+
+package gosigar
+
+// ClockTicks returns 100, the conventional frequency of the clock ticks,
+// the readers of this OS do not convert ticks
+func ClockTicks() int64 {
+	return 100
+}
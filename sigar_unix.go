@@ -5,6 +5,7 @@
 package gosigar
 
 import (
+	"fmt"
 	"syscall"
 	"time"
 
@@ -67,3 +68,22 @@ func getResourceUsage(who int) (unix.Rusage, error) {
 func convertRtimeToDur(t unix.Timeval) time.Duration {
 	return time.Duration(t.Nano())
 }
+
+// deviceNumber returns the major and minor numbers of the block or
+// character device node at path, like 8 and 1 for /dev/sda1. These are the
+// numbers of /proc/diskstats and of the mount info, see DeviceName for the
+// reverse lookup.
+func deviceNumber(path string) (major, minor int, err error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	mode := st.Mode & unix.S_IFMT
+	if mode != unix.S_IFBLK && mode != unix.S_IFCHR {
+		return 0, 0, fmt.Errorf("%s is not a device node", path)
+	}
+
+	dev := uint64(st.Rdev)
+	return int(unix.Major(dev)), int(unix.Minor(dev)), nil
+}
@@ -124,6 +124,110 @@ func (self *HugeTLBPages) Get() error {
 	return ErrNotImplemented{runtime.GOOS}
 }
 
+func (self *ProcMaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcCaps) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcDiskIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetProtoStats) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcSched) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *SwapDeviceList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func numCpu() (online, possible int, err error) {
+	return 0, 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func getPressure() (cpu, mem, io PressureStall, err error) {
+	return PressureStall{}, PressureStall{}, PressureStall{}, ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceName(major, minor int) (string, error) {
+	return "", ErrNotImplemented{runtime.GOOS}
+}
+
+func deviceNumber(path string) (major, minor int, err error) {
+	return 0, 0, ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcFDs) Get(pid int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcThreads) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *FanList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *BatteryList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *TemperatureList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NumaNodeList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuTopology) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcLimits) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcStatus) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcCred) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcIo) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *ProcNetConnections) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetConnectionList) Get(NetConnFlags) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *NetIfaceStatList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *DiskIoList) Get() error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
+func (self *CpuFreq) Get(int) error {
+	return ErrNotImplemented{runtime.GOOS}
+}
+
 func (self *Cpu) Get() error {
 	idle, kernel, user, err := windows.GetSystemTimes()
 	if err != nil {
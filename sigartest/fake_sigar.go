@@ -0,0 +1,365 @@
+// Package sigartest provides a FakeSigar that returns canned values, to
+// replace gosigar.DefaultSigar in tests.
+package sigartest
+
+import (
+	"time"
+
+	sigar "github.com/elastic/gosigar"
+)
+
+type FakeSigar struct {
+	LoadAverage    sigar.LoadAverage
+	LoadAverageErr error
+
+	Mem    sigar.Mem
+	MemErr error
+
+	Swap    sigar.Swap
+	SwapErr error
+
+	SwapDevices    []sigar.SwapDevice
+	SwapDevicesErr error
+
+	CpuPercentage    sigar.CpuPercent
+	CpuPercentageErr error
+
+	LoadAveragePercent    sigar.LoadAverage
+	LoadAveragePercentErr error
+
+	Uptime    sigar.Uptime
+	UptimeErr error
+
+	CpuList    sigar.CpuList
+	CpuListErr error
+
+	CpuFreq     sigar.CpuFreq
+	CpuFreqErr  error
+	CpuFreqCore int
+
+	CpuTopology    sigar.CpuTopology
+	CpuTopologyErr error
+
+	NumaNodes    []sigar.NumaNode
+	NumaNodesErr error
+
+	Temperatures    []sigar.Temperature
+	TemperaturesErr error
+
+	Fans    []sigar.Fan
+	FansErr error
+
+	Batteries    []sigar.Battery
+	BatteriesErr error
+
+	HugeTLBPages    sigar.HugeTLBPages
+	HugeTLBPagesErr error
+
+	HugePages    []sigar.HugePages
+	HugePagesErr error
+
+	FileSystemList    sigar.FileSystemList
+	FileSystemListErr error
+
+	FileSystemUsage     sigar.FileSystemUsage
+	FileSystemUsageErr  error
+	FileSystemUsagePath string
+	FileSystemUsageDev  string
+
+	FileSystemUsages    map[string]sigar.FileSystemUsage
+	FileSystemUsagesErr error
+
+	DiskIoList    sigar.DiskIoList
+	DiskIoListErr error
+
+	NetIfaceStats    []sigar.NetIfaceStat
+	NetIfaceStatsErr error
+
+	NetProtoStats    sigar.NetProtoStats
+	NetProtoStatsErr error
+
+	NetConnections      []sigar.NetConnection
+	NetConnectionsErr   error
+	NetConnectionsFlags sigar.NetConnFlags
+
+	ProcNetConnections    []sigar.NetConnection
+	ProcNetConnectionsErr error
+	ProcNetConnectionsPid int
+
+	ProcList    []int
+	ProcListErr error
+
+	ProcListFiltered    []int
+	ProcListFilteredErr error
+	ProcListFilter      sigar.ProcFilter
+
+	ProcArgs    []string
+	ProcArgsErr error
+	ProcArgsPid int
+
+	ProcCwd    string
+	ProcCwdErr error
+	ProcCwdPid int
+
+	ProcRoot    string
+	ProcRootErr error
+	ProcRootPid int
+
+	ProcStates     map[int]sigar.ProcState
+	ProcStatesErrs []error
+	ProcStatesPids []int
+
+	FDUsage    sigar.FDUsage
+	FDUsageErr error
+
+	Rusage    sigar.Rusage
+	RusageErr error
+	RusageWho int
+
+	NumCpuOnline   int
+	NumCpuPossible int
+	NumCpuErr      error
+
+	PressureCpu sigar.PressureStall
+	PressureMem sigar.PressureStall
+	PressureIo  sigar.PressureStall
+	PressureErr error
+
+	DeviceNameMajor int
+	DeviceNameMinor int
+	DeviceNameValue string
+	DeviceNameErr   error
+
+	DeviceNumberPath  string
+	DeviceNumberMajor int
+	DeviceNumberMinor int
+	DeviceNumberErr   error
+
+	CollectCpuStatsCpuCh  chan sigar.Cpu
+	CollectCpuStatsStopCh chan struct{}
+
+	CollectCpuListStatsCpuListCh chan sigar.CpuList
+	CollectCpuListStatsStopCh    chan struct{}
+}
+
+var _ sigar.Sigar = &FakeSigar{}
+
+func NewFakeSigar() *FakeSigar {
+	return &FakeSigar{
+		CollectCpuStatsCpuCh:         make(chan sigar.Cpu, 1),
+		CollectCpuStatsStopCh:        make(chan struct{}),
+		CollectCpuListStatsCpuListCh: make(chan sigar.CpuList, 1),
+		CollectCpuListStatsStopCh:    make(chan struct{}),
+	}
+}
+
+func (f *FakeSigar) CollectCpuStats(collectionInterval time.Duration) (<-chan sigar.Cpu, chan<- struct{}) {
+	samplesCh := make(chan sigar.Cpu, 1)
+	stopCh := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case cpuStat := <-f.CollectCpuStatsCpuCh:
+				select {
+				case samplesCh <- cpuStat:
+				default:
+					// Include default to avoid channel blocking
+				}
+
+			case <-f.CollectCpuStatsStopCh:
+				return
+			}
+		}
+	}()
+
+	return samplesCh, stopCh
+}
+
+func (f *FakeSigar) CollectCpuListStats(collectionInterval time.Duration) (<-chan sigar.CpuList, chan<- struct{}) {
+	samplesCh := make(chan sigar.CpuList, 1)
+	stopCh := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case cpuList := <-f.CollectCpuListStatsCpuListCh:
+				select {
+				case samplesCh <- cpuList:
+				default:
+					// Include default to avoid channel blocking
+				}
+
+			case <-f.CollectCpuListStatsStopCh:
+				return
+			}
+		}
+	}()
+
+	return samplesCh, stopCh
+}
+
+func (f *FakeSigar) GetCpuPercentage() (sigar.CpuPercent, error) {
+	return f.CpuPercentage, f.CpuPercentageErr
+}
+
+func (f *FakeSigar) GetLoadAverage() (sigar.LoadAverage, error) {
+	return f.LoadAverage, f.LoadAverageErr
+}
+
+func (f *FakeSigar) GetLoadAveragePercent() (sigar.LoadAverage, error) {
+	return f.LoadAveragePercent, f.LoadAveragePercentErr
+}
+
+func (f *FakeSigar) GetUptime() (sigar.Uptime, error) {
+	return f.Uptime, f.UptimeErr
+}
+
+func (f *FakeSigar) GetMem() (sigar.Mem, error) {
+	return f.Mem, f.MemErr
+}
+
+func (f *FakeSigar) GetSwap() (sigar.Swap, error) {
+	return f.Swap, f.SwapErr
+}
+
+func (f *FakeSigar) GetSwapDevices() ([]sigar.SwapDevice, error) {
+	return f.SwapDevices, f.SwapDevicesErr
+}
+
+func (f *FakeSigar) GetFileSystemUsage(path string) (sigar.FileSystemUsage, error) {
+	f.FileSystemUsagePath = path
+	return f.FileSystemUsage, f.FileSystemUsageErr
+}
+
+func (f *FakeSigar) GetCpuList() (sigar.CpuList, error) {
+	return f.CpuList, f.CpuListErr
+}
+
+func (f *FakeSigar) GetCpuFreq(core int) (sigar.CpuFreq, error) {
+	f.CpuFreqCore = core
+	return f.CpuFreq, f.CpuFreqErr
+}
+
+func (f *FakeSigar) GetCpuTopology() (sigar.CpuTopology, error) {
+	return f.CpuTopology, f.CpuTopologyErr
+}
+
+func (f *FakeSigar) GetNumaNodes() ([]sigar.NumaNode, error) {
+	return f.NumaNodes, f.NumaNodesErr
+}
+
+func (f *FakeSigar) GetTemperatures() ([]sigar.Temperature, error) {
+	return f.Temperatures, f.TemperaturesErr
+}
+
+func (f *FakeSigar) GetFans() ([]sigar.Fan, error) {
+	return f.Fans, f.FansErr
+}
+
+func (f *FakeSigar) GetBatteries() ([]sigar.Battery, error) {
+	return f.Batteries, f.BatteriesErr
+}
+
+func (f *FakeSigar) GetHugeTLBPages() (sigar.HugeTLBPages, error) {
+	return f.HugeTLBPages, f.HugeTLBPagesErr
+}
+
+func (f *FakeSigar) GetHugePages() ([]sigar.HugePages, error) {
+	return f.HugePages, f.HugePagesErr
+}
+
+func (f *FakeSigar) GetFileSystemList() (sigar.FileSystemList, error) {
+	return f.FileSystemList, f.FileSystemListErr
+}
+
+func (f *FakeSigar) GetFileSystemUsageTimeout(path string, timeout time.Duration) (sigar.FileSystemUsage, error) {
+	return f.GetFileSystemUsage(path)
+}
+
+func (f *FakeSigar) GetFileSystemUsages(paths []string, timeout time.Duration) (map[string]sigar.FileSystemUsage, error) {
+	return f.FileSystemUsages, f.FileSystemUsagesErr
+}
+
+func (f *FakeSigar) GetFileSystemUsageByDevice(dev string) (sigar.FileSystemUsage, error) {
+	f.FileSystemUsageDev = dev
+	return f.FileSystemUsage, f.FileSystemUsageErr
+}
+
+func (f *FakeSigar) GetDiskIoList() (sigar.DiskIoList, error) {
+	return f.DiskIoList, f.DiskIoListErr
+}
+
+func (f *FakeSigar) GetNetIfaceStats() ([]sigar.NetIfaceStat, error) {
+	return f.NetIfaceStats, f.NetIfaceStatsErr
+}
+
+func (f *FakeSigar) GetNetProtoStats() (sigar.NetProtoStats, error) {
+	return f.NetProtoStats, f.NetProtoStatsErr
+}
+
+func (f *FakeSigar) GetNetConnections(flags sigar.NetConnFlags) ([]sigar.NetConnection, error) {
+	f.NetConnectionsFlags = flags
+	return f.NetConnections, f.NetConnectionsErr
+}
+
+func (f *FakeSigar) GetProcNetConnections(pid int) ([]sigar.NetConnection, error) {
+	f.ProcNetConnectionsPid = pid
+	return f.ProcNetConnections, f.ProcNetConnectionsErr
+}
+
+func (f *FakeSigar) GetProcList() ([]int, error) {
+	return f.ProcList, f.ProcListErr
+}
+
+func (f *FakeSigar) GetProcListFiltered(filter sigar.ProcFilter) ([]int, error) {
+	f.ProcListFilter = filter
+	return f.ProcListFiltered, f.ProcListFilteredErr
+}
+
+func (f *FakeSigar) GetProcArgs(pid int) ([]string, error) {
+	f.ProcArgsPid = pid
+	return f.ProcArgs, f.ProcArgsErr
+}
+
+func (f *FakeSigar) GetProcCwd(pid int) (string, error) {
+	f.ProcCwdPid = pid
+	return f.ProcCwd, f.ProcCwdErr
+}
+
+func (f *FakeSigar) GetProcRoot(pid int) (string, error) {
+	f.ProcRootPid = pid
+	return f.ProcRoot, f.ProcRootErr
+}
+
+func (f *FakeSigar) GetFDUsage() (sigar.FDUsage, error) {
+	return f.FDUsage, f.FDUsageErr
+}
+
+func (f *FakeSigar) GetRusage(who int) (sigar.Rusage, error) {
+	f.RusageWho = who
+	return f.Rusage, f.RusageErr
+}
+
+func (f *FakeSigar) GetProcStateBatch(pids []int) (map[int]sigar.ProcState, []error) {
+	f.ProcStatesPids = pids
+	return f.ProcStates, f.ProcStatesErrs
+}
+
+func (f *FakeSigar) NumCpu() (online, possible int, err error) {
+	return f.NumCpuOnline, f.NumCpuPossible, f.NumCpuErr
+}
+
+func (f *FakeSigar) GetPressure() (cpu, mem, io sigar.PressureStall, err error) {
+	return f.PressureCpu, f.PressureMem, f.PressureIo, f.PressureErr
+}
+
+func (f *FakeSigar) DeviceName(major, minor int) (string, error) {
+	f.DeviceNameMajor, f.DeviceNameMinor = major, minor
+	return f.DeviceNameValue, f.DeviceNameErr
+}
+
+func (f *FakeSigar) DeviceNumber(path string) (major, minor int, err error) {
+	f.DeviceNumberPath = path
+	return f.DeviceNumberMajor, f.DeviceNumberMinor, f.DeviceNumberErr
+}
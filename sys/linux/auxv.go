@@ -0,0 +1,48 @@
+// +build linux
+
+package linux
+
+import (
+	"io/ioutil"
+	"strconv"
+)
+
+// Types of the auxiliary vector entries, from <linux/auxvec.h>
+const (
+	AT_NULL   = 0
+	AT_PAGESZ = 6
+	AT_CLKTCK = 17
+)
+
+// GetAuxv returns the value of an entry of the auxiliary vector of the
+// process, read from /proc/self/auxv, false when it is missing.
+func GetAuxv(key uint64) (uint64, bool) {
+	auxv, err := ioutil.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return 0, false
+	}
+	return parseAuxv(auxv, key)
+}
+
+// parseAuxv looks up key in an auxiliary vector, pairs of native
+// words ending with AT_NULL.
+func parseAuxv(auxv []byte, key uint64) (uint64, bool) {
+	word := strconv.IntSize / 8
+	read := func(b []byte) uint64 {
+		if word == 4 {
+			return uint64(byteOrder.Uint32(b))
+		}
+		return byteOrder.Uint64(b)
+	}
+
+	for i := 0; i+2*word <= len(auxv); i += 2 * word {
+		k := read(auxv[i:])
+		if k == AT_NULL {
+			break
+		}
+		if k == key {
+			return read(auxv[i+word:]), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,53 @@
+// +build linux
+
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func auxv(entries ...uint64) []byte {
+	buf := new(bytes.Buffer)
+	for _, v := range entries {
+		if strconv.IntSize == 32 {
+			binary.Write(buf, byteOrder, uint32(v))
+		} else {
+			binary.Write(buf, byteOrder, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestParseAuxv(t *testing.T) {
+	data := auxv(AT_PAGESZ, 4096, AT_CLKTCK, 250, AT_NULL, 0, 42, 1)
+
+	hz, ok := parseAuxv(data, AT_CLKTCK)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(250), hz)
+
+	pagesz, ok := parseAuxv(data, AT_PAGESZ)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4096), pagesz)
+
+	// the entries after AT_NULL are ignored
+	_, ok = parseAuxv(data, 42)
+	assert.False(t, ok)
+	_, ok = parseAuxv(nil, AT_CLKTCK)
+	assert.False(t, ok)
+	// truncated entry
+	_, ok = parseAuxv(data[:strconv.IntSize/8*3], AT_CLKTCK)
+	assert.False(t, ok)
+}
+
+func TestGetClockTicks(t *testing.T) {
+	assert.True(t, GetClockTicks() > 0)
+
+	if hz, ok := GetAuxv(AT_CLKTCK); ok {
+		assert.Equal(t, int(hz), GetClockTicks())
+	}
+}
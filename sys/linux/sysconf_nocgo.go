@@ -1,8 +1,23 @@
-// +build !cgo !linux
+// +build linux,!cgo
 
 package linux
 
+import "sync"
+
+var (
+	clockTicks     int
+	clockTicksOnce sync.Once
+)
+
 // GetClockTicks returns the number of click ticks in one jiffie.
+// Without cgo it is the AT_CLKTCK entry of the auxiliary vector,
+// or 100 when it cannot be read.
 func GetClockTicks() int {
-	return 100
+	clockTicksOnce.Do(func() {
+		clockTicks = 100
+		if hz, ok := GetAuxv(AT_CLKTCK); ok && hz > 0 {
+			clockTicks = int(hz)
+		}
+	})
+	return clockTicks
 }
@@ -0,0 +1,8 @@
+// +build !linux
+
+package linux
+
+// GetClockTicks returns the number of click ticks in one jiffie.
+func GetClockTicks() int {
+	return 100
+}